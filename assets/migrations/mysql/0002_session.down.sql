@@ -0,0 +1,2 @@
+DROP INDEX idx_message_session ON message;
+ALTER TABLE message DROP COLUMN session;
@@ -0,0 +1,3 @@
+ALTER TABLE message ADD COLUMN session VARCHAR(32);
+
+CREATE INDEX idx_message_session ON message (session);
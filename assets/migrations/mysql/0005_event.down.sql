@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS message (
+	id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME(6),
+	client_ip  VARCHAR(64),
+	service    VARCHAR(32),
+	username   VARCHAR(64),
+	password   VARCHAR(64),
+	command    TEXT,
+	session    VARCHAR(32),
+	script     VARCHAR(255),
+	decoded    TEXT
+);
+
+CREATE INDEX idx_message_service   ON message (service);
+CREATE INDEX idx_message_username  ON message (username);
+CREATE INDEX idx_message_client_ip ON message (client_ip);
+CREATE INDEX idx_message_session   ON message (session);
+
+-- the events without the legacy fields are dropped
+INSERT INTO message (created_at, client_ip, service, username, password, command, session, script, decoded)
+SELECT created_at, src_ip, protocol, username, password, command, session, script, decoded
+FROM event
+WHERE type IN ('connect', 'auth.password', 'command')
+ORDER BY id;
+
+DROP TABLE IF EXISTS event;
@@ -0,0 +1,2 @@
+DROP INDEX idx_event_dst_ip ON event;
+DROP INDEX idx_event_dst_port ON event;
@@ -0,0 +1,6 @@
+DROP INDEX idx_event_country ON event;
+DROP INDEX idx_event_asn ON event;
+ALTER TABLE event DROP COLUMN country;
+ALTER TABLE event DROP COLUMN city;
+ALTER TABLE event DROP COLUMN asn;
+ALTER TABLE event DROP COLUMN org;
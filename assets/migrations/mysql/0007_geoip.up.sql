@@ -0,0 +1,7 @@
+ALTER TABLE event ADD COLUMN country VARCHAR(8);
+ALTER TABLE event ADD COLUMN city    VARCHAR(128);
+ALTER TABLE event ADD COLUMN asn     BIGINT;
+ALTER TABLE event ADD COLUMN org     VARCHAR(255);
+
+CREATE INDEX idx_event_country ON event (country);
+CREATE INDEX idx_event_asn     ON event (asn);
@@ -0,0 +1,2 @@
+DROP INDEX idx_rollup_field ON rollup;
+DROP TABLE IF EXISTS rollup;
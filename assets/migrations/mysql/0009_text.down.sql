@@ -0,0 +1,6 @@
+UPDATE event SET username = LEFT(username, 64), password = LEFT(password, 64), session = LEFT(session, 32), script = LEFT(script, 255);
+
+ALTER TABLE event MODIFY COLUMN username VARCHAR(64);
+ALTER TABLE event MODIFY COLUMN password VARCHAR(64);
+ALTER TABLE event MODIFY COLUMN session  VARCHAR(32);
+ALTER TABLE event MODIFY COLUMN script   VARCHAR(255);
@@ -0,0 +1,6 @@
+-- the values controlled by the clients are truncated to the column by the store,
+-- the indexed columns are kept in the VARCHAR
+ALTER TABLE event MODIFY COLUMN username VARCHAR(255);
+ALTER TABLE event MODIFY COLUMN password TEXT;
+ALTER TABLE event MODIFY COLUMN session  VARCHAR(255);
+ALTER TABLE event MODIFY COLUMN script   TEXT;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS rollup_day (
+	day        VARCHAR(10) NOT NULL,
+	service    VARCHAR(32) NOT NULL,
+	field      VARCHAR(32) NOT NULL,
+	digest     CHAR(64)    NOT NULL,
+	value      TEXT,
+	count      BIGINT NOT NULL DEFAULT 0,
+	first_seen DATETIME(6),
+	last_seen  DATETIME(6),
+	PRIMARY KEY (day, service, field, digest)
+);
+
+INSERT INTO rollup_day (day, service, field, digest, value, count, first_seen, last_seen)
+SELECT SUBSTR(hour, 1, 10), service, field, digest, MAX(value), SUM(count), MIN(first_seen), MAX(last_seen)
+FROM rollup
+GROUP BY SUBSTR(hour, 1, 10), service, field, digest;
+
+DROP TABLE IF EXISTS rollup;
+ALTER TABLE rollup_day RENAME TO rollup;
+
+CREATE INDEX idx_rollup_field ON rollup (field, day);
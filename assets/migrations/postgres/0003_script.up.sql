@@ -0,0 +1 @@
+ALTER TABLE message ADD COLUMN script VARCHAR(255);
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS message (
+	id         BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMP,
+	client_ip  VARCHAR(64),
+	service    VARCHAR(32),
+	username   VARCHAR(64),
+	password   VARCHAR(64),
+	command    TEXT,
+	session    VARCHAR(32),
+	script     VARCHAR(255),
+	decoded    TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_service   ON message (service);
+CREATE INDEX IF NOT EXISTS idx_message_username  ON message (username);
+CREATE INDEX IF NOT EXISTS idx_message_client_ip ON message (client_ip);
+CREATE INDEX IF NOT EXISTS idx_message_session   ON message (session);
+
+-- the events without the legacy fields are dropped
+INSERT INTO message (created_at, client_ip, service, username, password, command, session, script, decoded)
+SELECT created_at, src_ip, protocol, username, password, command, session, script, decoded
+FROM event
+WHERE type IN ('connect', 'auth.password', 'command')
+ORDER BY id;
+
+DROP INDEX IF EXISTS idx_event_created_at;
+DROP INDEX IF EXISTS idx_event_type;
+DROP INDEX IF EXISTS idx_event_session;
+DROP INDEX IF EXISTS idx_event_src_ip;
+DROP INDEX IF EXISTS idx_event_username;
+DROP TABLE IF EXISTS event;
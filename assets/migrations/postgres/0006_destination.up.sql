@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_event_dst_ip   ON event (dst_ip);
+CREATE INDEX IF NOT EXISTS idx_event_dst_port ON event (dst_port);
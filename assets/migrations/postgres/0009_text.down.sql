@@ -0,0 +1,4 @@
+ALTER TABLE event ALTER COLUMN username TYPE VARCHAR(64)  USING LEFT(username, 64);
+ALTER TABLE event ALTER COLUMN password TYPE VARCHAR(64)  USING LEFT(password, 64);
+ALTER TABLE event ALTER COLUMN session  TYPE VARCHAR(32)  USING LEFT(session, 32);
+ALTER TABLE event ALTER COLUMN script   TYPE VARCHAR(255) USING LEFT(script, 255);
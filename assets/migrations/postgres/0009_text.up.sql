@@ -0,0 +1,5 @@
+-- the values controlled by the clients are not limited by the length
+ALTER TABLE event ALTER COLUMN username TYPE TEXT;
+ALTER TABLE event ALTER COLUMN password TYPE TEXT;
+ALTER TABLE event ALTER COLUMN session  TYPE TEXT;
+ALTER TABLE event ALTER COLUMN script   TYPE TEXT;
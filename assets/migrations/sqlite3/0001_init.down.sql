@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_message_service;
+DROP INDEX IF EXISTS idx_message_username;
+DROP INDEX IF EXISTS idx_message_client_ip;
+DROP TABLE IF EXISTS message;
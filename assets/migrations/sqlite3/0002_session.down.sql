@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_message_session;
+ALTER TABLE message DROP COLUMN session;
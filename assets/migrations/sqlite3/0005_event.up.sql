@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS event (
+	id         integer PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP,
+	type       VARCHAR(32),
+	sensor     VARCHAR(64),
+	session    VARCHAR(32),
+	protocol   VARCHAR(32),
+	src_ip     VARCHAR(64),
+	src_port   INTEGER,
+	dst_ip     VARCHAR(64),
+	dst_port   INTEGER,
+	username   VARCHAR(64),
+	password   VARCHAR(64),
+	command    TEXT,
+	script     VARCHAR(255),
+	decoded    TEXT,
+	payload    TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_created_at ON event (created_at);
+CREATE INDEX IF NOT EXISTS idx_event_type       ON event (type);
+CREATE INDEX IF NOT EXISTS idx_event_session    ON event (session);
+CREATE INDEX IF NOT EXISTS idx_event_src_ip     ON event (src_ip);
+CREATE INDEX IF NOT EXISTS idx_event_username   ON event (username);
+
+-- move the legacy messages into the events
+INSERT INTO event (created_at, type, session, protocol, src_ip, username, password, command, script, decoded)
+SELECT
+	created_at,
+	CASE
+		WHEN command IS NOT NULL THEN 'command'
+		WHEN password IS NOT NULL THEN 'auth.password'
+		ELSE 'connect'
+	END,
+	session, service, client_ip, username, password, command, script, decoded
+FROM message
+ORDER BY id;
+
+DROP INDEX IF EXISTS idx_message_service;
+DROP INDEX IF EXISTS idx_message_username;
+DROP INDEX IF EXISTS idx_message_client_ip;
+DROP INDEX IF EXISTS idx_message_session;
+DROP TABLE IF EXISTS message;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_event_dst_ip;
+DROP INDEX IF EXISTS idx_event_dst_port;
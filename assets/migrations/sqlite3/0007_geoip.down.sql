@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_event_country;
+DROP INDEX IF EXISTS idx_event_asn;
+ALTER TABLE event DROP COLUMN country;
+ALTER TABLE event DROP COLUMN city;
+ALTER TABLE event DROP COLUMN asn;
+ALTER TABLE event DROP COLUMN org;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rollup_field;
+DROP TABLE IF EXISTS rollup;
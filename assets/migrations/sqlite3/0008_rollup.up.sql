@@ -0,0 +1,14 @@
+-- the daily rollups of the events, the digest is the SHA-256 of the value
+CREATE TABLE IF NOT EXISTS rollup (
+	day        VARCHAR(10) NOT NULL,
+	service    VARCHAR(32) NOT NULL,
+	field      VARCHAR(32) NOT NULL,
+	digest     CHAR(64)    NOT NULL,
+	value      TEXT,
+	count      INTEGER NOT NULL DEFAULT 0,
+	first_seen TIMESTAMP,
+	last_seen  TIMESTAMP,
+	PRIMARY KEY (day, service, field, digest)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollup_field ON rollup (field, day);
@@ -0,0 +1,3 @@
+-- SQLite never enforces the length of VARCHAR, keep the version in line with the
+-- other dialects
+SELECT 1;
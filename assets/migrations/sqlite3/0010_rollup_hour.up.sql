@@ -0,0 +1,23 @@
+-- the hourly rollups of the events, the daily rollups before are kept at the
+-- first hour of the day
+CREATE TABLE IF NOT EXISTS rollup_hour (
+	hour       VARCHAR(13) NOT NULL,
+	service    VARCHAR(32) NOT NULL,
+	field      VARCHAR(32) NOT NULL,
+	digest     CHAR(64)    NOT NULL,
+	value      TEXT,
+	count      INTEGER NOT NULL DEFAULT 0,
+	first_seen TIMESTAMP,
+	last_seen  TIMESTAMP,
+	PRIMARY KEY (hour, service, field, digest)
+);
+
+INSERT INTO rollup_hour (hour, service, field, digest, value, count, first_seen, last_seen)
+SELECT day || 'T00', service, field, digest, value, count, first_seen, last_seen
+FROM rollup;
+
+DROP INDEX IF EXISTS idx_rollup_field;
+DROP TABLE IF EXISTS rollup;
+ALTER TABLE rollup_hour RENAME TO rollup;
+
+CREATE INDEX IF NOT EXISTS idx_rollup_field ON rollup (field, hour);
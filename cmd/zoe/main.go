@@ -1,10 +1,19 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
+	// embed the time zone database, the container image has no zoneinfo
+	_ "time/tzdata"
+
 	"github.com/cmj0121/zoe"
 )
 
 func main() {
 	agent := zoe.New()
-	agent.ParseAndRun()
+	if err := agent.ParseAndRun(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
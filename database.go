@@ -3,24 +3,27 @@ package zoe
 import (
 	"embed"
 	"fmt"
+	"path"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog/log"
 
 	"github.com/cmj0121/zoe/pkg/database"
 )
 
 var (
-	//go:embed assets/migrations/*.sql
+	//go:embed assets/migrations/*/*.sql
 	migrations embed.FS
 )
 
 // The persistence layer of the honeypot holding the access logs.
 type Database struct {
-	Driver string `name:"driver" help:"The database driver" default:"sqlite3"`
+	Driver string `name:"driver" help:"The database driver, one of sqlite3, postgres and mysql" default:"sqlite3"`
 	DSN    string `name:"dsn" help:"The data source name" default:"zoe.db"`
 }
 
@@ -28,16 +31,40 @@ func (db *Database) Init() {
 	database.Init(db.Driver, db.DSN)
 }
 
-// Migrate the database schema to the latest version.
+// Migrate the database schema to the latest version, each dialect owns the
+// separated migration set under the assets/migrations/<dialect>.
 func (db *Database) Migrate() error {
-	source, err := iofs.New(migrations, "assets/migrations")
+	store := database.Session()
+	if store == nil {
+		log.Warn().Msg("no database initialized, skip the migration")
+		return fmt.Errorf("no database initialized")
+	}
+
+	dialect := store.Dialect()
+	source, err := iofs.New(migrations, path.Join("assets/migrations", string(dialect)))
+	if err != nil {
+		log.Info().Str("dialect", string(dialect)).Msg("no migration files found")
+		return err
+	}
+
+	var driver migratedb.Driver
+	switch dialect {
+	case database.SQLite3:
+		driver, err = sqlite3.WithInstance(store.DB(), &sqlite3.Config{})
+	case database.Postgres:
+		driver, err = postgres.WithInstance(store.DB(), &postgres.Config{})
+	case database.MySQL:
+		driver, err = mysql.WithInstance(store.DB(), &mysql.Config{})
+	default:
+		err = fmt.Errorf("unsupported dialect: %s", dialect)
+	}
+
 	if err != nil {
-		log.Info().Msg("no migration files found")
+		log.Warn().Err(err).Msg("failed to create the migration driver")
 		return err
 	}
 
-	database := fmt.Sprintf("%s://%s", db.Driver, db.DSN)
-	m, err := migrate.NewWithSourceInstance("iofs", source, database)
+	m, err := migrate.NewWithInstance("iofs", source, string(dialect), driver)
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to create the migration instance")
 		return err
@@ -47,7 +74,8 @@ func (db *Database) Migrate() error {
 	case nil, migrate.ErrNoChange:
 		log.Debug().Msg("migrate the database schema")
 	default:
-		log.Warn().Err(err).Msg("failed to migrate the database schema")
+		log.Error().Err(err).Msg("failed to migrate the database schema")
+		return err
 	}
 
 	return nil
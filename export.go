@@ -0,0 +1,180 @@
+package zoe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/blocklist"
+	"github.com/cmj0121/zoe/pkg/intel"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The options to export the blocklist of the source IPs seen in the honeypot.
+type ExportBlocklist struct {
+	Format      string        `short:"f" enum:"text,cidr,nftables,ipset,fail2ban,json" default:"text" help:"The format of the blocklist, one of text, cidr, nftables, ipset, fail2ban and json"`
+	Output      string        `short:"o" help:"The file to write the blocklist, default is the stdout"`
+	Last        time.Duration `default:"24h" help:"The time window until now, ignored when --since is set"`
+	Since       time.Time     `help:"The start of the time window, in RFC 3339"`
+	Until       time.Time     `help:"The end of the time window, in RFC 3339, default is now"`
+	MinAttempts int           `help:"The minimum number of the authentication attempts"`
+	LoggedIn    bool          `help:"Only the IPs logged in the honeypot"`
+	Commands    bool          `help:"Only the IPs executed the commands"`
+	Allow       []string      `help:"The IPs or the CIDRs excluded, besides the allowlist of the configuration"`
+	Name        string        `default:"zoe" help:"The name of the nftables table and the prefix of the ipset sets"`
+	Prefix4     int           `name:"prefix4" help:"Aggregate the IPv4 to the prefix length, like 24"`
+	Prefix6     int           `name:"prefix6" help:"Aggregate the IPv6 to the prefix length, like 64"`
+}
+
+// Export the blocklist once and exit.
+func (z *Zoe) RunExportBlocklist() error {
+	if err := z.prologue(); err != nil {
+		return err
+	}
+	defer z.epilogue()
+
+	z.Blocklist.Init()
+
+	opts := z.Export.Blocklist
+	filter := types.BlocklistFilter{
+		Since:       opts.Since,
+		Until:       opts.Until,
+		MinAttempts: opts.MinAttempts,
+		LoggedIn:    opts.LoggedIn,
+		Commands:    opts.Commands,
+	}
+
+	if filter.Until.IsZero() {
+		filter.Until = time.Now()
+	}
+	if filter.Since.IsZero() {
+		filter.Since = filter.Until.Add(-opts.Last)
+	}
+
+	allowlist, err := types.ParseAllowlist(opts.Allow...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to parse the allowlist")
+		return err
+	}
+	filter.Allowlist = append(blocklist.Allowlist(), allowlist...)
+
+	ips, err := types.Blocklist(context.Background(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to query the blocklist")
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create the output file")
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	err = blocklist.Write(w, ips, blocklist.Options{
+		Format:  blocklist.Format(opts.Format),
+		Name:    opts.Name,
+		Prefix4: opts.Prefix4,
+		Prefix6: opts.Prefix6,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write the blocklist")
+		return err
+	}
+
+	log.Info().Int("ips", len(ips)).Str("format", opts.Format).Msg("exported the blocklist")
+	return nil
+}
+
+// The options to export the observed indicators as the threat intelligence.
+type ExportIntel struct {
+	Group    string        `enum:"day,session" default:"day" help:"Group the observations per day or per session"`
+	Output   string        `short:"o" help:"The file to write the export, default is the stdout"`
+	Last     time.Duration `default:"24h" help:"The time window until now, ignored when --since is set"`
+	Since    time.Time     `help:"The start of the time window, in RFC 3339"`
+	Until    time.Time     `help:"The end of the time window, in RFC 3339, default is now"`
+	Validate bool          `help:"Validate the STIX bundle against the embedded STIX 2.1 JSON schemas before writing"`
+}
+
+// the format of the threat intelligence export.
+type exportFormat string
+
+const (
+	exportSTIX exportFormat = "stix"
+	exportMISP exportFormat = "misp"
+)
+
+// Export the observed indicators once and exit.
+func (z *Zoe) RunExportIntel(opts ExportIntel, format exportFormat) error {
+	if err := z.prologue(); err != nil {
+		return err
+	}
+	defer z.epilogue()
+
+	r := types.Range{Since: opts.Since, Until: opts.Until}
+	if r.Until.IsZero() {
+		r.Until = time.Now()
+	}
+	if r.Since.IsZero() {
+		r.Since = r.Until.Add(-opts.Last)
+	}
+
+	observations, err := intel.Observe(context.Background(), r, intel.Group(opts.Group))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to observe the indicators")
+		return err
+	}
+
+	var export any
+	switch format {
+	case exportSTIX:
+		export = intel.STIX(observations)
+	case exportMISP:
+		export = intel.MISP(observations)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal the export")
+		return err
+	}
+
+	if opts.Validate && format == exportSTIX {
+		if err := intel.Validate(data); err != nil {
+			log.Error().Err(err).Msg("invalid STIX bundle")
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.Output != "" {
+		file, err := os.Create(opts.Output)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create the output file")
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	if _, err := fmt.Fprintln(w, string(data)); err != nil {
+		log.Error().Err(err).Msg("failed to write the export")
+		return err
+	}
+
+	log.Info().Int("observations", len(observations)).Str("format", string(format)).Msg("exported the indicators")
+	return nil
+}
@@ -0,0 +1,413 @@
+// The alert notifications of the interesting events by the rules.
+//
+// The rules are matched against the published events before they are persisted,
+// and the matched event is sent to the webhooks as the templated JSON body right
+// away, even when the database is down. The webhooks are
+// delivered in the background with the retry, the backoff and the rate limit,
+// so the honeypots are never blocked by the slow receiver.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+const (
+	// The buffer size of the subscribed events.
+	subscribeSize = 1024
+	// The maximum number of the tracked IPs and cooldowns, reset when exceeded.
+	maxTracked = 65536
+)
+
+// The trigger of the rule.
+type Trigger string
+
+const (
+	// The client logged in the honeypot by the password.
+	TriggerLogin Trigger = "login"
+	// The client downloads or uploads the file into the honeypot.
+	TriggerDownload Trigger = "download"
+	// The client executes the command matched the pattern.
+	TriggerCommand Trigger = "command"
+	// The never-seen IP exceeds the threshold of the authentication attempts.
+	TriggerNewIP Trigger = "new-ip"
+)
+
+// The rule that fires the alert when the event matches.
+type Rule struct {
+	Name string  `mapstructure:"name"`
+	On   Trigger `mapstructure:"on"`
+	// The regular expression of the command (command) or the URL (download).
+	Pattern string `mapstructure:"pattern"`
+	// The number of the authentication attempts of the never-seen IP (new-ip).
+	Threshold int `mapstructure:"threshold"`
+	// The minimum interval of the alerts of the rule from the same source IP.
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// The names of the webhooks, all the webhooks when empty.
+	Webhooks []string `mapstructure:"webhooks"`
+
+	pattern *regexp.Regexp
+}
+
+// The alert sent to the webhooks, also the data of the body template.
+type Notification struct {
+	Rule     string       `json:"rule"`
+	Trigger  Trigger      `json:"trigger"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Time     time.Time    `json:"time"`
+	Attempts int          `json:"attempts,omitempty"`
+	Event    *types.Event `json:"event"`
+}
+
+// The alert rules and the webhooks, loaded from the configuration.
+type Alert struct {
+	Webhooks []*Webhook `kong:"-"`
+	Rules    []*Rule    `kong:"-"`
+
+	// the state of the new-ip and the cooldown
+	seen      map[string]*seenIP
+	cooldowns map[string]time.Time
+}
+
+// the never-seen IP tracked since the first event.
+type seenIP struct {
+	first    time.Time
+	attempts int
+	// the IP has the events before tracked, checked once
+	checked bool
+	known   bool
+}
+
+// New creates the alert without any rule.
+func New() *Alert {
+	return &Alert{}
+}
+
+// Init the rules and the webhooks, the invalid rule or webhook is skipped.
+func (a *Alert) Init() {
+	if a == nil {
+		return
+	}
+
+	webhooks := make([]*Webhook, 0, len(a.Webhooks))
+	for _, webhook := range a.Webhooks {
+		if err := webhook.init(); err != nil {
+			log.Warn().Err(err).Str("webhook", webhook.Name).Msg("failed to init the webhook, skip it")
+			continue
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+	a.Webhooks = webhooks
+
+	rules := make([]*Rule, 0, len(a.Rules))
+	for _, rule := range a.Rules {
+		if err := a.initRule(rule); err != nil {
+			log.Warn().Err(err).Str("rule", rule.Name).Msg("failed to init the alert rule, skip it")
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+	a.Rules = rules
+
+	a.seen = map[string]*seenIP{}
+	a.cooldowns = map[string]time.Time{}
+	log.Info().Int("rules", len(a.Rules)).Int("webhooks", len(a.Webhooks)).Msg("init the alert rules")
+}
+
+// Run the rules against the published events and deliver the alerts until the
+// context is done.
+func (a *Alert) Run(ctx context.Context) {
+	if a == nil || len(a.Rules) == 0 || len(a.Webhooks) == 0 {
+		log.Info().Msg("no alert rule or webhook, skip the alerts")
+		return
+	}
+
+	// tap the events before persisted, so the alerts are fired even when the
+	// database is down
+	sub := pipeline.Tap(subscribeSize)
+	a.serve(ctx, sub)
+}
+
+// match the events of the subscriber and deliver the alerts until the context is
+// done, the subscriber is closed after return.
+func (a *Alert) serve(ctx context.Context, sub *pipeline.Subscriber) {
+	defer pipeline.Unsubscribe(sub)
+
+	for _, webhook := range a.Webhooks {
+		go webhook.run(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			// the tapped event is not decoded yet
+			event.Decode()
+			a.handle(ctx, event)
+		}
+	}
+}
+
+// Get the webhook by the name, nil when not found.
+func (a *Alert) Webhook(name string) *Webhook {
+	for _, webhook := range a.Webhooks {
+		if webhook.Name == name {
+			return webhook
+		}
+	}
+
+	return nil
+}
+
+// check the rule and compile the pattern.
+func (a *Alert) initRule(rule *Rule) error {
+	switch rule.On {
+	case TriggerLogin:
+	case TriggerDownload, TriggerCommand:
+		if rule.Pattern == "" {
+			break
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		rule.pattern = pattern
+	case TriggerNewIP:
+		if rule.Threshold <= 0 {
+			rule.Threshold = 1
+		}
+	default:
+		return fmt.Errorf("unsupported trigger: %q", rule.On)
+	}
+
+	if rule.Name == "" {
+		rule.Name = string(rule.On)
+	}
+
+	for _, name := range rule.Webhooks {
+		if a.Webhook(name) == nil {
+			return fmt.Errorf("unknown webhook: %q", name)
+		}
+	}
+
+	return nil
+}
+
+// match the event against all the rules and enqueue the alerts.
+func (a *Alert) handle(ctx context.Context, event *types.Event) {
+	attempts := a.track(event)
+
+	for _, rule := range a.Rules {
+		notification := a.match(ctx, rule, event, attempts)
+		if notification == nil || a.cooling(rule, event) {
+			continue
+		}
+
+		log.Info().Str("rule", rule.Name).Str("src_ip", event.SrcIP).Msg("fire the alert")
+		for _, webhook := range a.Webhooks {
+			if len(rule.Webhooks) == 0 || slices.Contains(rule.Webhooks, webhook.Name) {
+				webhook.enqueue(notification)
+			}
+		}
+	}
+}
+
+// match the event against the rule, nil when not matched.
+func (a *Alert) match(ctx context.Context, rule *Rule, event *types.Event, attempts int) *Notification {
+	var text string
+
+	switch rule.On {
+	case TriggerLogin:
+		if event.Type != types.EventAuthPassword || event.Payload["success"] != true {
+			return nil
+		}
+
+		text = fmt.Sprintf("login as %s with the password %q", deref(event.Username), deref(event.Password))
+	case TriggerDownload:
+		if event.Type != types.EventDownload && event.Type != types.EventUpload {
+			return nil
+		}
+
+		url, _ := event.Payload["url"].(string)
+		name, _ := event.Payload["filename"].(string)
+		if rule.pattern != nil && !rule.pattern.MatchString(url) && !rule.pattern.MatchString(name) {
+			return nil
+		}
+
+		text = fmt.Sprintf("%s %s", event.Type, firstNonEmpty(url, name))
+	case TriggerCommand:
+		if event.Type != types.EventCommand || event.Command == nil {
+			return nil
+		}
+
+		decoded := event.Deobfuscated()
+		if rule.pattern != nil && !rule.pattern.MatchString(*event.Command) && (decoded == "" || !rule.pattern.MatchString(decoded)) {
+			return nil
+		}
+
+		text = fmt.Sprintf("command %q", *event.Command)
+		if decoded != "" {
+			text += fmt.Sprintf(" decoded as %q", decoded)
+		}
+	case TriggerNewIP:
+		if attempts != rule.Threshold || !a.unseen(ctx, event) {
+			return nil
+		}
+
+		text = fmt.Sprintf("never-seen IP tried %d authentication attempts", attempts)
+	default:
+		return nil
+	}
+
+	return &Notification{
+		Rule:     rule.Name,
+		Trigger:  rule.On,
+		Title:    fmt.Sprintf("[zoe] %s", rule.Name),
+		Text:     fmt.Sprintf("%s from %s on %s", text, source(event), event.Sensor),
+		Time:     event.CreatedAt,
+		Attempts: attempts,
+		Event:    event,
+	}
+}
+
+// Get the sample notification of the successful login from the documentation IP,
+// used to test the webhooks.
+func Sample() *Notification {
+	username, password := "root", "123456"
+
+	event := &types.Event{
+		CreatedAt: time.Now().UTC(),
+		Type:      types.EventAuthPassword,
+		Sensor:    "zoe",
+		Protocol:  "ssh",
+		SrcIP:     "192.0.2.1",
+		SrcPort:   54321,
+		Username:  &username,
+		Password:  &password,
+		Payload:   map[string]any{"success": true},
+	}
+
+	return &Notification{
+		Rule:    "test",
+		Trigger: TriggerLogin,
+		Title:   "[zoe] test",
+		Text:    fmt.Sprintf("the test alert: login as %s with the password %q from %s", username, password, event.SrcIP),
+		Time:    event.CreatedAt,
+		Event:   event,
+	}
+}
+
+// track the source IP since the first event, and get the number of the
+// authentication attempts of the IP when the event is the attempt.
+func (a *Alert) track(event *types.Event) int {
+	if len(a.seen) >= maxTracked {
+		log.Debug().Int("tracked", len(a.seen)).Msg("too many tracked IPs, reset")
+		clear(a.seen)
+	}
+
+	seen, ok := a.seen[event.SrcIP]
+	if !ok {
+		seen = &seenIP{first: event.CreatedAt}
+		a.seen[event.SrcIP] = seen
+	}
+
+	switch {
+	case event.Type != types.EventAuthPassword && event.Type != types.EventAuthPublicKey:
+		return 0
+	case event.Payload["escalate"] == true:
+		// the credential tried in the shell, like sudo
+		return 0
+	}
+
+	seen.attempts++
+	return seen.attempts
+}
+
+// check the source IP of the event has no event before it is tracked, only
+// checked once per IP.
+func (a *Alert) unseen(ctx context.Context, event *types.Event) bool {
+	seen, ok := a.seen[event.SrcIP]
+	switch {
+	case !ok:
+		return false
+	case seen.checked:
+		return !seen.known
+	}
+
+	page, err := types.QueryEvents(ctx, types.EventFilter{ClientIP: event.SrcIP, Until: seen.first, Limit: 1})
+	if err != nil {
+		log.Warn().Err(err).Str("src_ip", event.SrcIP).Msg("failed to query the events of the IP")
+		return false
+	}
+
+	seen.checked = true
+	seen.known = len(page.Events) > 0
+	return !seen.known
+}
+
+// check the rule is cooling down for the source IP of the event, and start the
+// cooldown when not.
+func (a *Alert) cooling(rule *Rule, event *types.Event) bool {
+	if rule.Cooldown <= 0 {
+		return false
+	}
+
+	if len(a.cooldowns) >= maxTracked {
+		clear(a.cooldowns)
+	}
+
+	key := rule.Name + "/" + event.SrcIP
+	if last, ok := a.cooldowns[key]; ok && event.CreatedAt.Sub(last) < rule.Cooldown {
+		return true
+	}
+
+	a.cooldowns[key] = event.CreatedAt
+	return false
+}
+
+// get the source of the event, the IP with the location when known.
+func source(event *types.Event) string {
+	switch {
+	case event.Country != "" && event.Org != "":
+		return fmt.Sprintf("%s (%s, AS%d %s)", event.SrcIP, event.Country, event.ASN, event.Org)
+	case event.Country != "":
+		return fmt.Sprintf("%s (%s)", event.SrcIP, event.Country)
+	default:
+		return event.SrcIP
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
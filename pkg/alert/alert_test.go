@@ -0,0 +1,191 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	database.Init("sqlite3", ":memory:")
+
+	source, err := iofs.New(os.DirFS("../../assets/migrations"), "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migration.Up(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestWebhookSend(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		retries  int
+		attempts int32
+		fail     bool
+	}{
+		{name: "ok", statuses: []int{http.StatusNoContent}, attempts: 1},
+		{name: "retry", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, retries: 3, attempts: 3},
+		{name: "exhausted", statuses: []int{http.StatusBadGateway}, retries: 2, attempts: 3, fail: true},
+		{name: "never retry", statuses: []int{http.StatusInternalServerError}, retries: -1, attempts: 1, fail: true},
+		{name: "client error", statuses: []int{http.StatusBadRequest}, retries: 3, attempts: 1, fail: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				index := int(attempts.Add(1)) - 1
+				w.WriteHeader(c.statuses[min(index, len(c.statuses)-1)])
+			}))
+			defer server.Close()
+
+			webhook := &Webhook{Name: c.name, URL: server.URL, Retries: c.retries, Backoff: time.Millisecond}
+			if err := webhook.init(); err != nil {
+				t.Fatalf("failed to init the webhook: %v", err)
+			}
+
+			err := webhook.Send(context.Background(), Sample())
+			switch {
+			case c.fail && err == nil:
+				t.Errorf("expect the failure")
+			case !c.fail && err != nil:
+				t.Errorf("expect no failure, got %v", err)
+			case attempts.Load() != c.attempts:
+				t.Errorf("expect %d attempts, got %d", c.attempts, attempts.Load())
+			}
+		})
+	}
+}
+
+func TestWebhookPreset(t *testing.T) {
+	cases := []struct {
+		preset Preset
+		key    string
+	}{
+		{preset: PresetJSON, key: "rule"},
+		{preset: PresetSlack, key: "text"},
+		{preset: PresetDiscord, key: "content"},
+		{preset: PresetTeams, key: "summary"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.preset), func(t *testing.T) {
+			bodies := make(chan map[string]any, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]any
+				data, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(data, &body); err != nil || r.Header.Get("X-Token") != "secret" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				bodies <- body
+			}))
+			defer server.Close()
+
+			webhook := &Webhook{Name: "test", URL: server.URL, Preset: c.preset, Headers: map[string]string{"X-Token": "secret"}}
+			if err := webhook.init(); err != nil {
+				t.Fatalf("failed to init the webhook: %v", err)
+			}
+
+			if err := webhook.Send(context.Background(), Sample()); err != nil {
+				t.Fatalf("failed to send the alert: %v", err)
+			}
+
+			if body := <-bodies; body[c.key] == nil {
+				t.Errorf("expect the %s in the body, got %v", c.key, body)
+			}
+		})
+	}
+}
+
+func TestAlert(t *testing.T) {
+	notifications := make(chan Notification, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		notifications <- notification
+	}))
+	defer server.Close()
+
+	a := New()
+	a.Webhooks = []*Webhook{{Name: "test", URL: server.URL}}
+	a.Rules = []*Rule{
+		{Name: "login", On: TriggerLogin},
+		{Name: "dropper", On: TriggerDownload, Pattern: `\.sh$`},
+		{Name: "miner", On: TriggerCommand, Pattern: `xmrig`, Cooldown: time.Hour},
+	}
+	a.Init()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := pipeline.Tap(subscribeSize)
+	go a.serve(ctx, sub)
+
+	username, password, command, miner := "root", "123456", "uname -a", "./xmrig -o pool"
+	events := []*types.Event{
+		{Type: types.EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password, Payload: map[string]any{"success": false}},
+		{Type: types.EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password, Payload: map[string]any{"success": true}},
+		{Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &command},
+		{Type: types.EventDownload, Protocol: "ssh", SrcIP: "192.0.2.1", Payload: map[string]any{"url": "http://203.0.113.1/x.bin"}},
+		{Type: types.EventDownload, Protocol: "ssh", SrcIP: "192.0.2.1", Payload: map[string]any{"url": "http://203.0.113.1/x.sh", "sha256": "abc"}},
+		{Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &miner},
+		// suppressed by the cooldown
+		{Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &miner},
+	}
+	for _, event := range events {
+		pipeline.Publish(event)
+	}
+
+	expect := []string{"login", "dropper", "miner"}
+	for _, rule := range expect {
+		select {
+		case notification := <-notifications:
+			if notification.Rule != rule || notification.Event == nil || notification.Event.SrcIP != "192.0.2.1" {
+				t.Errorf("expect the alert of %s, got %+v", rule, notification)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expect the alert of %s, got nothing", rule)
+		}
+	}
+
+	select {
+	case notification := <-notifications:
+		t.Errorf("expect no more alert, got %+v", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,276 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/metrics"
+)
+
+// The maximum backoff between the retries.
+const maxBackoff = time.Minute
+
+// The preset of the webhook body.
+type Preset string
+
+const (
+	// The notification as is, the default.
+	PresetJSON Preset = "json"
+	// The incoming webhook of Slack.
+	PresetSlack Preset = "slack"
+	// The webhook of Discord.
+	PresetDiscord Preset = "discord"
+	// The incoming webhook of Microsoft Teams, as the message card.
+	PresetTeams Preset = "teams"
+)
+
+// The body templates of the presets.
+var presets = map[Preset]string{
+	PresetJSON:    `{{ json . }}`,
+	PresetSlack:   `{"text": {{ json (printf "*%s*\n%s" .Title .Text) }}}`,
+	PresetDiscord: `{"username": "zoe", "content": {{ json (printf "**%s**\n%s" .Title .Text) }}}`,
+	PresetTeams:   `{"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": {{ json .Title }}, "title": {{ json .Title }}, "text": {{ json .Text }}}`,
+}
+
+// The HTTP webhook that receives the alerts.
+type Webhook struct {
+	Name string `mapstructure:"name"`
+	URL  string `mapstructure:"url"`
+	// The preset of the body, one of json (default), slack, discord and teams.
+	Preset Preset `mapstructure:"preset"`
+	// The text/template of the JSON body, overrides the preset.
+	Template string            `mapstructure:"template"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Timeout  time.Duration     `mapstructure:"timeout"`
+	// The number of the retries after the first attempt (default 3, -1 to never
+	// retry), and the first backoff doubled by each retry.
+	Retries int           `mapstructure:"retries"`
+	Backoff time.Duration `mapstructure:"backoff"`
+	// The maximum number of the alerts per minute (default 30), the excess alerts
+	// are dropped.
+	Rate int `mapstructure:"rate"`
+	// The maximum number of the queued alerts.
+	QueueSize int `mapstructure:"queue_size"`
+
+	body    *template.Template
+	client  *http.Client
+	queue   chan *Notification
+	limiter *limiter
+}
+
+// init the defaults and parse the body template.
+func (w *Webhook) init() error {
+	if w.URL == "" {
+		return fmt.Errorf("no webhook URL")
+	}
+	if w.Name == "" {
+		w.Name = w.URL
+	}
+
+	text := w.Template
+	if text == "" {
+		if w.Preset == "" {
+			w.Preset = PresetJSON
+		}
+
+		var ok bool
+		if text, ok = presets[w.Preset]; !ok {
+			return fmt.Errorf("unsupported preset: %q", w.Preset)
+		}
+	}
+
+	body, err := template.New(w.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	w.body = body
+
+	if w.Timeout <= 0 {
+		w.Timeout = 10 * time.Second
+	}
+	switch {
+	case w.Retries == 0:
+		w.Retries = 3
+	case w.Retries < 0:
+		w.Retries = 0
+	}
+	if w.Rate <= 0 {
+		w.Rate = 30
+	}
+	if w.Backoff <= 0 {
+		w.Backoff = time.Second
+	}
+	if w.QueueSize <= 0 {
+		w.QueueSize = 256
+	}
+
+	w.client = &http.Client{Timeout: w.Timeout}
+	w.queue = make(chan *Notification, w.QueueSize)
+	w.limiter = newLimiter(w.Rate, time.Minute)
+	return nil
+}
+
+// Send the notification with the retries, and get the last error.
+func (w *Webhook) Send(ctx context.Context, notification *Notification) error {
+	body, err := w.render(notification)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, after, err := w.post(ctx, body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+
+		// respect the Retry-After of the receiver
+		backoff = max(backoff, after)
+
+		log.Debug().Err(err).Str("webhook", w.Name).Dur("backoff", backoff).Msg("retry the webhook")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// enqueue the notification without blocking, dropped when rate limited or the
+// queue is full.
+func (w *Webhook) enqueue(notification *Notification) {
+	if !w.limiter.allow(time.Now()) {
+		metrics.Alerts.WithLabelValues(w.Name, "dropped").Inc()
+		log.Warn().Str("webhook", w.Name).Str("rule", notification.Rule).Msg("the webhook is rate limited, drop the alert")
+		return
+	}
+
+	select {
+	case w.queue <- notification:
+	default:
+		metrics.Alerts.WithLabelValues(w.Name, "dropped").Inc()
+		log.Warn().Str("webhook", w.Name).Str("rule", notification.Rule).Msg("the webhook queue is full, drop the alert")
+	}
+}
+
+// run the delivery of the queued notifications until the context is done.
+func (w *Webhook) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-w.queue:
+			switch err := w.Send(ctx, notification); err {
+			case nil:
+				metrics.Alerts.WithLabelValues(w.Name, "sent").Inc()
+				log.Debug().Str("webhook", w.Name).Str("rule", notification.Rule).Msg("sent the alert")
+			default:
+				metrics.Alerts.WithLabelValues(w.Name, "failed").Inc()
+				log.Warn().Err(err).Str("webhook", w.Name).Str("rule", notification.Rule).Msg("failed to send the alert")
+			}
+		}
+	}
+}
+
+// render the body of the notification, the body must be the valid JSON.
+func (w *Webhook) render(notification *Notification) ([]byte, error) {
+	var buff bytes.Buffer
+	if err := w.body.Execute(&buff, notification); err != nil {
+		return nil, fmt.Errorf("failed to render the template: %w", err)
+	}
+
+	if !json.Valid(buff.Bytes()) {
+		return nil, fmt.Errorf("the rendered body is not the valid JSON: %s", buff.String())
+	}
+
+	return buff.Bytes(), nil
+}
+
+// post the body once, and get whether to retry when failed by the network, the
+// rate limit or the server error, with the delay of the Retry-After header.
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zoe-alert")
+	for key, value := range w.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain the body to reuse the connection
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(message))
+	switch {
+	case resp.StatusCode < 300:
+		return false, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return true, min(time.Duration(max(seconds, 0))*time.Second, maxBackoff), err
+	default:
+		return false, 0, err
+	}
+}
+
+// the token bucket that allows the number of the events per the period.
+type limiter struct {
+	sync.Mutex
+
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newLimiter(count int, period time.Duration) *limiter {
+	return &limiter{
+		capacity: float64(count),
+		rate:     float64(count) / period.Seconds(),
+		tokens:   float64(count),
+	}
+}
+
+// check the event is allowed now, and take the token.
+func (l *limiter) allow(now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// encode the value as the JSON in the template.
+func toJSON(value any) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
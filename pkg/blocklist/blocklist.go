@@ -0,0 +1,304 @@
+// The IP blocklist feed exported for the firewalls.
+//
+// The source IPs seen in the honeypot are exported in the plain text, the
+// aggregated CIDRs, the nftables and the ipset sets, and the fail2ban log. The
+// own scanners in the allowlist are never exported.
+package blocklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The default allowlist, set by the configuration.
+var defaultAllowlist atomic.Pointer[[]netip.Prefix]
+
+// The format of the exported blocklist.
+type Format string
+
+const (
+	// One IP per line.
+	FormatText Format = "text"
+	// One aggregated CIDR per line.
+	FormatCIDR Format = "cidr"
+	// The nftables script that refreshes the interval sets, run by nft -f.
+	FormatNFTables Format = "nftables"
+	// The ipset script that refreshes the hash:net sets, run by ipset restore.
+	FormatIPSet Format = "ipset"
+	// The log line per IP, matched by the fail2ban filter.
+	FormatFail2Ban Format = "fail2ban"
+	// The JSON list of the IPs with the aggregates.
+	FormatJSON Format = "json"
+)
+
+// Get all the supported formats.
+func Formats() []Format {
+	return []Format{FormatText, FormatCIDR, FormatNFTables, FormatIPSet, FormatFail2Ban, FormatJSON}
+}
+
+// Get the MIME type of the format.
+func (f Format) MIME() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	default:
+		return "text/plain"
+	}
+}
+
+// The blocklist configuration.
+type Blocklist struct {
+	Allowlist []string `name:"allowlist" help:"The IPs or the CIDRs never exported in the blocklist, like the own scanners"`
+}
+
+// Parse the allowlist and use it as the default allowlist.
+func (b *Blocklist) Init() {
+	if b == nil || len(b.Allowlist) == 0 {
+		return
+	}
+
+	allowlist, err := types.ParseAllowlist(b.Allowlist...)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse the allowlist of the blocklist")
+		return
+	}
+
+	defaultAllowlist.Store(&allowlist)
+	log.Info().Int("size", len(allowlist)).Msg("load the allowlist of the blocklist")
+}
+
+// Get the default allowlist of the configuration.
+func Allowlist() []netip.Prefix {
+	if allowlist := defaultAllowlist.Load(); allowlist != nil {
+		return slices.Clone(*allowlist)
+	}
+
+	return nil
+}
+
+// The name of the nftables table and the ipset sets, never escaped in the script.
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,30}$`)
+
+// The options of the exported blocklist.
+type Options struct {
+	Format Format
+	// The name of the nftables table and the prefix of the ipset sets.
+	Name string
+	// The prefix length the IPv4 and IPv6 are aggregated to, 0 means the host.
+	Prefix4 int
+	Prefix6 int
+}
+
+// Validate the options, the name is written as-is in the nftables and the ipset
+// script and so only the letters, the digits, the underscores and the hyphens
+// are allowed. The empty name is the default zoe.
+func (o Options) Validate() error {
+	if o.Name != "" && !namePattern.MatchString(o.Name) {
+		return fmt.Errorf("invalid name %q: expect %s", o.Name, namePattern)
+	}
+
+	return nil
+}
+
+// Write the blocklist in the format.
+func Write(w io.Writer, blocklist []*types.BlockedIP, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if opts.Name == "" {
+		opts.Name = "zoe"
+	}
+
+	addrs := make([]netip.Addr, 0, len(blocklist))
+	for _, blocked := range blocklist {
+		addrs = append(addrs, blocked.IP)
+	}
+
+	switch opts.Format {
+	case FormatText, "":
+		for _, addr := range addrs {
+			if _, err := fmt.Fprintln(w, addr); err != nil {
+				return err
+			}
+		}
+	case FormatCIDR:
+		for _, prefix := range Aggregate(addrs, opts.Prefix4, opts.Prefix6) {
+			if _, err := fmt.Fprintln(w, prefix); err != nil {
+				return err
+			}
+		}
+	case FormatNFTables:
+		return writeNFTables(w, Aggregate(addrs, opts.Prefix4, opts.Prefix6), opts.Name)
+	case FormatIPSet:
+		return writeIPSet(w, Aggregate(addrs, opts.Prefix4, opts.Prefix6), opts.Name)
+	case FormatFail2Ban:
+		for _, blocked := range blocklist {
+			_, err := fmt.Fprintf(w, "%s zoe blocklist: host=%s attempts=%d logged_in=%t commands=%d\n",
+				blocked.LastSeen.UTC().Format(time.RFC3339), blocked.IP, blocked.Attempts, blocked.LoggedIn, blocked.Commands)
+			if err != nil {
+				return err
+			}
+		}
+	case FormatJSON:
+		if blocklist == nil {
+			blocklist = []*types.BlockedIP{}
+		}
+		return json.NewEncoder(w).Encode(blocklist)
+	default:
+		return fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+
+	return nil
+}
+
+// Aggregate the IPs into the minimal CIDRs. The IPs are masked to the prefix
+// length first when set, like 24 to block the whole /24 of the IPv4.
+func Aggregate(addrs []netip.Addr, prefix4, prefix6 int) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(addrs))
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			continue
+		}
+		addr = addr.Unmap()
+
+		bits := addr.BitLen()
+		switch {
+		case addr.Is4() && prefix4 > 0 && prefix4 < bits:
+			bits = prefix4
+		case addr.Is6() && prefix6 > 0 && prefix6 < bits:
+			bits = prefix6
+		}
+
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	// sorted by the address and then the shorter prefix, the container goes first
+	slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+		if order := a.Addr().Compare(b.Addr()); order != 0 {
+			return order
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	var merged []netip.Prefix
+	for _, prefix := range prefixes {
+		if last := len(merged) - 1; last >= 0 && merged[last].Overlaps(prefix) {
+			// contained by the previous prefix
+			continue
+		}
+
+		merged = append(merged, prefix)
+		// merge the siblings into the parent, until no more siblings
+		for len(merged) >= 2 {
+			a, b := merged[len(merged)-2], merged[len(merged)-1]
+			if a.Bits() != b.Bits() || a.Bits() == 0 || a.Addr().Is4() != b.Addr().Is4() {
+				break
+			}
+
+			parent, _ := a.Addr().Prefix(a.Bits() - 1)
+			if other, _ := b.Addr().Prefix(b.Bits() - 1); parent != other {
+				break
+			}
+
+			merged = append(merged[:len(merged)-2], parent)
+		}
+	}
+
+	return merged
+}
+
+// write the nftables script that refreshes the interval sets <name>_v4 and <name>_v6
+// in the inet table <name>.
+func writeNFTables(w io.Writer, prefixes []netip.Prefix, name string) error {
+	v4, v6 := split(prefixes)
+
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "#!/usr/sbin/nft -f\n")
+	fmt.Fprintf(&buff, "# the blocklist of the honeypot, %d IPv4 and %d IPv6 prefixes\n", len(v4), len(v6))
+	fmt.Fprintf(&buff, "add table inet %s\n", name)
+	for _, set := range []struct {
+		family   string
+		prefixes []netip.Prefix
+	}{{"ipv4", v4}, {"ipv6", v6}} {
+		setName := fmt.Sprintf("%s_%s", name, set.family[2:])
+		fmt.Fprintf(&buff, "add set inet %s %s { type %s_addr; flags interval; }\n", name, setName, set.family)
+		fmt.Fprintf(&buff, "flush set inet %s %s\n", name, setName)
+
+		for chunk := range slices.Chunk(set.prefixes, 256) {
+			fmt.Fprintf(&buff, "add element inet %s %s { %s }\n", name, setName, join(chunk))
+		}
+	}
+
+	_, err := buff.WriteTo(w)
+	return err
+}
+
+// write the ipset script that refreshes the hash:net sets <name>-v4 and <name>-v6.
+func writeIPSet(w io.Writer, prefixes []netip.Prefix, name string) error {
+	v4, v6 := split(prefixes)
+
+	var buff bytes.Buffer
+	for _, set := range []struct {
+		family   string
+		suffix   string
+		prefixes []netip.Prefix
+	}{{"inet", "v4", v4}, {"inet6", "v6", v6}} {
+		setName := fmt.Sprintf("%s-%s", name, set.suffix)
+		fmt.Fprintf(&buff, "create %s hash:net family %s -exist\n", setName, set.family)
+		fmt.Fprintf(&buff, "flush %s\n", setName)
+
+		for _, prefix := range set.prefixes {
+			fmt.Fprintf(&buff, "add %s %s -exist\n", setName, prefix)
+		}
+	}
+
+	_, err := buff.WriteTo(w)
+	return err
+}
+
+// split the prefixes into the IPv4 and the IPv6.
+func split(prefixes []netip.Prefix) (v4, v6 []netip.Prefix) {
+	for _, prefix := range prefixes {
+		switch prefix.Addr().Is4() {
+		case true:
+			v4 = append(v4, prefix)
+		default:
+			v6 = append(v6, prefix)
+		}
+	}
+
+	return v4, v6
+}
+
+// join the prefixes as the elements of the nftables set, the host prefix is the
+// plain address.
+func join(prefixes []netip.Prefix) string {
+	elements := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		switch prefix.IsSingleIP() {
+		case true:
+			elements = append(elements, prefix.Addr().String())
+		default:
+			elements = append(elements, prefix.String())
+		}
+	}
+
+	return strings.Join(elements, ", ")
+}
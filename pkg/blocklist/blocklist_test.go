@@ -0,0 +1,191 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+func TestAggregate(t *testing.T) {
+	var class []string
+	for index := 0; index < 256; index++ {
+		class = append(class, fmt.Sprintf("198.51.100.%d", index))
+	}
+
+	cases := []struct {
+		name     string
+		addrs    []string
+		prefix4  int
+		prefix6  int
+		prefixes []string
+	}{
+		{name: "empty"},
+		{name: "single", addrs: []string{"192.0.2.1"}, prefixes: []string{"192.0.2.1/32"}},
+		{name: "duplicated", addrs: []string{"192.0.2.1", "192.0.2.1"}, prefixes: []string{"192.0.2.1/32"}},
+		{name: "siblings", addrs: []string{"192.0.2.1", "192.0.2.0"}, prefixes: []string{"192.0.2.0/31"}},
+		{name: "cascade", addrs: []string{"192.0.2.3", "192.0.2.0", "192.0.2.2", "192.0.2.1"}, prefixes: []string{"192.0.2.0/30"}},
+		// adjacent but not in the same parent
+		{name: "not siblings", addrs: []string{"192.0.2.1", "192.0.2.2"}, prefixes: []string{"192.0.2.1/32", "192.0.2.2/32"}},
+		{name: "whole class", addrs: class, prefixes: []string{"198.51.100.0/24"}},
+		{name: "masked", addrs: []string{"192.0.2.1", "192.0.2.200"}, prefix4: 24, prefixes: []string{"192.0.2.0/24"}},
+		{name: "masked siblings", addrs: []string{"192.0.2.1", "192.0.3.1"}, prefix4: 24, prefixes: []string{"192.0.2.0/23"}},
+		{name: "host prefix", addrs: []string{"192.0.2.1"}, prefix4: 32, prefixes: []string{"192.0.2.1/32"}},
+		{name: "over prefix", addrs: []string{"192.0.2.1"}, prefix4: 40, prefixes: []string{"192.0.2.1/32"}},
+		// the IPv4-mapped IPv6 is the IPv4
+		{name: "mapped", addrs: []string{"::ffff:192.0.2.1", "192.0.2.0"}, prefixes: []string{"192.0.2.0/31"}},
+		{name: "ipv6", addrs: []string{"2001:db8::1", "2001:db8::"}, prefixes: []string{"2001:db8::/127"}},
+		{name: "ipv6 masked", addrs: []string{"2001:db8::1", "2001:db8::2", "2001:db8:0:1::1"}, prefix6: 64, prefixes: []string{"2001:db8::/63"}},
+		// the prefix of the other family is not applied
+		{name: "mixed", addrs: []string{"2001:db8::1", "192.0.2.1"}, prefix4: 24, prefixes: []string{"192.0.2.0/24", "2001:db8::1/128"}},
+		// never merged across the families
+		{name: "boundary", addrs: []string{"255.255.255.255", "::"}, prefixes: []string{"255.255.255.255/32", "::/128"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var addrs []netip.Addr
+			for _, addr := range c.addrs {
+				addrs = append(addrs, netip.MustParseAddr(addr))
+			}
+
+			var prefixes []string
+			for _, prefix := range Aggregate(addrs, c.prefix4, c.prefix6) {
+				prefixes = append(prefixes, prefix.String())
+			}
+
+			if !reflect.DeepEqual(prefixes, c.prefixes) {
+				t.Errorf("expect %v, got %v", c.prefixes, prefixes)
+			}
+		})
+	}
+}
+
+func TestAggregateInvalid(t *testing.T) {
+	prefixes := Aggregate([]netip.Addr{{}, netip.MustParseAddr("192.0.2.1")}, 0, 0)
+	if len(prefixes) != 1 || prefixes[0].String() != "192.0.2.1/32" {
+		t.Errorf("expect the invalid address skipped, got %v", prefixes)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	blocklist := []*types.BlockedIP{
+		{IP: netip.MustParseAddr("192.0.2.0"), Attempts: 3, LastSeen: seen},
+		{IP: netip.MustParseAddr("192.0.2.1"), Attempts: 1, LoggedIn: true, Commands: 2, LastSeen: seen},
+		{IP: netip.MustParseAddr("2001:db8::1"), LastSeen: seen},
+	}
+
+	cases := []struct {
+		opts   Options
+		expect string
+	}{
+		{opts: Options{}, expect: "192.0.2.0\n192.0.2.1\n2001:db8::1\n"},
+		{opts: Options{Format: FormatCIDR}, expect: "192.0.2.0/31\n2001:db8::1/128\n"},
+		{opts: Options{Format: FormatCIDR, Prefix6: 48}, expect: "192.0.2.0/31\n2001:db8::/48\n"},
+		{
+			opts: Options{Format: FormatNFTables, Name: "honeypot"},
+			expect: "#!/usr/sbin/nft -f\n" +
+				"# the blocklist of the honeypot, 1 IPv4 and 1 IPv6 prefixes\n" +
+				"add table inet honeypot\n" +
+				"add set inet honeypot honeypot_v4 { type ipv4_addr; flags interval; }\n" +
+				"flush set inet honeypot honeypot_v4\n" +
+				"add element inet honeypot honeypot_v4 { 192.0.2.0/31 }\n" +
+				"add set inet honeypot honeypot_v6 { type ipv6_addr; flags interval; }\n" +
+				"flush set inet honeypot honeypot_v6\n" +
+				"add element inet honeypot honeypot_v6 { 2001:db8::1 }\n",
+		},
+		{
+			opts: Options{Format: FormatIPSet},
+			expect: "create zoe-v4 hash:net family inet -exist\n" +
+				"flush zoe-v4\n" +
+				"add zoe-v4 192.0.2.0/31 -exist\n" +
+				"create zoe-v6 hash:net family inet6 -exist\n" +
+				"flush zoe-v6\n" +
+				"add zoe-v6 2001:db8::1/128 -exist\n",
+		},
+		{
+			opts: Options{Format: FormatFail2Ban},
+			expect: "2024-01-02T03:04:05Z zoe blocklist: host=192.0.2.0 attempts=3 logged_in=false commands=0\n" +
+				"2024-01-02T03:04:05Z zoe blocklist: host=192.0.2.1 attempts=1 logged_in=true commands=2\n" +
+				"2024-01-02T03:04:05Z zoe blocklist: host=2001:db8::1 attempts=0 logged_in=false commands=0\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.opts.Format), func(t *testing.T) {
+			var builder strings.Builder
+			if err := Write(&builder, blocklist, c.opts); err != nil {
+				t.Fatalf("failed to write the blocklist: %v", err)
+			}
+
+			if builder.String() != c.expect {
+				t.Errorf("expect\n%s\ngot\n%s", c.expect, builder.String())
+			}
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	cases := map[Format]string{
+		FormatText: "",
+		FormatJSON: "[]\n",
+		FormatIPSet: "create zoe-v4 hash:net family inet -exist\nflush zoe-v4\n" +
+			"create zoe-v6 hash:net family inet6 -exist\nflush zoe-v6\n",
+	}
+
+	for format, expect := range cases {
+		var builder strings.Builder
+		if err := Write(&builder, nil, Options{Format: format}); err != nil {
+			t.Fatalf("failed to write the %s blocklist: %v", format, err)
+		}
+
+		if builder.String() != expect {
+			t.Errorf("expect %q of %s, got %q", expect, format, builder.String())
+		}
+	}
+
+	if err := Write(&strings.Builder{}, nil, Options{Format: "pf"}); err == nil {
+		t.Errorf("expect the unsupported format rejected")
+	}
+}
+
+func TestWriteName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "", valid: true},
+		{name: "zoe", valid: true},
+		{name: "honeypot_v2-edge", valid: true},
+		{name: strings.Repeat("x", 31), valid: true},
+		{name: strings.Repeat("x", 32)},
+		{name: "2zoe"},
+		{name: "_zoe"},
+		{name: "x\nflush ruleset\n"},
+		{name: "x; flush ruleset"},
+		{name: "x y"},
+		{name: "x{}"},
+	}
+
+	for _, c := range cases {
+		if err := (Options{Name: c.name}).Validate(); (err == nil) != c.valid {
+			t.Errorf("expect the name %q valid=%t, got %v", c.name, c.valid, err)
+		}
+
+		for _, format := range []Format{FormatNFTables, FormatIPSet} {
+			var builder strings.Builder
+			err := Write(&builder, nil, Options{Format: format, Name: c.name})
+			switch {
+			case c.valid && err != nil:
+				t.Errorf("expect the %s of the name %q written, got %v", format, c.name, err)
+			case !c.valid && (err == nil || builder.Len() > 0):
+				t.Errorf("expect the %s of the name %q rejected, got %q", format, c.name, builder.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	once         sync.Once
+	defaultStore Store
+)
+
+// The store that persists the records of the honeypot. The queries are written in
+// the ? placeholders and rebound to the dialect of the driver before executed.
+type Store interface {
+	// Get the dialect of the underlying database.
+	Dialect() Dialect
+	// Get the raw database handler, like for the schema migration.
+	DB() *sql.DB
+
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error)
+
+	Close() error
+}
+
+// The executor that runs the statement, both the store and the transaction are.
+type Executor interface {
+	Dialect() Dialect
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Open the store by the driver and the data source name, the driver is one of the
+// sqlite3, postgres and mysql.
+func Open(driver, dsn string) (Store, error) {
+	dialect, err := LookupDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dialect {
+	case MySQL:
+		// always parse the DATETIME into time.Time, and the migrations need the
+		// multiple statements in one query
+		config, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ParseTime = true
+		config.MultiStatements = true
+		dsn = config.FormatDSN()
+	}
+
+	db, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect == SQLite3 && (strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")) {
+		// each connection owns the separated in-memory database
+		db.SetMaxOpenConns(1)
+	}
+
+	return &store{db: db, dialect: dialect}, nil
+}
+
+// Init the default store used by the honeypot, only the first call takes effect.
+// The DSN is never logged, it may carry the password of the database.
+func Init(driver, dsn string) {
+	once.Do(func() {
+		store, err := Open(driver, dsn)
+		if err != nil {
+			log.Warn().Err(err).Str("driver", driver).Msg("failed to open the database")
+			return
+		}
+
+		defaultStore = store
+		log.Info().Str("driver", driver).Msg("open the database")
+	})
+}
+
+// Get the default store, nil if not initialized.
+func Session() Store {
+	return defaultStore
+}
+
+// The store backed by the database/sql.
+type store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (s *store) Dialect() Dialect {
+	return s.dialect
+}
+
+func (s *store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *store) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.dialect.Rebind(query), args...)
+}
+
+func (s *store) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.dialect.Rebind(query), args...)
+}
+
+func (s *store) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.dialect.Rebind(query), args...)
+}
+
+func (s *store) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, dialect: s.dialect}, nil
+}
+
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// The transaction of the store, the queries are rebound as the store does.
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+func (tx *Tx) Dialect() Dialect {
+	return tx.dialect
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.Rebind(query), args...)
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The SQL dialect of the supported database, the value is the name of the
+// registered database/sql driver.
+type Dialect string
+
+const (
+	SQLite3  Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+)
+
+// Get the dialect by the driver name, the common aliases are accepted.
+func LookupDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "sqlite3", "sqlite":
+		return SQLite3, nil
+	case "postgres", "postgresql", "pg":
+		return Postgres, nil
+	case "mysql", "mariadb":
+		return MySQL, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// Rebind the ? placeholders in the query to the placeholders of the dialect, the
+// question marks inside the quoted strings are kept as is.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var builder strings.Builder
+	var quote rune
+	count := 0
+
+	for _, ch := range query {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			count++
+			builder.WriteString("$" + strconv.Itoa(count))
+			continue
+		}
+
+		builder.WriteRune(ch)
+	}
+
+	return builder.String()
+}
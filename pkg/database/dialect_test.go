@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestLookupDialect(t *testing.T) {
+	cases := []struct {
+		driver  string
+		dialect Dialect
+		err     bool
+	}{
+		{driver: "sqlite3", dialect: SQLite3},
+		{driver: "SQLite", dialect: SQLite3},
+		{driver: "postgresql", dialect: Postgres},
+		{driver: "pg", dialect: Postgres},
+		{driver: "mariadb", dialect: MySQL},
+		{driver: "oracle", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.driver, func(t *testing.T) {
+			dialect, err := LookupDialect(c.driver)
+			switch {
+			case c.err && err == nil:
+				t.Errorf("expect the error of %q", c.driver)
+			case !c.err && dialect != c.dialect:
+				t.Errorf("expect %q, got %q (%v)", c.dialect, dialect, err)
+			}
+		})
+	}
+}
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		dialect Dialect
+		query   string
+		expect  string
+	}{
+		{dialect: SQLite3, query: "SELECT * FROM event WHERE id = ?", expect: "SELECT * FROM event WHERE id = ?"},
+		{dialect: MySQL, query: "SELECT * FROM event WHERE id = ?", expect: "SELECT * FROM event WHERE id = ?"},
+		{dialect: Postgres, query: "SELECT 1", expect: "SELECT 1"},
+		{dialect: Postgres, query: "SELECT * FROM event WHERE id = ?", expect: "SELECT * FROM event WHERE id = $1"},
+		{dialect: Postgres, query: "INSERT INTO t (a, b, c) VALUES (?, ?, ?)", expect: "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)"},
+		{dialect: Postgres, query: "SELECT '?' || ? FROM t WHERE a = ?", expect: "SELECT '?' || $1 FROM t WHERE a = $2"},
+		{dialect: Postgres, query: `SELECT "a?b" FROM t WHERE c LIKE 'x?%' AND d = ?`, expect: `SELECT "a?b" FROM t WHERE c LIKE 'x?%' AND d = $1`},
+		{dialect: Postgres, query: "SELECT ? WHERE a = 'it''s ?' AND b = ?", expect: "SELECT $1 WHERE a = 'it''s ?' AND b = $2"},
+		{dialect: Postgres, query: "UPDATE t SET v = '日本?' WHERE k = ?", expect: "UPDATE t SET v = '日本?' WHERE k = $1"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.dialect)+"/"+c.query, func(t *testing.T) {
+			if query := c.dialect.Rebind(c.query); query != c.expect {
+				t.Errorf("expect %q, got %q", c.expect, query)
+			}
+		})
+	}
+}
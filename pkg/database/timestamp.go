@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The timestamp scanned from the aggregated column, like MIN(created_at). The
+// SQLite3 returns the aggregated timestamp as the text instead of time.Time.
+type Timestamp struct {
+	time.Time
+}
+
+func (t *Timestamp) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	default:
+		return fmt.Errorf("unsupported timestamp: %T", value)
+	}
+}
+
+// parse the text by the formats which the SQLite3 driver accepts.
+func (t *Timestamp) parse(text string) error {
+	text = strings.TrimSuffix(text, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if parsed, err := time.ParseInLocation(format, text, time.UTC); err == nil {
+			t.Time = parsed.UTC()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid timestamp: %s", text)
+}
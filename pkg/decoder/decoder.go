@@ -0,0 +1,206 @@
+// The decoder that reveals the obfuscated commands captured by the honeypot.
+//
+// The attackers usually hide the real payload behind the encodings, like
+// echo ... | base64 -d | sh, printf '\x..' or $'\NNN', the decoder recursively
+// decodes the common obfuscations and returns what is really executed.
+package decoder
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The maximum rounds to decode the nested obfuscations.
+const maxDepth = 8
+
+// Decode the obfuscated command recursively, return the decoded form and whether
+// anything has been decoded.
+func Decode(command string) (string, bool) {
+	decoded := command
+	for depth := 0; depth < maxDepth; depth++ {
+		next := decodeOnce(decoded)
+		if next == decoded {
+			break
+		}
+
+		decoded = next
+	}
+
+	return decoded, decoded != command
+}
+
+// decode the command by a single round, the statements are decoded separately and
+// joined by the original separators.
+func decodeOnce(command string) string {
+	var builder strings.Builder
+	for _, stmt := range split(command, statementSeparators) {
+		text := strings.TrimSpace(stmt.text)
+		if decoded := decodeStatement(text); decoded != text {
+			// keep the blanks around the statement
+			index := strings.Index(stmt.text, text)
+			text = stmt.text[:index] + decoded + stmt.text[index+len(text):]
+		} else {
+			text = stmt.text
+		}
+
+		builder.WriteString(text)
+		builder.WriteString(stmt.sep)
+	}
+
+	return builder.String()
+}
+
+// decode the single statement, the pipeline that produces the payload and then
+// decodes it by the filters is replaced by the decoded payload.
+func decodeStatement(text string) string {
+	text = decodeSubstitutions(text)
+
+	stages := split(text, pipeSeparators)
+	args, redirects := redirections(words(stages[0].text))
+	payload, decoded, filter, ok := source(args)
+	if !ok {
+		return decodeQuoted(text)
+	}
+	// the ANSI-C quoted words are already decoded by the lexer
+	decoded = decoded || strings.Contains(stages[0].text, "$'")
+
+	if filter != nil {
+		// the here-string is decoded by the command itself, like base64 -d <<< ...
+		if payload, ok = filter(payload); !ok {
+			return text
+		}
+		decoded = true
+	}
+
+	for index, stage := range stages[1:] {
+		args, redirect := redirections(words(stage.text))
+		if len(args) > 0 && isShell(args[0]) {
+			// the payload is executed by the shell
+			return reveal(text, payload, "")
+		}
+
+		redirects = append(redirects, redirect...)
+		filter, ok := filters(args)
+		if !ok {
+			if !decoded {
+				return text
+			}
+
+			rest := strings.TrimSpace(joinStages(stages[index+1:]))
+			return reveal(text, payload, "echo %s | "+rest)
+		}
+
+		if payload, ok = filter(payload); !ok {
+			return text
+		}
+		decoded = true
+	}
+
+	if !decoded {
+		return text
+	}
+
+	return reveal(text, payload, strings.Join(append([]string{"echo %s"}, redirects...), " "))
+}
+
+// reveal the decoded payload in the layout, the payload is kept as is without the
+// layout. The original text is returned when the payload is not readable.
+func reveal(text, payload, layout string) string {
+	payload = strings.TrimRight(payload, "\n")
+	switch {
+	case !printable(payload):
+		return text
+	case layout == "":
+		return payload
+	default:
+		return strings.Replace(layout, "%s", quote(payload), 1)
+	}
+}
+
+// decode the command substitutions inside the statement, like $(echo ... | base64 -d).
+func decodeSubstitutions(text string) string {
+	var builder strings.Builder
+
+	for {
+		start := strings.Index(text, "$(")
+		if start < 0 {
+			builder.WriteString(text)
+			break
+		}
+
+		end := closingParen(text, start+2)
+		if end < 0 {
+			builder.WriteString(text)
+			break
+		}
+
+		builder.WriteString(text[:start+2])
+		builder.WriteString(decodeOnce(text[start+2 : end]))
+		builder.WriteString(")")
+		text = text[end+1:]
+	}
+
+	return builder.String()
+}
+
+// decode the ANSI-C quoted words, like $'\x6c\x73', as the shell does.
+func decodeQuoted(text string) string {
+	var builder strings.Builder
+
+	for {
+		start := strings.Index(text, "$'")
+		if start < 0 {
+			builder.WriteString(text)
+			break
+		}
+
+		end := closingQuote(text, start+2)
+		if end < 0 {
+			builder.WriteString(text)
+			break
+		}
+
+		value := unescape(text[start+2 : end])
+		switch printable(value) {
+		case true:
+			builder.WriteString(text[:start])
+			builder.WriteString(quote(value))
+		default:
+			builder.WriteString(text[:end+1])
+		}
+		text = text[end+1:]
+	}
+
+	return builder.String()
+}
+
+// check the decoded payload is the readable text, the binary payload is kept as is.
+func printable(text string) bool {
+	if !utf8.ValidString(text) {
+		return false
+	}
+
+	for _, ch := range text {
+		if !unicode.IsPrint(ch) && !unicode.IsSpace(ch) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quote the payload as the single-quoted shell word.
+func quote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+// check the command is the shell that executes the payload from stdin.
+func isShell(name string) bool {
+	switch name[strings.LastIndex(name, "/")+1:] {
+	case "sh", "bash", "dash", "zsh", "ash", "ksh":
+		return true
+	default:
+		return false
+	}
+}
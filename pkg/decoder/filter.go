@@ -0,0 +1,178 @@
+package decoder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// The maximum size of the decompressed payload, to avoid the decompression bomb.
+const maxPayload = 1 << 20
+
+// The filter that decodes the payload, return false when failed.
+type filter func(payload string) (string, bool)
+
+// get the payload produced by the first command of the pipeline, like echo or
+// printf, and whether the payload is decoded by the command itself. The filter
+// is returned when the payload is passed by the here-string, like base64 -d <<< ...
+func source(args []string) (string, bool, filter, bool) {
+	if len(args) == 0 {
+		return "", false, nil, false
+	}
+
+	for index, arg := range args {
+		if arg == "<<<" && index+1 < len(args) {
+			command := append(append([]string{}, args[:index]...), args[index+2:]...)
+			if fn, ok := filters(command); ok {
+				return args[index+1], false, fn, true
+			}
+		}
+	}
+
+	switch args[0] {
+	case "echo":
+		escape := false
+		args = args[1:]
+		for len(args) > 0 && len(args[0]) > 1 && strings.Trim(args[0], "-neE") == "" && args[0][0] == '-' {
+			escape = escape || strings.Contains(args[0], "e")
+			args = args[1:]
+		}
+
+		text := strings.Join(args, " ")
+		if escape {
+			decoded := unescape(text)
+			return decoded, decoded != text, nil, true
+		}
+
+		return text, false, nil, true
+	case "printf":
+		if len(args) < 2 {
+			return "", false, nil, false
+		}
+
+		format := args[1]
+		switch {
+		case len(args) > 2 && (format == "%s" || format == "%b"):
+			text := strings.Join(args[2:], "")
+			if format == "%b" {
+				return unescape(text), true, nil, true
+			}
+			return text, false, nil, true
+		default:
+			decoded := unescape(strings.ReplaceAll(format, "%%", "%"))
+			return decoded, decoded != format, nil, true
+		}
+	default:
+		return "", false, nil, false
+	}
+}
+
+// get the filter of the command in the pipeline that decodes the payload.
+func filters(args []string) (filter, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+
+	name := args[0][strings.LastIndex(args[0], "/")+1:]
+	flags := strings.Join(args[1:], " ")
+
+	switch {
+	case name == "base64" && hasFlag(args[1:], "-d", "--decode", "-D"):
+		return decodeBase64, true
+	case name == "base32" && hasFlag(args[1:], "-d", "--decode"):
+		return decodeBase32, true
+	case name == "xxd" && strings.Contains(flags, "-r") && strings.Contains(flags, "-p"):
+		return decodeHex, true
+	case name == "rev":
+		return reverse, true
+	case name == "gunzip" || name == "zcat":
+		return gunzip, true
+	case name == "gzip" && hasFlag(args[1:], "-d", "-dc", "-cd", "--decompress"):
+		return gunzip, true
+	case name == "cat" && len(args) == 1:
+		return func(payload string) (string, bool) { return payload, true }, true
+	default:
+		return nil, false
+	}
+}
+
+// check any of the flags is passed.
+func hasFlag(args []string, flags ...string) bool {
+	for _, arg := range args {
+		for _, flag := range flags {
+			if arg == flag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeBase64(payload string) (string, bool) {
+	text := strings.Join(strings.Fields(payload), "")
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+		if data, err := encoding.DecodeString(text); err == nil {
+			return string(data), true
+		}
+
+		// tolerate the missing padding
+		if data, err := encoding.WithPadding(base64.NoPadding).DecodeString(strings.TrimRight(text, "=")); err == nil {
+			return string(data), true
+		}
+	}
+
+	return "", false
+}
+
+func decodeBase32(payload string) (string, bool) {
+	data, err := base32.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+func decodeHex(payload string) (string, bool) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+// reverse each line of the payload, as the rev does.
+func reverse(payload string) (string, bool) {
+	lines := strings.Split(strings.TrimSuffix(payload, "\n"), "\n")
+	for index, line := range lines {
+		runes := []rune(line)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		lines[index] = string(runes)
+	}
+
+	return strings.Join(lines, "\n"), true
+}
+
+func gunzip(payload string) (string, bool) {
+	reader, err := gzip.NewReader(bytes.NewReader([]byte(payload)))
+	if err != nil {
+		return "", false
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxPayload))
+	if err != nil && len(data) == 0 {
+		return "", false
+	}
+
+	return string(data), true
+}
@@ -0,0 +1,314 @@
+package decoder
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	// The separators between the statements.
+	statementSeparators = []string{"&&", "||", ";", "\n"}
+	// The separator between the commands of the pipeline.
+	pipeSeparators = []string{"|"}
+)
+
+// The segment of the command split by the separator.
+type segment struct {
+	text string
+	sep  string
+}
+
+// split the command by the separators outside the quotes and the substitutions,
+// at least one segment is returned.
+func split(text string, separators []string) []segment {
+	var segments []segment
+
+	start := 0
+	for index := 0; index < len(text); index++ {
+		switch ch := text[index]; {
+		case ch == '\\':
+			index++
+		case ch == '\'' || ch == '"' || ch == '`':
+			if end := closing(text, index+1, ch); end >= 0 {
+				index = end
+			}
+		case ch == '$' && strings.HasPrefix(text[index:], "$("):
+			if end := closingParen(text, index+2); end >= 0 {
+				index = end
+			}
+		default:
+			for _, sep := range separators {
+				if strings.HasPrefix(text[index:], sep) {
+					segments = append(segments, segment{text: text[start:index], sep: sep})
+					index += len(sep) - 1
+					start = index + 1
+					break
+				}
+			}
+		}
+	}
+
+	return append(segments, segment{text: text[start:]})
+}
+
+// join the segments back into the command.
+func joinStages(segments []segment) string {
+	var builder strings.Builder
+	for _, segment := range segments {
+		builder.WriteString(segment.text)
+		builder.WriteString(segment.sep)
+	}
+
+	return builder.String()
+}
+
+// split the command into the words and removes the quotes as the shell does, the
+// variables and the substitutions are kept as is.
+func words(text string) []string {
+	var args []string
+	var word strings.Builder
+
+	started := false
+	flush := func() {
+		if started {
+			args = append(args, word.String())
+			word.Reset()
+			started = false
+		}
+	}
+
+	for index := 0; index < len(text); index++ {
+		switch ch := text[index]; {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+		case ch == '\\' && index+1 < len(text):
+			word.WriteByte(text[index+1])
+			index++
+			started = true
+		case ch == '\'':
+			end := closing(text, index+1, ch)
+			if end < 0 {
+				end = len(text)
+			}
+			word.WriteString(text[index+1 : end])
+			index = end
+			started = true
+		case ch == '"':
+			end := closing(text, index+1, ch)
+			if end < 0 {
+				end = len(text)
+			}
+			word.WriteString(unquote(text[index+1 : end]))
+			index = end
+			started = true
+		case ch == '$' && strings.HasPrefix(text[index:], "$'"):
+			end := closingQuote(text, index+2)
+			if end < 0 {
+				end = len(text)
+			}
+			word.WriteString(unescape(text[index+2 : end]))
+			index = end
+			started = true
+		case ch == '$' && strings.HasPrefix(text[index:], "$("):
+			end := closingParen(text, index+2)
+			if end < 0 {
+				end = len(text) - 1
+			}
+			word.WriteString(text[index : end+1])
+			index = end
+			started = true
+		case strings.HasPrefix(text[index:], "<<<"):
+			// the here-string is always the separate word
+			flush()
+			args = append(args, "<<<")
+			index += 2
+		default:
+			word.WriteByte(ch)
+			started = true
+		}
+	}
+
+	flush()
+	return args
+}
+
+// separate the I/O redirections, like > file or 2>/dev/null, from the arguments.
+func redirections(args []string) ([]string, []string) {
+	var words, redirects []string
+
+	for index := 0; index < len(args); index++ {
+		arg := strings.TrimLeft(args[index], "0123456789&")
+		switch {
+		case arg == "<<<":
+			words = append(words, args[index])
+		case arg == ">" || arg == ">>" || arg == "<":
+			redirects = append(redirects, args[index])
+			if index+1 < len(args) {
+				redirects = append(redirects, args[index+1])
+				index++
+			}
+		case strings.HasPrefix(arg, ">") || strings.HasPrefix(arg, "<"):
+			redirects = append(redirects, args[index])
+		default:
+			words = append(words, args[index])
+		}
+	}
+
+	return words, redirects
+}
+
+// remove the escapes inside the double quotes.
+func unquote(text string) string {
+	var builder strings.Builder
+
+	for index := 0; index < len(text); index++ {
+		if text[index] == '\\' && index+1 < len(text) && strings.IndexByte("$`\"\\", text[index+1]) >= 0 {
+			index++
+		}
+		builder.WriteByte(text[index])
+	}
+
+	return builder.String()
+}
+
+// find the index of the closing quote, or -1 if not found.
+func closing(text string, index int, quote byte) int {
+	for ; index < len(text); index++ {
+		switch {
+		case text[index] == '\\' && quote != '\'':
+			index++
+		case text[index] == quote:
+			return index
+		}
+	}
+
+	return -1
+}
+
+// find the index of the closing quote of the ANSI-C quoted word, or -1 if not found.
+func closingQuote(text string, index int) int {
+	for ; index < len(text); index++ {
+		switch text[index] {
+		case '\\':
+			index++
+		case '\'':
+			return index
+		}
+	}
+
+	return -1
+}
+
+// find the index of the closing parenthesis, or -1 if not found.
+func closingParen(text string, index int) int {
+	depth := 1
+	for ; index < len(text); index++ {
+		switch ch := text[index]; ch {
+		case '\\':
+			index++
+		case '\'', '"', '`':
+			end := closing(text, index+1, ch)
+			if end < 0 {
+				return -1
+			}
+			index = end
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return index
+			}
+		}
+	}
+
+	return -1
+}
+
+// interpret the backslash escapes as the echo -e, printf and $'...' do.
+func unescape(text string) string {
+	var builder strings.Builder
+
+	for index := 0; index < len(text); index++ {
+		if text[index] != '\\' || index+1 == len(text) {
+			builder.WriteByte(text[index])
+			continue
+		}
+
+		index++
+		switch ch := text[index]; ch {
+		case 'a':
+			builder.WriteByte('\a')
+		case 'b':
+			builder.WriteByte('\b')
+		case 'e', 'E':
+			builder.WriteByte(0x1b)
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'v':
+			builder.WriteByte('\v')
+		case '\\', '\'', '"':
+			builder.WriteByte(ch)
+		case 'x':
+			end := scan(text, index+1, 2, "0123456789abcdefABCDEF")
+			value, err := strconv.ParseUint(text[index+1:end], 16, 8)
+			if err != nil {
+				builder.WriteString(`\x`)
+				continue
+			}
+
+			builder.WriteByte(byte(value))
+			index = end - 1
+		case 'u':
+			end := scan(text, index+1, 4, "0123456789abcdefABCDEF")
+			value, err := strconv.ParseUint(text[index+1:end], 16, 32)
+			if err != nil {
+				builder.WriteString(`\u`)
+				continue
+			}
+
+			builder.WriteRune(rune(value))
+			index = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// the octal escape, both \NNN and \0NNN are accepted
+			start := index
+			if ch == '0' {
+				start++
+			}
+
+			end := scan(text, start, 3, "01234567")
+			value, err := strconv.ParseUint(text[start:end], 8, 8)
+			switch {
+			case start == end:
+				builder.WriteByte(0)
+			case err != nil:
+				builder.WriteByte('\\')
+				builder.WriteByte(ch)
+				continue
+			default:
+				builder.WriteByte(byte(value))
+			}
+			index = end - 1
+		default:
+			builder.WriteByte('\\')
+			builder.WriteByte(ch)
+		}
+	}
+
+	return builder.String()
+}
+
+// scan at most size digits from the index, return the index after the last digit.
+func scan(text string, index, size int, digits string) int {
+	end := index
+	for end < len(text) && end < index+size && strings.IndexByte(digits, text[end]) >= 0 {
+		end++
+	}
+
+	return end
+}
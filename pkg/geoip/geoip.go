@@ -0,0 +1,126 @@
+// The offline GeoIP and ASN lookup from the local MaxMind-format databases.
+//
+// Both the GeoLite2 and the DB-IP lite databases are supported, the lookup never
+// touches the network.
+package geoip
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog/log"
+)
+
+// The default GeoIP databases, nil when not configured.
+var defaultGeoIP atomic.Pointer[GeoIP]
+
+// The GeoIP databases loaded from the local .mmdb files.
+type GeoIP struct {
+	City string `name:"city" help:"The path of the City or Country .mmdb file, like GeoLite2-City.mmdb"`
+	ASN  string `name:"asn" help:"The path of the ASN .mmdb file, like GeoLite2-ASN.mmdb"`
+
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+// The location of the IP address, the empty fields are unknown.
+type Location struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+// the record of the City or Country database
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// the record of the ASN database
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// Open the configured databases and use them as the default GeoIP, the missing
+// database is skipped.
+func (g *GeoIP) Init() {
+	if g == nil || (g.City == "" && g.ASN == "") {
+		log.Debug().Msg("no GeoIP database configured, skip the enrichment")
+		return
+	}
+
+	var err error
+	if g.City != "" {
+		if g.city, err = maxminddb.Open(g.City); err != nil {
+			log.Warn().Err(err).Str("path", g.City).Msg("failed to open the GeoIP city database")
+		}
+	}
+
+	if g.ASN != "" {
+		if g.asn, err = maxminddb.Open(g.ASN); err != nil {
+			log.Warn().Err(err).Str("path", g.ASN).Msg("failed to open the GeoIP ASN database")
+		}
+	}
+
+	if g.city == nil && g.asn == nil {
+		return
+	}
+
+	defaultGeoIP.Store(g)
+	log.Info().Str("city", g.City).Str("asn", g.ASN).Msg("load the GeoIP databases")
+}
+
+// Check the default GeoIP databases are loaded.
+func Enabled() bool {
+	return defaultGeoIP.Load() != nil
+}
+
+// Lookup the location of the IP address by the default GeoIP databases.
+func Lookup(ip string) Location {
+	if g := defaultGeoIP.Load(); g != nil {
+		return g.Lookup(ip)
+	}
+
+	return Location{}
+}
+
+// Lookup the location of the IP address, the unknown or invalid IP returns the empty location.
+func (g *GeoIP) Lookup(ip string) Location {
+	var location Location
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return location
+	}
+
+	if g.city != nil {
+		var record cityRecord
+		switch err := g.city.Lookup(addr, &record); err {
+		case nil:
+			location.Country = record.Country.ISOCode
+			location.City = record.City.Names["en"]
+		default:
+			log.Debug().Err(err).Str("ip", ip).Msg("failed to lookup the city")
+		}
+	}
+
+	if g.asn != nil {
+		var record asnRecord
+		switch err := g.asn.Lookup(addr, &record); err {
+		case nil:
+			location.ASN = record.Number
+			location.Org = record.Org
+		default:
+			log.Debug().Err(err).Str("ip", ip).Msg("failed to lookup the ASN")
+		}
+	}
+
+	return location
+}
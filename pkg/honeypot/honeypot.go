@@ -51,6 +51,9 @@ func (s *Service) Run(ctx context.Context) error {
 	v.SetDefault("max_retry", 3)
 	v.SetDefault("homedir", "~")
 	v.SetDefault("prompt", "$ ")
+	v.SetDefault("escalate", "password")
+	v.SetDefault("persona", "ubuntu")
+	v.SetDefault("fetch", false)
 	v.SetDefault("cipher", []string{"ssh-ed25519", "rsa-sha2-256", "rsa-sha2-512"})
 
 	if err := v.Unmarshal(s.Service); err != nil {
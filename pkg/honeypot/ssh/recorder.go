@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"context"
+
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/shell"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The recorder that saves the behavior inside the shell as the events.
+type recorder struct {
+	honeypot *HoneypotSSH
+	ctx      context.Context
+}
+
+// Record the credential the client tried in the shell, like sudo or su.
+func (r *recorder) Credential(session *shell.Session, username, password string) {
+	event := r.honeypot.event(r.ctx, types.EventAuthPassword, session)
+	event.Username = &username
+	event.Password = &password
+	event.Set("escalate", true)
+	pipeline.Publish(event)
+}
+
+// Record the command executed inside the script, the script is the path of the
+// script or the marker like (stdin) and -c.
+func (r *recorder) Command(session *shell.Session, command, script string) {
+	event := r.honeypot.event(r.ctx, types.EventCommand, session)
+	event.Command = &command
+	event.Script = &script
+	pipeline.Publish(event)
+}
+
+// Record the file downloaded by wget or curl, the hash is set only when the file
+// is fetched.
+func (r *recorder) Download(session *shell.Session, download shell.Download) {
+	event := r.honeypot.event(r.ctx, types.EventDownload, session)
+	event.Set("url", download.URL)
+	if download.Filename != "" {
+		event.Set("filename", download.Filename)
+	}
+	if download.SHA256 != "" {
+		event.Set("sha256", download.SHA256)
+		event.Set("size", download.Size)
+	}
+	pipeline.Publish(event)
+}
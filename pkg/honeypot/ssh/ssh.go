@@ -1,27 +1,38 @@
 package ssh
 
 import (
+	"bufio"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 
+	"github.com/cmj0121/zoe/pkg/metrics"
+	"github.com/cmj0121/zoe/pkg/pipeline"
 	"github.com/cmj0121/zoe/pkg/shell"
 	"github.com/cmj0121/zoe/pkg/types"
 )
 
-type IP string
+type contextKey string
 
 var (
-	// The target IP
-	TargetIP IP = "ip"
+	// The context key of the incoming connection
+	ConnKey contextKey = "conn"
 
 	ServiceName = "ssh"
 )
 
+// The timeout of fetching the file downloaded by wget and curl.
+const fetchTimeout = 10 * time.Second
+
 // The SSH-based honeypot service that provides the semi-interactive shell.
 type HoneypotSSH struct {
 	Bind     string
@@ -33,6 +44,12 @@ type HoneypotSSH struct {
 	Username *string
 	Password *string
 	Cipher   []string
+	Escalate string
+	Persona  string
+	// Fetch the files downloaded by wget and curl, to record the hash.
+	Fetch bool
+
+	fetcher shell.Fetcher
 }
 
 func New() *HoneypotSSH {
@@ -47,34 +64,62 @@ func (h *HoneypotSSH) Run(ctx context.Context) error {
 		PasswordCallback: func(conn ssh.ConnMetadata, bytes []byte) (*ssh.Permissions, error) {
 			username := conn.User()
 			password := string(bytes)
+			session := sessionID(conn)
 
-			message := types.Message{
-				IP:       conn.RemoteAddr().String(),
-				Service:  ServiceName,
-				Username: &username,
-				Password: &password,
-			}
-			if err := message.Insert(); err != nil {
-				log.Warn().Err(err).Msg("failed to insert the message")
-				// always accept the connection
-			}
+			event := types.NewEvent(types.EventAuthPassword, ServiceName, conn.RemoteAddr(), conn.LocalAddr())
+			event.Session = &session
+			event.Username = &username
+			event.Password = &password
+			event.Set("client_version", string(conn.ClientVersion()))
+			// publish after the outcome is known, the alert fires on the successful login
+			defer pipeline.Publish(event)
 
+			event.Set("success", false)
 			switch {
 			case h.Username == nil:
 				log.Debug().Msg("no authorized username, always reject the connection")
+				metrics.AuthAttempts.WithLabelValues(ServiceName, "password", "failure").Inc()
 				return nil, fmt.Errorf("no authorized username")
 			case username == *h.Username && h.Password == nil:
 				log.Debug().Msg("no authorized password, always accept the connection")
 			case username != *h.Username || password != *h.Password:
 				log.Debug().Msg("invalid username or password")
+				metrics.AuthAttempts.WithLabelValues(ServiceName, "password", "failure").Inc()
 				return nil, fmt.Errorf("invalid username or password")
 			}
 
+			metrics.AuthAttempts.WithLabelValues(ServiceName, "password", "success").Inc()
+			event.Set("success", true)
+
 			log.Info().Str("username", username).Str("password", password).Msg("accept the SSH connection")
-			return nil, nil
+			// keep the password for the privilege escalation in the shell
+			permissions := &ssh.Permissions{
+				Extensions: map[string]string{"password": password},
+			}
+			return permissions, nil
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			username := conn.User()
+			session := sessionID(conn)
+
+			event := types.NewEvent(types.EventAuthPublicKey, ServiceName, conn.RemoteAddr(), conn.LocalAddr())
+			event.Session = &session
+			event.Username = &username
+			event.Set("key_type", key.Type()).Set("fingerprint", ssh.FingerprintSHA256(key))
+			event.Set("client_version", string(conn.ClientVersion()))
+			pipeline.Publish(event)
+			metrics.AuthAttempts.WithLabelValues(ServiceName, "publickey", "failure").Inc()
+
+			// always reject the public key, the client falls back to the password
+			return nil, fmt.Errorf("public key authentication is not allowed")
 		},
 	}
 
+	if h.Fetch {
+		log.Info().Msg("fetch the files downloaded by wget and curl")
+		h.fetcher = shell.NewFetcher(fetchTimeout)
+	}
+
 	h.AddHostKey(config)
 	return h.run(ctx, config)
 }
@@ -95,9 +140,7 @@ func (h *HoneypotSSH) run(ctx context.Context, cfg *ssh.ServerConfig) error {
 			log.Info().Msg("the service is shutting down")
 			return nil
 		case conn := <-handler:
-			ip := conn.RemoteAddr().String()
-			ctx = context.WithValue(ctx, TargetIP, ip)
-			go h.handleSSHConn(ctx, conn, cfg)
+			go h.handleSSHConn(context.WithValue(ctx, ConnKey, conn), conn, cfg)
 		}
 	}
 }
@@ -138,32 +181,83 @@ func (h *HoneypotSSH) handleSSHConn(ctx context.Context, conn net.Conn, cfg *ssh
 	remote := conn.RemoteAddr().String()
 	log.Info().Str("remote", remote).Str("bind", h.Bind).Msg("accepted the incoming TCP connection")
 
+	started := time.Now()
+	pipeline.Publish(h.event(ctx, types.EventConnect, nil))
+
 	sshConn, chans, reqs, err := ssh.NewServerConn(conn, cfg)
 	if err != nil {
-		message := types.Message{
-			IP:      remote,
-			Service: ServiceName,
-		}
-		if err := message.Insert(); err != nil {
-			log.Warn().Err(err).Msg("failed to insert the message")
-			// always accept the connection
+		var authErr *ssh.ServerAuthError
+		switch errors.As(err, &authErr) {
+		case true:
+			metrics.Connections.WithLabelValues(ServiceName, "rejected").Inc()
+		default:
+			metrics.HandshakeFailures.WithLabelValues(ServiceName).Inc()
 		}
 
+		event := h.event(ctx, types.EventDisconnect, nil)
+		event.Set("duration", time.Since(started).Seconds()).Set("reason", err.Error())
+		pipeline.Publish(event)
 		return
 	}
 
+	metrics.Connections.WithLabelValues(ServiceName, "accepted").Inc()
+	metrics.ActiveSessions.WithLabelValues(ServiceName).Inc()
+	defer metrics.ActiveSessions.WithLabelValues(ServiceName).Dec()
+
 	client := sshConn.RemoteAddr().String()
 	log.Info().Str("client", client).Str("remote", remote).Msg("accepted the incoming SSH connection")
 	// discard the requests
 	go ssh.DiscardRequests(reqs)
 
+	// the shell session shared by all the channels of the connection
+	session := shell.NewSession(sessionID(sshConn), sshConn.User(), h.persona())
+	if sshConn.Permissions != nil {
+		session.Password = sshConn.Permissions.Extensions["password"]
+	}
+
+	defer func() {
+		event := h.event(ctx, types.EventDisconnect, session)
+		event.Set("duration", time.Since(started).Seconds())
+		pipeline.Publish(event)
+	}()
+
 	for channel := range chans {
-		go h.handleSSHChannel(ctx, channel)
+		switch channel.ChannelType() {
+		case "session":
+			go h.handleSSHChannel(ctx, session, channel)
+		case "direct-tcpip":
+			h.handleForward(ctx, session, channel)
+		default:
+			log.Warn().Str("type", channel.ChannelType()).Msg("unsupported channel type")
+			_ = channel.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
 	}
 }
 
+// Handle the port forwarding request, the request is recorded and always rejected.
+func (h *HoneypotSSH) handleForward(ctx context.Context, session *shell.Session, channel ssh.NewChannel) {
+	var target struct {
+		DestAddr   string
+		DestPort   uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+
+	event := h.event(ctx, types.EventForward, session)
+	switch err := ssh.Unmarshal(channel.ExtraData(), &target); err {
+	case nil:
+		event.Set("dest_addr", target.DestAddr).Set("dest_port", target.DestPort)
+		event.Set("origin_addr", target.OriginAddr).Set("origin_port", target.OriginPort)
+	default:
+		log.Warn().Err(err).Msg("failed to parse the forwarding request")
+	}
+	pipeline.Publish(event)
+
+	_ = channel.Reject(ssh.Prohibited, "administratively prohibited")
+}
+
 // Handle the SSH channel with the given configuration.
-func (h *HoneypotSSH) handleSSHChannel(ctx context.Context, channel ssh.NewChannel) {
+func (h *HoneypotSSH) handleSSHChannel(ctx context.Context, session *shell.Session, channel ssh.NewChannel) {
 	ch, reqs, err := channel.Accept()
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to accept the SSH channel")
@@ -181,26 +275,23 @@ func (h *HoneypotSSH) handleSSHChannel(ctx context.Context, channel ssh.NewChann
 			terminal = term.NewTerminal(ch, h.Prompt)
 			h.reply(req, true)
 		case "shell":
-			go h.handleShellReq(ctx, ch, terminal)
+			go h.handleShellReq(ctx, session, ch, terminal)
 			h.reply(req, true)
 		case "exec":
 			command := string(req.Payload[4:])
 
-			message := types.Message{
-				IP:      ctx.Value(TargetIP).(string),
-				Service: ServiceName,
-				Command: &command,
-			}
-			if err := message.Insert(); err != nil {
-				log.Warn().Err(err).Msg("failed to insert the message")
-				// always accept the command
-			}
+			event := h.event(ctx, types.EventCommand, session)
+			event.Command = &command
+			pipeline.Publish(event)
+			metrics.Commands.WithLabelValues(ServiceName).Inc()
 
-			shell := shell.New()
-			output := shell.Exec(command) + "\n"
+			shell := h.newShell(ctx, session)
+			if output := shell.Exec(command); output != "" {
+				_, _ = ch.Write([]byte(output + "\n"))
+			}
 
-			_, _ = ch.Write([]byte(output))
 			h.reply(req, true)
+			h.exitStatus(ch, shell.ExitCode())
 
 			// close the channel after the command is executed
 			return
@@ -222,31 +313,121 @@ func (h *HoneypotSSH) reply(req *ssh.Request, ok bool) {
 	}
 }
 
-// Handle the shell request with the given channel and terminal.
-func (h *HoneypotSSH) handleShellReq(ctx context.Context, channel ssh.Channel, term *term.Terminal) {
+// Get the persona of the fake host, fallback to the default one if not found.
+func (h *HoneypotSSH) persona() *shell.Persona {
+	persona := shell.LookupPersona(h.Persona)
+	if persona == nil {
+		log.Warn().Str("persona", h.Persona).Msg("unknown persona, use the default one")
+		persona = shell.LookupPersona(shell.DefaultPersona)
+	}
+
+	return persona
+}
+
+// Create the restricted shell bound to the session.
+func (h *HoneypotSSH) newShell(ctx context.Context, session *shell.Session) *shell.RBash {
+	rbash := shell.New(session)
+	rbash.Recorder = &recorder{honeypot: h, ctx: ctx}
+	rbash.Escalate = shell.Escalation(h.Escalate)
+	rbash.Fetch = h.fetcher
+
+	return rbash
+}
+
+// Send the exit status of the command to the client.
+func (h *HoneypotSSH) exitStatus(ch ssh.Channel, code int) {
+	status := struct{ Status uint32 }{uint32(code)}
+	if _, err := ch.SendRequest("exit-status", false, ssh.Marshal(&status)); err != nil {
+		log.Warn().Err(err).Msg("failed to send the exit status")
+	}
+}
+
+// Handle the shell request with the given channel and terminal, the terminal is
+// nil when the client requests no pty, like ssh -T.
+func (h *HoneypotSSH) handleShellReq(ctx context.Context, session *shell.Session, channel ssh.Channel, terminal *term.Terminal) {
 	defer channel.Close()
 
-	shell := shell.New()
+	shell := h.newShell(ctx, session)
+
+	var writer io.Writer
+	var readLine func() (string, error)
+	switch terminal {
+	case nil:
+		// read the commands line by line without the prompt and the echo, as bash
+		// does without the tty
+		scanner := bufio.NewScanner(channel)
+		readLine = func() (string, error) {
+			switch {
+			case scanner.Scan():
+				return strings.TrimSuffix(scanner.Text(), "\r"), nil
+			case scanner.Err() != nil:
+				return "", scanner.Err()
+			default:
+				return "", io.EOF
+			}
+		}
+		writer = channel
+	default:
+		shell.Terminal = terminal
+		terminal.SetPrompt(shell.Prompt(h.Prompt))
+		// the Tab completion and the history of the session
+		terminal.AutoCompleteCallback = shell.Complete
+		terminal.History = shell.History()
+
+		readLine = terminal.ReadLine
+		writer = terminal
+	}
+
 	for !shell.IsExit() {
-		line, err := term.ReadLine()
+		line, err := readLine()
 		if err != nil {
 			log.Warn().Err(err).Msg("failed to read the line")
 			return
 		}
 
-		message := types.Message{
-			IP:      ctx.Value(TargetIP).(string),
-			Service: ServiceName,
-			Command: &line,
-		}
-		if err := message.Insert(); err != nil {
-			log.Warn().Err(err).Msg("failed to insert the message")
-			// always accept the command
+		event := h.event(ctx, types.EventCommand, session)
+		event.Command = &line
+		pipeline.Publish(event)
+		metrics.Commands.WithLabelValues(ServiceName).Inc()
+
+		if output := shell.Exec(line); output != "" {
+			_, _ = writer.Write([]byte(output + "\n"))
 		}
 
-		output := shell.Exec(line) + "\n"
-		_, _ = term.Write([]byte(output))
+		// the prompt may be changed after the privilege escalation
+		if terminal != nil {
+			terminal.SetPrompt(shell.Prompt(h.Prompt))
+		}
 	}
 
+	h.exitStatus(channel, shell.ExitCode())
 	channel.Close()
 }
+
+// Create the event with the envelope of the connection in the context.
+func (h *HoneypotSSH) event(ctx context.Context, kind types.EventType, session *shell.Session) *types.Event {
+	var event *types.Event
+
+	switch conn, ok := ctx.Value(ConnKey).(net.Conn); ok {
+	case true:
+		event = types.NewEvent(kind, ServiceName, conn.RemoteAddr(), conn.LocalAddr())
+	default:
+		event = types.NewEvent(kind, ServiceName, nil, nil)
+	}
+
+	if session != nil {
+		event.Session = &session.ID
+	}
+
+	return event
+}
+
+// Get the short identifier of the SSH connection, derived from the session hash.
+func sessionID(conn ssh.ConnMetadata) string {
+	id := conn.SessionID()
+	if len(id) > 8 {
+		id = id[:8]
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,137 @@
+package intel
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The MISP events, in the same layout as the response of the MISP restSearch.
+type MISPResponse struct {
+	Response []MISPEvent `json:"response"`
+}
+
+// The MISP event wrapper, imported by the MISP as is.
+type MISPEvent struct {
+	Event MISPEventBody `json:"Event"`
+}
+
+// The MISP event of one observation.
+type MISPEventBody struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Distribution  string          `json:"distribution"`
+	Published     bool            `json:"published"`
+	Attribute     []MISPAttribute `json:"Attribute"`
+	Object        []MISPObject    `json:"Object"`
+}
+
+// The MISP attribute.
+type MISPAttribute struct {
+	UUID           string `json:"uuid"`
+	Type           string `json:"type"`
+	Category       string `json:"category"`
+	Value          string `json:"value"`
+	ToIDS          bool   `json:"to_ids"`
+	Comment        string `json:"comment,omitempty"`
+	ObjectRelation string `json:"object_relation,omitempty"`
+	FirstSeen      string `json:"first_seen,omitempty"`
+	LastSeen       string `json:"last_seen,omitempty"`
+}
+
+// The MISP object, like the credential.
+type MISPObject struct {
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	MetaCategory string          `json:"meta-category"`
+	Comment      string          `json:"comment,omitempty"`
+	Attribute    []MISPAttribute `json:"Attribute"`
+}
+
+// Get the MISP events of the observations, one event per observation. The event
+// is shared within the organization (distribution 0) and not published.
+func MISP(observations []*Observation) *MISPResponse {
+	response := &MISPResponse{Response: []MISPEvent{}}
+
+	for _, observation := range observations {
+		if observation.Empty() {
+			continue
+		}
+
+		key := string(observation.Group) + ":" + observation.Key
+		first := observation.FirstSeen.UTC().Format(time.RFC3339)
+		last := observation.LastSeen.UTC().Format(time.RFC3339)
+
+		event := MISPEventBody{
+			UUID:          uuid5(zoeNamespace, "misp:"+key),
+			Info:          fmt.Sprintf("zoe honeypot observations of the %s %s", observation.Group, observation.Key),
+			Date:          observation.FirstSeen.UTC().Format(time.DateOnly),
+			Timestamp:     strconv.FormatInt(observation.LastSeen.Unix(), 10),
+			ThreatLevelID: "3",
+			Analysis:      "2",
+			Distribution:  "0",
+			Attribute:     []MISPAttribute{},
+			Object:        []MISPObject{},
+		}
+
+		attribute := func(kind, category, value string, ids bool, comment string) {
+			event.Attribute = append(event.Attribute, MISPAttribute{
+				UUID:      uuid5(zoeNamespace, "misp:"+key+":"+kind+":"+value),
+				Type:      kind,
+				Category:  category,
+				Value:     value,
+				ToIDS:     ids,
+				Comment:   comment,
+				FirstSeen: first,
+				LastSeen:  last,
+			})
+		}
+
+		for _, ip := range observation.IPs {
+			attribute("ip-src", "Network activity", ip, true, "attacker IP")
+		}
+
+		for _, url := range observation.URLs {
+			attribute("url", "Payload delivery", url, true, "download URL")
+		}
+
+		for _, file := range observation.Files {
+			for _, algorithm := range [][2]string{{"SHA-256", "sha256"}, {"SHA-1", "sha1"}, {"MD5", "md5"}} {
+				if hash, ok := file.Hashes[algorithm[0]]; ok {
+					attribute(algorithm[1], "Payload delivery", hash, true, file.Name)
+				}
+			}
+		}
+
+		for _, fingerprint := range observation.Fingerprints {
+			comment := fmt.Sprintf("SSH %s key fingerprint tried as %s", fingerprint.KeyType, fingerprint.Username)
+			attribute("text", "Network activity", fingerprint.Fingerprint, false, comment)
+		}
+
+		for _, version := range observation.ClientVersions {
+			attribute("text", "Network activity", version, false, "SSH client version")
+		}
+
+		for _, credential := range observation.Credentials {
+			id := uuid5(zoeNamespace, "misp:"+key+":credential:"+credential.Username+":"+credential.Password)
+			event.Object = append(event.Object, MISPObject{
+				UUID:         id,
+				Name:         "credential",
+				MetaCategory: "misc",
+				Comment:      "the credential tried to log in the honeypot",
+				Attribute: []MISPAttribute{
+					{UUID: uuid5(zoeNamespace, id+":username"), Type: "text", Category: "Other", Value: credential.Username, ObjectRelation: "username"},
+					{UUID: uuid5(zoeNamespace, id+":password"), Type: "text", Category: "Other", Value: credential.Password, ObjectRelation: "password"},
+				},
+			})
+		}
+
+		response.Response = append(response.Response, MISPEvent{Event: event})
+	}
+
+	return response
+}
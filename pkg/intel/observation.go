@@ -0,0 +1,215 @@
+// The threat intelligence export of the observed indicators.
+//
+// The events are grouped into the observations per day or per session, and each
+// observation is exported as the STIX 2.1 observed data or the MISP event, with
+// the attacker IPs, the credentials, the download URLs, the file hashes, the SSH
+// key fingerprints and the client versions.
+package intel
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The number of the events read in one page.
+const pageSize = 1000
+
+// How the events are grouped into the observations.
+type Group string
+
+const (
+	GroupDay     Group = "day"
+	GroupSession Group = "session"
+)
+
+// The credential tried to log in the honeypot.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// The SSH public key tried to log in the honeypot.
+type Fingerprint struct {
+	Username    string `json:"username"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// The file downloaded or uploaded into the honeypot.
+type File struct {
+	Name   string            `json:"name,omitempty"`
+	URL    string            `json:"url,omitempty"`
+	Hashes map[string]string `json:"hashes,omitempty"`
+}
+
+// The indicators observed in the day or the session.
+type Observation struct {
+	// The day (YYYY-MM-DD) or the session ID.
+	Key       string    `json:"key"`
+	Group     Group     `json:"group"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Events    int       `json:"events"`
+
+	IPs            []string      `json:"ips"`
+	Credentials    []Credential  `json:"credentials"`
+	URLs           []string      `json:"urls"`
+	Files          []File        `json:"files"`
+	Fingerprints   []Fingerprint `json:"fingerprints"`
+	ClientVersions []string      `json:"client_versions"`
+}
+
+// Get the observations of the events in the range, ordered by the first seen.
+// The events without the session are grouped by the source IP and the day when
+// grouped per session.
+func Observe(ctx context.Context, r types.Range, group Group) ([]*Observation, error) {
+	switch group {
+	case GroupDay, GroupSession:
+	default:
+		return nil, fmt.Errorf("unsupported group: %s", group)
+	}
+
+	observations := map[string]*Observation{}
+	filter := types.EventFilter{Since: r.Since, Until: r.Until, Limit: pageSize}
+	for {
+		page, err := types.QueryEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range page.Events {
+			key := observationKey(event, group)
+
+			observation, ok := observations[key]
+			if !ok {
+				observation = &Observation{Key: key, Group: group, FirstSeen: event.CreatedAt, LastSeen: event.CreatedAt}
+				observations[key] = observation
+			}
+
+			observation.add(event)
+		}
+
+		if page.NextCursor == 0 {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	var list []*Observation
+	for _, observation := range observations {
+		list = append(list, observation)
+	}
+
+	slices.SortFunc(list, func(a, b *Observation) int {
+		if order := a.FirstSeen.Compare(b.FirstSeen); order != 0 {
+			return order
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return list, nil
+}
+
+// Check the observation has no indicator.
+func (o *Observation) Empty() bool {
+	return len(o.IPs) == 0 && len(o.Credentials) == 0 && len(o.URLs) == 0 &&
+		len(o.Files) == 0 && len(o.Fingerprints) == 0 && len(o.ClientVersions) == 0
+}
+
+// add the indicators of the event into the observation.
+func (o *Observation) add(event *types.Event) {
+	o.Events++
+	if event.CreatedAt.Before(o.FirstSeen) {
+		o.FirstSeen = event.CreatedAt
+	}
+	if event.CreatedAt.After(o.LastSeen) {
+		o.LastSeen = event.CreatedAt
+	}
+
+	o.IPs = appendUnique(o.IPs, event.SrcIP)
+	o.ClientVersions = appendUnique(o.ClientVersions, payloadString(event, "client_version"))
+
+	switch event.Type {
+	case types.EventAuthPassword:
+		credential := Credential{Username: deref(event.Username), Password: deref(event.Password)}
+		if !slices.Contains(o.Credentials, credential) {
+			o.Credentials = append(o.Credentials, credential)
+		}
+	case types.EventAuthPublicKey:
+		fingerprint := Fingerprint{
+			Username:    deref(event.Username),
+			KeyType:     payloadString(event, "key_type"),
+			Fingerprint: payloadString(event, "fingerprint"),
+		}
+		if fingerprint.Fingerprint != "" && !slices.Contains(o.Fingerprints, fingerprint) {
+			o.Fingerprints = append(o.Fingerprints, fingerprint)
+		}
+	case types.EventDownload, types.EventUpload:
+		url := payloadString(event, "url")
+		o.URLs = appendUnique(o.URLs, url)
+
+		file := File{Name: payloadString(event, "filename"), URL: url}
+		if file.Name != "" {
+			// the path in the honeypot is not part of the file
+			file.Name = path.Base(file.Name)
+		}
+		for key, name := range map[string]string{"md5": "MD5", "sha1": "SHA-1", "sha256": "SHA-256"} {
+			if hash := payloadString(event, key); hash != "" {
+				if file.Hashes == nil {
+					file.Hashes = map[string]string{}
+				}
+				file.Hashes[name] = hash
+			}
+		}
+
+		if len(file.Hashes) > 0 && !slices.ContainsFunc(o.Files, func(f File) bool { return maps.Equal(f.Hashes, file.Hashes) }) {
+			o.Files = append(o.Files, file)
+		}
+	}
+}
+
+// get the key of the observation the event belongs to.
+func observationKey(event *types.Event, group Group) string {
+	day := event.CreatedAt.UTC().Format(time.DateOnly)
+	switch {
+	case group == GroupDay:
+		return day
+	case event.Session != nil:
+		return *event.Session
+	default:
+		return fmt.Sprintf("%s@%s", event.SrcIP, day)
+	}
+}
+
+// get the string in the payload of the event, or empty.
+func payloadString(event *types.Event, key string) string {
+	if value, ok := event.Payload[key].(string); ok {
+		return value
+	}
+
+	return ""
+}
+
+// append the non-empty value when not listed.
+func appendUnique(values []string, value string) []string {
+	if value == "" || slices.Contains(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
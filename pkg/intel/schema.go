@@ -0,0 +1,348 @@
+package intel
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The STIX 2.1 JSON schemas (draft 2020-12) of the bundle and the object types
+// exported by zoe, derived from the OASIS cti-stix2-json-schemas and trimmed to
+// the properties zoe writes.
+//
+//go:embed schemas
+var schemaFS embed.FS
+
+// The schema of the bundle envelope.
+const bundleSchema = "common/bundle.json"
+
+// The schemas of the object types exported by zoe.
+var objectSchemas = map[string]string{
+	"identity":      "sdos/identity.json",
+	"indicator":     "sdos/indicator.json",
+	"observed-data": "sdos/observed-data.json",
+	"relationship":  "sros/relationship.json",
+	"ipv4-addr":     "observables/ipv4-addr.json",
+	"ipv6-addr":     "observables/ipv6-addr.json",
+	"url":           "observables/url.json",
+	"user-account":  "observables/user-account.json",
+	"file":          "observables/file.json",
+	"software":      "observables/software.json",
+}
+
+// The embedded schemas keyed by the path, loaded once.
+var loadSchemas = sync.OnceValues(func() (map[string]any, error) {
+	documents := map[string]any{}
+	err := fs.WalkDir(schemaFS, "schemas", func(name string, entry fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case entry.IsDir() || path.Ext(name) != ".json":
+			return nil
+		}
+
+		data, err := schemaFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		var document any
+		if err := json.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("invalid schema %s: %w", name, err)
+		}
+
+		documents[strings.TrimPrefix(name, "schemas/")] = document
+		return nil
+	})
+
+	return documents, err
+})
+
+// The compiled patterns of the schemas.
+var schemaPatterns sync.Map
+
+// the validator of the JSON value by the JSON schema, supports the keywords used
+// by the embedded schemas: $ref, allOf, anyOf, oneOf, not, type, const, enum,
+// properties, patternProperties, additionalProperties, required, minProperties,
+// items, minItems, maxItems, pattern, minLength, maxLength, minimum and maximum.
+type schemaValidator struct {
+	documents map[string]any
+}
+
+// validate the value by the schema in the document, and get the errors at the
+// location of the value.
+func (v *schemaValidator) validate(document string, schema any, value any, at string) []error {
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			return []error{fmt.Errorf("%s: not allowed", at)}
+		}
+		return nil
+	case map[string]any:
+		return v.validateObject(document, schema, value, at)
+	default:
+		return []error{fmt.Errorf("%s: invalid schema in %s", at, document)}
+	}
+}
+
+func (v *schemaValidator) validateObject(document string, schema map[string]any, value any, at string) []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{at}, args...)...))
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, resolved, err := v.resolve(document, ref)
+		if err != nil {
+			fail("%v", err)
+		} else {
+			errs = append(errs, v.validate(target, resolved, value, at)...)
+		}
+	}
+
+	if subs, ok := schema["allOf"].([]any); ok {
+		for _, sub := range subs {
+			errs = append(errs, v.validate(document, sub, value, at)...)
+		}
+	}
+
+	if subs, ok := schema["anyOf"].([]any); ok && v.matched(document, subs, value, at) == 0 {
+		fail("does not match any of the schemas")
+	}
+
+	if subs, ok := schema["oneOf"].([]any); ok {
+		if matched := v.matched(document, subs, value, at); matched != 1 {
+			fail("matches %d of the schemas, expect exactly one", matched)
+		}
+	}
+
+	if sub, ok := schema["not"]; ok && len(v.validate(document, sub, value, at)) == 0 {
+		fail("matches the disallowed schema")
+	}
+
+	if kind, ok := schema["type"]; ok && !matchType(kind, value) {
+		fail("expect the type %v, got %s", kind, jsonType(value))
+		// the other keywords are meaningless of the mismatched type
+		return errs
+	}
+
+	if expect, ok := schema["const"]; ok && !reflect.DeepEqual(expect, value) {
+		fail("expect %v, got %v", expect, value)
+	}
+
+	if values, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, expect := range values {
+			found = found || reflect.DeepEqual(expect, value)
+		}
+		if !found {
+			fail("expect one of %v, got %v", values, value)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		errs = append(errs, v.validateProperties(document, schema, value, at)...)
+	case []any:
+		if items, ok := schema["items"]; ok {
+			for index, item := range value {
+				errs = append(errs, v.validate(document, items, item, fmt.Sprintf("%s[%d]", at, index))...)
+			}
+		}
+		if limit, ok := schema["minItems"].(float64); ok && float64(len(value)) < limit {
+			fail("expect at least %v items, got %d", limit, len(value))
+		}
+		if limit, ok := schema["maxItems"].(float64); ok && float64(len(value)) > limit {
+			fail("expect at most %v items, got %d", limit, len(value))
+		}
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok {
+			switch re, err := compilePattern(pattern); {
+			case err != nil:
+				fail("invalid pattern %q in %s: %v", pattern, document, err)
+			case !re.MatchString(value):
+				fail("%q does not match the pattern %q", value, pattern)
+			}
+		}
+		if limit, ok := schema["minLength"].(float64); ok && float64(utf8.RuneCountInString(value)) < limit {
+			fail("expect at least %v characters", limit)
+		}
+		if limit, ok := schema["maxLength"].(float64); ok && float64(utf8.RuneCountInString(value)) > limit {
+			fail("expect at most %v characters", limit)
+		}
+	case float64:
+		if limit, ok := schema["minimum"].(float64); ok && value < limit {
+			fail("expect at least %v, got %v", limit, value)
+		}
+		if limit, ok := schema["maximum"].(float64); ok && value > limit {
+			fail("expect at most %v, got %v", limit, value)
+		}
+	}
+
+	return errs
+}
+
+func (v *schemaValidator) validateProperties(document string, schema map[string]any, object map[string]any, at string) []error {
+	var errs []error
+
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if _, ok := object[fmt.Sprint(name)]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing the required property %q", at, name))
+			}
+		}
+	}
+
+	if limit, ok := schema["minProperties"].(float64); ok && float64(len(object)) < limit {
+		errs = append(errs, fmt.Errorf("%s: expect at least %v properties, got %d", at, limit, len(object)))
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	patterns, _ := schema["patternProperties"].(map[string]any)
+	additional, restricted := schema["additionalProperties"]
+
+	for name, value := range object {
+		where := at + "." + name
+		known := false
+
+		if sub, ok := properties[name]; ok {
+			known = true
+			errs = append(errs, v.validate(document, sub, value, where)...)
+		}
+
+		for pattern, sub := range patterns {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid pattern %q in %s: %v", where, pattern, document, err))
+				continue
+			}
+
+			if re.MatchString(name) {
+				known = true
+				errs = append(errs, v.validate(document, sub, value, where)...)
+			}
+		}
+
+		if !known && restricted {
+			if sub, ok := additional.(bool); ok && !sub {
+				errs = append(errs, fmt.Errorf("%s: the property %q is not allowed", at, name))
+				continue
+			}
+			errs = append(errs, v.validate(document, additional, value, where)...)
+		}
+	}
+
+	return errs
+}
+
+// get the number of the schemas the value matches.
+func (v *schemaValidator) matched(document string, schemas []any, value any, at string) (matched int) {
+	for _, sub := range schemas {
+		if len(v.validate(document, sub, value, at)) == 0 {
+			matched++
+		}
+	}
+
+	return matched
+}
+
+// resolve the reference relative to the document, and get the document and the
+// schema it refers.
+func (v *schemaValidator) resolve(document, ref string) (string, any, error) {
+	target, pointer, _ := strings.Cut(ref, "#")
+	switch target {
+	case "":
+		target = document
+	default:
+		target = path.Join(path.Dir(document), target)
+	}
+
+	schema, ok := v.documents[target]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown schema %q in %s", ref, document)
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		object, ok := schema.(map[string]any)
+		if !ok {
+			return "", nil, fmt.Errorf("invalid reference %q in %s", ref, document)
+		}
+
+		if schema, ok = object[token]; !ok {
+			return "", nil, fmt.Errorf("invalid reference %q in %s", ref, document)
+		}
+	}
+
+	return target, schema, nil
+}
+
+// check the value is the JSON type, or one of the types.
+func matchType(kind any, value any) bool {
+	switch kind := kind.(type) {
+	case string:
+		switch actual := jsonType(value); {
+		case kind == actual:
+			return true
+		case kind == "integer":
+			number, ok := value.(float64)
+			return ok && number == math.Trunc(number)
+		default:
+			return false
+		}
+	case []any:
+		for _, sub := range kind {
+			if matchType(sub, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// get the JSON type of the decoded value, the integer is also the number.
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := schemaPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaPatterns.Store(pattern, re)
+	return re, nil
+}
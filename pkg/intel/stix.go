@@ -0,0 +1,291 @@
+package intel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	specVersion = "2.1"
+	// The timestamp format of STIX, in UTC with the milliseconds.
+	stixTime = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	// The namespace of the deterministic IDs of the STIX Cyber-observable Objects.
+	scoNamespace = mustParseUUID("00abedb4-aa42-466c-9c01-fed23315a9b7")
+	// The namespace of the deterministic IDs of the other objects exported by zoe,
+	// the same observation gets the same ID in every export.
+	zoeNamespace = mustParseUUID("2f57ace4-fdba-5515-b3ef-bc310a77db8b")
+	// The creation time of the identity, fixed to keep the same version.
+	identityCreated = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// The STIX object, kept as the JSON object since the properties vary by the type.
+type Object map[string]any
+
+// The STIX 2.1 bundle of the objects.
+type Bundle struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Objects []Object `json:"objects"`
+}
+
+// Get the STIX 2.1 bundle of the observations. Each observation is the observed
+// data that refers the cyber-observable objects, and the attacker IPs, the URLs
+// and the file hashes are also the indicators based on the observed data.
+func STIX(observations []*Observation) *Bundle {
+	b := &stixBuilder{index: map[string]int{}}
+
+	identity := Object{
+		"type":           "identity",
+		"spec_version":   specVersion,
+		"id":             "identity--" + uuid5(zoeNamespace, "identity"),
+		"created":        formatTime(identityCreated),
+		"modified":       formatTime(identityCreated),
+		"name":           "zoe honeypot",
+		"identity_class": "system",
+	}
+	b.add(identity)
+
+	for _, observation := range observations {
+		if observation.Empty() {
+			continue
+		}
+
+		var refs []string
+		ref := func(object Object) {
+			refs = append(refs, b.add(object))
+		}
+
+		var indicators []string
+		indicate := func(kind, value, pattern string) {
+			indicators = append(indicators, b.indicator(identity["id"].(string), observation, kind, value, pattern))
+		}
+
+		for _, ip := range observation.IPs {
+			kind := "ipv4-addr"
+			if addr, err := netip.ParseAddr(ip); err == nil && addr.Unmap().Is6() {
+				kind = "ipv6-addr"
+			}
+
+			ref(sco(kind, Object{"value": ip}, "value"))
+			indicate("attacker IP", ip, fmt.Sprintf("[%s:value = '%s']", kind, escapePattern(ip)))
+		}
+
+		for _, credential := range observation.Credentials {
+			// the credential is part of the ID, or all the passwords of the user share the ID
+			ref(sco("user-account", Object{
+				"account_type":  "unix",
+				"account_login": credential.Username,
+				"credential":    credential.Password,
+			}, "account_type", "account_login", "credential"))
+		}
+
+		for _, fingerprint := range observation.Fingerprints {
+			ref(sco("user-account", Object{
+				"account_type":              "unix",
+				"account_login":             fingerprint.Username,
+				"x_zoe_ssh_key_type":        fingerprint.KeyType,
+				"x_zoe_ssh_key_fingerprint": fingerprint.Fingerprint,
+			}, "account_type", "account_login", "x_zoe_ssh_key_fingerprint"))
+		}
+
+		for _, url := range observation.URLs {
+			ref(sco("url", Object{"value": url}, "value"))
+			indicate("download URL", url, fmt.Sprintf("[url:value = '%s']", escapePattern(url)))
+		}
+
+		for _, file := range observation.Files {
+			// the hashes must not be empty when present
+			object := Object{}
+			if len(file.Hashes) > 0 {
+				object["hashes"] = file.Hashes
+			}
+			if file.Name != "" {
+				object["name"] = file.Name
+			}
+			ref(sco("file", object, "hashes", "name"))
+
+			for _, algorithm := range []string{"SHA-256", "SHA-1", "MD5"} {
+				if hash, ok := file.Hashes[algorithm]; ok {
+					indicate("file hash", hash, fmt.Sprintf("[file:hashes.'%s' = '%s']", algorithm, escapePattern(hash)))
+					break
+				}
+			}
+		}
+
+		for _, version := range observation.ClientVersions {
+			ref(sco("software", Object{"name": version}, "name"))
+		}
+
+		observed := Object{
+			"type":            "observed-data",
+			"spec_version":    specVersion,
+			"id":              "observed-data--" + uuid5(zoeNamespace, string(observation.Group)+":"+observation.Key),
+			"created_by_ref":  identity["id"],
+			"created":         formatTime(observation.LastSeen),
+			"modified":        formatTime(observation.LastSeen),
+			"first_observed":  formatTime(observation.FirstSeen),
+			"last_observed":   formatTime(observation.LastSeen),
+			"number_observed": max(1, min(observation.Events, 999999999)),
+			"object_refs":     refs,
+			"labels":          []string{"honeypot", fmt.Sprintf("%s:%s", observation.Group, observation.Key)},
+		}
+		b.add(observed)
+
+		for _, indicator := range indicators {
+			b.add(Object{
+				"type":              "relationship",
+				"spec_version":      specVersion,
+				"id":                "relationship--" + uuid5(zoeNamespace, indicator+":based-on:"+observed["id"].(string)),
+				"created_by_ref":    identity["id"],
+				"created":           observed["created"],
+				"modified":          observed["modified"],
+				"relationship_type": "based-on",
+				"source_ref":        indicator,
+				"target_ref":        observed["id"],
+			})
+		}
+	}
+
+	return &Bundle{Type: "bundle", ID: "bundle--" + uuid4(), Objects: b.objects}
+}
+
+// the builder of the bundle, the same object is added once.
+type stixBuilder struct {
+	objects []Object
+	index   map[string]int
+}
+
+// add the object, or skip when added, and get the ID.
+func (b *stixBuilder) add(object Object) string {
+	id := object["id"].(string)
+	if _, ok := b.index[id]; !ok {
+		b.index[id] = len(b.objects)
+		b.objects = append(b.objects, object)
+	}
+
+	return id
+}
+
+// add the indicator of the pattern or extend the valid time of the added one, and
+// get the ID.
+func (b *stixBuilder) indicator(createdBy string, observation *Observation, kind, value, pattern string) string {
+	id := "indicator--" + uuid5(zoeNamespace, pattern)
+
+	if index, ok := b.index[id]; ok {
+		indicator := b.objects[index]
+		if formatTime(observation.FirstSeen) < indicator["valid_from"].(string) {
+			indicator["valid_from"] = formatTime(observation.FirstSeen)
+			indicator["created"] = formatTime(observation.FirstSeen)
+		}
+		if formatTime(observation.LastSeen) > indicator["modified"].(string) {
+			indicator["modified"] = formatTime(observation.LastSeen)
+		}
+		return id
+	}
+
+	return b.add(Object{
+		"type":            "indicator",
+		"spec_version":    specVersion,
+		"id":              id,
+		"created_by_ref":  createdBy,
+		"created":         formatTime(observation.FirstSeen),
+		"modified":        formatTime(observation.LastSeen),
+		"name":            fmt.Sprintf("Honeypot %s %s", kind, value),
+		"indicator_types": []string{"malicious-activity"},
+		"pattern":         pattern,
+		"pattern_type":    "stix",
+		"valid_from":      formatTime(observation.FirstSeen),
+		"labels":          []string{"honeypot"},
+	})
+}
+
+// create the cyber-observable object with the deterministic ID from the ID
+// contributing properties.
+func sco(kind string, object Object, contributing ...string) Object {
+	properties := map[string]any{}
+	for _, key := range contributing {
+		if value, ok := object[key]; ok {
+			properties[key] = value
+		}
+	}
+
+	object["type"] = kind
+	object["spec_version"] = specVersion
+	object["id"] = kind + "--" + uuid5(scoNamespace, canonicalJSON(properties))
+	return object
+}
+
+// get the canonical JSON of the properties, the keys are sorted and the HTML
+// characters are not escaped.
+func canonicalJSON(value any) string {
+	var buff bytes.Buffer
+
+	encoder := json.NewEncoder(&buff)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		// the properties are always the strings
+		panic(err)
+	}
+
+	return strings.TrimSuffix(buff.String(), "\n")
+}
+
+// escape the quote and the backslash of the string in the STIX pattern.
+func escapePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(stixTime)
+}
+
+// get the UUIDv5 of the name in the namespace.
+func uuid5(namespace [16]byte, name string) string {
+	hash := sha1.New()
+	hash.Write(namespace[:])
+	hash.Write([]byte(name))
+
+	var uuid [16]byte
+	copy(uuid[:], hash.Sum(nil))
+	uuid[6] = (uuid[6] & 0x0f) | 0x50
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return formatUUID(uuid)
+}
+
+// get the random UUIDv4.
+func uuid4() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(err)
+	}
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return formatUUID(uuid)
+}
+
+func formatUUID(uuid [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+func mustParseUUID(value string) [16]byte {
+	var uuid [16]byte
+
+	data, err := hex.DecodeString(strings.ReplaceAll(value, "-", ""))
+	if err != nil || len(data) != len(uuid) {
+		panic(fmt.Sprintf("invalid UUID: %s", value))
+	}
+
+	copy(uuid[:], data)
+	return uuid
+}
@@ -0,0 +1,87 @@
+package intel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validate the STIX 2.1 bundle offline, by the embedded STIX 2.1 JSON schemas of
+// the bundle and the object types exported by zoe, and by the constraints beyond
+// the schemas: the references resolved in the bundle and the order of the
+// timestamps. All the errors are joined.
+func Validate(data []byte) error {
+	documents, err := loadSchemas()
+	if err != nil {
+		return fmt.Errorf("failed to load the STIX schemas: %w", err)
+	}
+
+	var bundle any
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	v := &schemaValidator{documents: documents}
+	errs := v.validate(bundleSchema, documents[bundleSchema], bundle, "bundle")
+
+	envelope, _ := bundle.(map[string]any)
+	objects, _ := envelope["objects"].([]any)
+
+	ids := map[string]bool{}
+	for _, object := range objects {
+		if object, ok := object.(map[string]any); ok {
+			if id, ok := object["id"].(string); ok {
+				ids[id] = true
+			}
+		}
+	}
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	for index, object := range objects {
+		object, ok := object.(map[string]any)
+		if !ok {
+			// reported by the schema of the bundle
+			continue
+		}
+
+		kind, _ := object["type"].(string)
+		name := fmt.Sprintf("objects[%d]", index)
+
+		schema, known := objectSchemas[kind]
+		check(known, "%s: unsupported type %q", name, kind)
+		if known {
+			errs = append(errs, v.validate(schema, documents[schema], object, name)...)
+		}
+
+		for property, value := range object {
+			switch {
+			case strings.HasSuffix(property, "_ref"):
+				check(ids[fmt.Sprint(value)], "%s: unresolved reference %s=%v", name, property, value)
+			case strings.HasSuffix(property, "_refs"):
+				refs, _ := value.([]any)
+				for _, ref := range refs {
+					check(ids[fmt.Sprint(ref)], "%s: unresolved reference in %s: %v", name, property, ref)
+				}
+			}
+		}
+
+		check(!after(object["first_observed"], object["last_observed"]), "%s: the first_observed is after the last_observed", name)
+		check(!after(object["created"], object["modified"]), "%s: the created is after the modified", name)
+	}
+
+	return errors.Join(errs...)
+}
+
+// check the timestamp a is after the timestamp b, false when invalid.
+func after(a, b any) bool {
+	ta, errA := time.Parse(time.RFC3339Nano, fmt.Sprint(a))
+	tb, errB := time.Parse(time.RFC3339Nano, fmt.Sprint(b))
+	return errA == nil && errB == nil && ta.After(tb)
+}
@@ -0,0 +1,392 @@
+package intel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The known-good STIX 2.1 bundle of every object type exported by zoe.
+const goodBundle = `{
+  "type": "bundle",
+  "id": "bundle--5d0092c5-5f74-4287-9642-33f4c354e56d",
+  "objects": [
+    {
+      "type": "identity",
+      "spec_version": "2.1",
+      "id": "identity--311b2d2d-f010-4473-83ec-1edf84858f4c",
+      "created": "2024-01-01T00:00:00.000Z",
+      "modified": "2024-01-01T00:00:00.000Z",
+      "name": "zoe honeypot",
+      "identity_class": "system"
+    },
+    {
+      "type": "ipv4-addr",
+      "spec_version": "2.1",
+      "id": "ipv4-addr--ff26c055-6336-5bc5-b98d-13d6226742dd",
+      "value": "192.0.2.1"
+    },
+    {
+      "type": "ipv6-addr",
+      "spec_version": "2.1",
+      "id": "ipv6-addr--1e61d36c-a16c-53b7-a80f-2a00161c96b1",
+      "value": "2001:db8::1"
+    },
+    {
+      "type": "url",
+      "spec_version": "2.1",
+      "id": "url--c1477287-23ac-5971-a010-5c287877fa60",
+      "value": "http://203.0.113.1/x.sh"
+    },
+    {
+      "type": "file",
+      "spec_version": "2.1",
+      "id": "file--fb0419a8-f09c-57f8-be64-71a80417591c",
+      "name": "x.sh",
+      "hashes": {"SHA-256": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}
+    },
+    {
+      "type": "user-account",
+      "spec_version": "2.1",
+      "id": "user-account--0d5b424b-93b8-5cd8-ac36-306e1789d63c",
+      "account_type": "unix",
+      "account_login": "root",
+      "credential": "123456",
+      "x_zoe_ssh_key_fingerprint": "SHA256:abc"
+    },
+    {
+      "type": "software",
+      "spec_version": "2.1",
+      "id": "software--a1827f6d-ca53-5605-9e93-4316cd22a00a",
+      "name": "SSH-2.0-Go"
+    },
+    {
+      "type": "observed-data",
+      "spec_version": "2.1",
+      "id": "observed-data--b67d30ff-02ac-498a-92f9-32f845f448cf",
+      "created_by_ref": "identity--311b2d2d-f010-4473-83ec-1edf84858f4c",
+      "created": "2024-01-02T03:04:05.000Z",
+      "modified": "2024-01-02T03:04:05.000Z",
+      "first_observed": "2024-01-02T03:00:00.000Z",
+      "last_observed": "2024-01-02T03:04:05.000Z",
+      "number_observed": 3,
+      "object_refs": [
+        "ipv4-addr--ff26c055-6336-5bc5-b98d-13d6226742dd",
+        "ipv6-addr--1e61d36c-a16c-53b7-a80f-2a00161c96b1",
+        "url--c1477287-23ac-5971-a010-5c287877fa60",
+        "file--fb0419a8-f09c-57f8-be64-71a80417591c",
+        "user-account--0d5b424b-93b8-5cd8-ac36-306e1789d63c",
+        "software--a1827f6d-ca53-5605-9e93-4316cd22a00a"
+      ],
+      "labels": ["honeypot"]
+    },
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+      "created_by_ref": "identity--311b2d2d-f010-4473-83ec-1edf84858f4c",
+      "created": "2024-01-02T03:00:00.000Z",
+      "modified": "2024-01-02T03:04:05.000Z",
+      "name": "Honeypot download URL http://203.0.113.1/x.sh",
+      "indicator_types": ["malicious-activity"],
+      "pattern": "[url:value = 'http://203.0.113.1/x.sh']",
+      "pattern_type": "stix",
+      "valid_from": "2024-01-02T03:00:00.000Z"
+    },
+    {
+      "type": "relationship",
+      "spec_version": "2.1",
+      "id": "relationship--44298a74-ba52-4f0c-87a3-1824e67d7fad",
+      "created": "2024-01-02T03:04:05.000Z",
+      "modified": "2024-01-02T03:04:05.000Z",
+      "relationship_type": "based-on",
+      "source_ref": "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+      "target_ref": "observed-data--b67d30ff-02ac-498a-92f9-32f845f448cf"
+    }
+  ]
+}`
+
+func TestValidate(t *testing.T) {
+	// the index of the objects in the good bundle
+	const (
+		identity = iota
+		ipv4
+		_
+		url
+		file
+		account
+		_
+		observed
+		indicator
+		relationship
+	)
+
+	cases := []struct {
+		name string
+		// mutate the good bundle, nil keeps it valid
+		mutate func(bundle map[string]any, objects []map[string]any)
+		// the error contains the message
+		message string
+	}{
+		{name: "good"},
+		{
+			name:    "bundle type",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { bundle["type"] = "collection" },
+			message: `bundle.type: expect bundle`,
+		},
+		{
+			name: "bundle id",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				bundle["id"] = "identity--5d0092c5-5f74-4287-9642-33f4c354e56d"
+			},
+			message: `bundle.id: "identity--5d0092c5-5f74-4287-9642-33f4c354e56d" does not match the pattern "^bundle--"`,
+		},
+		{
+			name:    "spec version",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[identity]["spec_version"] = "2.0" },
+			message: `objects[0].spec_version: expect one of [2.1], got 2.0`,
+		},
+		{
+			name: "created without milliseconds",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[identity]["created"] = "2024-01-01T00:00:00Z"
+			},
+			message: `objects[0].created: "2024-01-01T00:00:00Z" does not match the pattern`,
+		},
+		{
+			name:    "missing name",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { delete(objects[identity], "name") },
+			message: `objects[0]: missing the required property "name"`,
+		},
+		{
+			name: "id of the other type",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[ipv4]["id"] = "ipv6-addr--ff26c055-6336-5bc5-b98d-13d6226742dd"
+			},
+			message: `objects[1].id: "ipv6-addr--ff26c055-6336-5bc5-b98d-13d6226742dd" does not match the pattern "^ipv4-addr--"`,
+		},
+		{
+			name:    "invalid UUID",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[url]["id"] = "url--not-a-uuid" },
+			message: `objects[3].id: "url--not-a-uuid" does not match the pattern`,
+		},
+		{
+			name:    "missing value",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { delete(objects[url], "value") },
+			message: `objects[3]: missing the required property "value"`,
+		},
+		{
+			name:    "empty hashes",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[file]["hashes"] = map[string]any{} },
+			message: `objects[4].hashes: expect at least 1 properties, got 0`,
+		},
+		{
+			name: "invalid hash",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[file]["hashes"] = map[string]any{"SHA-256": "abc"}
+			},
+			message: `objects[4].hashes.SHA-256: "abc" does not match the pattern`,
+		},
+		{
+			name: "file without hashes and name",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				delete(objects[file], "hashes")
+				delete(objects[file], "name")
+			},
+			message: `objects[4]: does not match any of the schemas`,
+		},
+		{
+			name:    "invalid property name",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[account]["x-zoe"] = "value" },
+			message: `objects[5]: the property "x-zoe" is not allowed`,
+		},
+		{
+			name:    "number observed",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[observed]["number_observed"] = 0 },
+			message: `objects[7].number_observed: expect at least 1, got 0`,
+		},
+		{
+			name:    "fractional number observed",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[observed]["number_observed"] = 1.5 },
+			message: `objects[7].number_observed: expect the type integer, got number`,
+		},
+		{
+			name:    "empty object refs",
+			mutate:  func(bundle map[string]any, objects []map[string]any) { objects[observed]["object_refs"] = []any{} },
+			message: `objects[7].object_refs: expect at least 1 items, got 0`,
+		},
+		{
+			name: "observed backwards",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[observed]["first_observed"] = "2024-01-02T04:00:00.000Z"
+			},
+			message: `objects[7]: the first_observed is after the last_observed`,
+		},
+		{
+			name: "invalid pattern",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[indicator]["pattern"] = "url:value = 'x'"
+			},
+			message: `objects[8].pattern: "url:value = 'x'" does not match the pattern`,
+		},
+		{
+			name: "modified before created",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[indicator]["modified"] = "2024-01-01T00:00:00.000Z"
+			},
+			message: `objects[8]: the created is after the modified`,
+		},
+		{
+			name: "unresolved reference",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[relationship]["target_ref"] = "observed-data--00000000-0000-4000-8000-000000000000"
+			},
+			message: `objects[9]: unresolved reference target_ref=observed-data--00000000-0000-4000-8000-000000000000`,
+		},
+		{
+			name: "unsupported type",
+			mutate: func(bundle map[string]any, objects []map[string]any) {
+				objects[relationship]["type"] = "sighting"
+			},
+			message: `objects[9]: unsupported type "sighting"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var bundle map[string]any
+			if err := json.Unmarshal([]byte(goodBundle), &bundle); err != nil {
+				t.Fatalf("failed to parse the good bundle: %v", err)
+			}
+
+			if c.mutate != nil {
+				var objects []map[string]any
+				for _, object := range bundle["objects"].([]any) {
+					objects = append(objects, object.(map[string]any))
+				}
+				c.mutate(bundle, objects)
+			}
+
+			data, err := json.Marshal(bundle)
+			if err != nil {
+				t.Fatalf("failed to encode the bundle: %v", err)
+			}
+
+			err = Validate(data)
+			switch {
+			case c.message == "" && err != nil:
+				t.Errorf("expect the valid bundle, got %v", err)
+			case c.message != "" && err == nil:
+				t.Errorf("expect the error %q, got nothing", c.message)
+			case c.message != "" && !strings.Contains(err.Error(), c.message):
+				t.Errorf("expect the error %q, got %v", c.message, err)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	for _, data := range []string{"", "{", `[]`, `{"type": "bundle"}`} {
+		if err := Validate([]byte(data)); err == nil {
+			t.Errorf("expect %q invalid", data)
+		}
+	}
+}
+
+func TestSTIX(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	session, username, password := "s-1", "root", "123456"
+	events := []*types.Event{
+		{CreatedAt: now, Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.1", Session: &session, Payload: map[string]any{"client_version": "SSH-2.0-Go"}},
+		{CreatedAt: now, Type: types.EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Session: &session, Username: &username, Password: &password},
+		{CreatedAt: now, Type: types.EventAuthPublicKey, Protocol: "ssh", SrcIP: "2001:db8::1", Session: &session, Username: &username, Payload: map[string]any{"key_type": "ssh-ed25519", "fingerprint": "SHA256:abc"}},
+		// the download is not fetched, so only the URL is known
+		{CreatedAt: now, Type: types.EventDownload, Protocol: "ssh", SrcIP: "192.0.2.1", Session: &session, Payload: map[string]any{"url": "http://203.0.113.1/a.sh", "filename": "/tmp/a.sh"}},
+		{CreatedAt: now.Add(time.Second), Type: types.EventDownload, Protocol: "ssh", SrcIP: "192.0.2.1", Session: &session, Payload: map[string]any{
+			"url":      "http://203.0.113.1/x.sh",
+			"filename": "/tmp/x.sh",
+			"sha256":   "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			"size":     3,
+		}},
+	}
+
+	observation := &Observation{Key: session, Group: GroupSession, FirstSeen: now, LastSeen: now}
+	for _, event := range events {
+		observation.add(event)
+	}
+
+	data, err := json.Marshal(STIX([]*Observation{observation}))
+	if err != nil {
+		t.Fatalf("failed to encode the bundle: %v", err)
+	}
+
+	if err := Validate(data); err != nil {
+		t.Fatalf("expect the valid bundle, got %v", err)
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("failed to parse the bundle: %v", err)
+	}
+
+	patterns := map[string]bool{}
+	files := 0
+	for _, object := range bundle.Objects {
+		switch object["type"] {
+		case "indicator":
+			patterns[object["pattern"].(string)] = true
+		case "file":
+			files++
+			if hashes, ok := object["hashes"].(map[string]any); !ok || len(hashes) == 0 || object["name"] != "x.sh" {
+				t.Errorf("expect the file with the hashes and the name, got %v", object)
+			}
+		}
+	}
+
+	expect := []string{
+		"[ipv4-addr:value = '192.0.2.1']",
+		"[ipv6-addr:value = '2001:db8::1']",
+		"[url:value = 'http://203.0.113.1/a.sh']",
+		"[url:value = 'http://203.0.113.1/x.sh']",
+		"[file:hashes.'SHA-256' = 'ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad']",
+	}
+	for _, pattern := range expect {
+		if !patterns[pattern] {
+			t.Errorf("expect the indicator %s, got %v", pattern, patterns)
+		}
+	}
+
+	if len(patterns) != len(expect) || files != 1 {
+		t.Errorf("expect %d indicators and 1 file, got %v and %d files", len(expect), patterns, files)
+	}
+}
+
+func TestSTIXFileWithoutHashes(t *testing.T) {
+	observation := &Observation{
+		Key:       "2024-01-02",
+		Group:     GroupDay,
+		FirstSeen: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		LastSeen:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Events:    1,
+		Files:     []File{{Name: "x.sh"}},
+	}
+
+	bundle := STIX([]*Observation{observation})
+	for _, object := range bundle.Objects {
+		if _, ok := object["hashes"]; ok && object["type"] == "file" {
+			t.Errorf("expect no empty hashes, got %v", object)
+		}
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("failed to encode the bundle: %v", err)
+	}
+
+	if err := Validate(data); err != nil {
+		t.Errorf("expect the valid bundle, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// The Prometheus metrics of the honeypot, exposed on the /metrics of the monitor.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "zoe"
+
+var (
+	// The registry of the metrics, with the Go runtime and the process metrics.
+	registry = prometheus.NewRegistry()
+
+	// The connections finished the handshake (accepted) or rejected by the
+	// authentication, per service.
+	Connections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_total",
+		Help:      "The number of the connections by the result, accepted or rejected.",
+	}, []string{"service", "result"})
+
+	// The handshake failed by the reason other than the authentication, like the
+	// scanner closes the connection after getting the banner.
+	HandshakeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handshake_failures_total",
+		Help:      "The number of the failed handshakes, except the rejected authentication.",
+	}, []string{"service"})
+
+	// The authentication attempts by the method and the outcome.
+	AuthAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_attempts_total",
+		Help:      "The number of the authentication attempts by the method and the outcome.",
+	}, []string{"service", "method", "outcome"})
+
+	// The sessions in progress.
+	ActiveSessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "The number of the sessions in progress.",
+	}, []string{"service"})
+
+	// The commands executed in the fake shell.
+	Commands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "The number of the executed commands.",
+	}, []string{"service"})
+
+	// The latency of writing the batch of the events into the database.
+	DBWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "The latency of writing the batch of the events into the database.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	// The alerts sent to the webhooks by the result, sent, failed or dropped.
+	Alerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_total",
+		Help:      "The number of the alerts by the webhook and the result, sent, failed or dropped.",
+	}, []string{"webhook", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Connections,
+		HandshakeFailures,
+		AuthAttempts,
+		ActiveSessions,
+		Commands,
+		DBWriteDuration,
+		Alerts,
+	)
+}
+
+// Register the extra collectors, like the metrics of the event pipeline.
+func Register(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			// the collector may be registered twice in the same process
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				panic(err)
+			}
+		}
+	}
+}
+
+// Get the HTTP handler that exposes the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Get the name of the metric in the namespace, like zoe_event_queue_depth.
+func Name(name string) string {
+	return prometheus.BuildFQName(namespace, "", name)
+}
@@ -0,0 +1,273 @@
+// The authentication and the authorization of the monitor HTTP API.
+//
+// The API tokens are static and loaded from the configuration, only the SHA-256
+// of the token is stored at rest. Each token owns one role, and the request
+// without the token gets the anonymous role.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// The prefix of the hashed token in the configuration.
+	hashPrefix = "sha256:"
+	// The query parameter of the token, for the clients that cannot set the
+	// header, like the EventSource and the WebSocket of the browser.
+	tokenQuery = "access_token"
+	// The keys of the authenticated token in the gin context.
+	roleKey  = "zoe.role"
+	tokenKey = "zoe.token"
+)
+
+// The role of the API access, the higher role has all the access of the lower.
+type Role string
+
+const (
+	// No access, used as the anonymous role to require the token for all the API.
+	RoleNone Role = "none"
+	// Read the sanitized aggregates, like the popular reports without the passwords.
+	RolePublic Role = "public"
+	// Read the raw events, the sessions and the custom reports.
+	RoleAnalyst Role = "analyst"
+)
+
+// Get the level of the role, the unknown role has no access.
+func (r Role) level() int {
+	switch r {
+	case RolePublic:
+		return 1
+	case RoleAnalyst:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Check the role has the access of the required role.
+func (r Role) Allow(required Role) bool {
+	return r.level() >= required.level()
+}
+
+// The API token in the configuration, the hash is the SHA-256 of the token as
+// sha256:<hex>, generated by the `zoe token` command.
+type Token struct {
+	Name string `mapstructure:"name"`
+	Hash string `mapstructure:"hash"`
+	Role Role   `mapstructure:"role"`
+
+	digest []byte
+}
+
+// The authenticator of the HTTP API, holds the tokens and the audit log.
+type Auth struct {
+	tokens    []*Token
+	anonymous Role
+
+	audit  zerolog.Logger
+	closer io.Closer
+}
+
+// Create the authenticator by the tokens, the anonymous role and the audit log
+// file. The audit log is written to the application log when the file is empty.
+func New(tokens []Token, anonymous Role, audit string) *Auth {
+	a := &Auth{anonymous: anonymous}
+
+	switch anonymous {
+	case RoleNone, RolePublic:
+	case RoleAnalyst:
+		log.Warn().Msg("the anonymous request can read the raw events, set the anonymous role to public or none")
+	default:
+		log.Warn().Str("role", string(anonymous)).Msg("unknown anonymous role, fallback to none")
+		a.anonymous = RoleNone
+	}
+
+	for _, token := range tokens {
+		digest, err := hex.DecodeString(strings.TrimPrefix(token.Hash, hashPrefix))
+		switch {
+		case token.Name == "":
+			log.Warn().Msg("skip the API token without the name")
+			continue
+		case err != nil || len(digest) != sha256.Size:
+			log.Warn().Str("name", token.Name).Msg("skip the API token with the invalid SHA-256 hash")
+			continue
+		case token.Role.level() == 0:
+			log.Warn().Str("name", token.Name).Str("role", string(token.Role)).Msg("skip the API token with the unknown role")
+			continue
+		}
+
+		a.tokens = append(a.tokens, &Token{Name: token.Name, Role: token.Role, digest: digest})
+	}
+
+	switch audit {
+	case "":
+		// the audit log is always written, except the quiet mode
+		a.audit = log.Logger.With().Str("log", "audit").Logger()
+	default:
+		file, err := os.OpenFile(audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Warn().Err(err).Str("path", audit).Msg("failed to open the audit log, fallback to the application log")
+			a.audit = log.Logger.With().Str("log", "audit").Logger()
+			break
+		}
+
+		a.audit = zerolog.New(file).With().Timestamp().Logger()
+		a.closer = file
+	}
+
+	log.Info().Int("tokens", len(a.tokens)).Str("anonymous", string(a.anonymous)).Msg("setup the API authentication")
+	return a
+}
+
+// Close the audit log file.
+func (a *Auth) Close() {
+	if a.closer == nil {
+		return
+	}
+
+	if err := a.closer.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close the audit log")
+	}
+}
+
+// The middleware that authenticates the request and writes the audit log after
+// the request is done. The request with the invalid token is rejected, and the
+// request without the token gets the anonymous role.
+func (a *Auth) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+
+		name, role := "anonymous", a.anonymous
+		switch secret := extractToken(ctx); secret {
+		case "":
+		default:
+			token := a.lookup(secret)
+			if token == nil {
+				name, role = "invalid", RoleNone
+				ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API token"})
+				break
+			}
+
+			name, role = token.Name, token.Role
+		}
+
+		ctx.Set(tokenKey, name)
+		ctx.Set(roleKey, role)
+		if !ctx.IsAborted() {
+			ctx.Next()
+		}
+
+		a.audit.WithLevel(zerolog.NoLevel).
+			Str("token", name).
+			Str("role", string(role)).
+			Str("client_ip", ctx.ClientIP()).
+			Str("method", ctx.Request.Method).
+			Str("path", ctx.Request.URL.Path).
+			Str("query", ctx.Request.URL.RawQuery).
+			Int("status", ctx.Writer.Status()).
+			Int("size", ctx.Writer.Size()).
+			Dur("latency", time.Since(started)).
+			Str("user_agent", ctx.Request.UserAgent()).
+			Msg("API access")
+	}
+}
+
+// The middleware that requires the role, response 401 for the anonymous request
+// and 403 for the token without the access.
+func Require(required Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch role := RoleOf(ctx); {
+		case role.Allow(required):
+			ctx.Next()
+		case TokenOf(ctx) == "anonymous":
+			ctx.Header("WWW-Authenticate", `Bearer realm="zoe"`)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "the API token is required"})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("the %s role is required", required)})
+		}
+	}
+}
+
+// Get the role of the authenticated request.
+func RoleOf(ctx *gin.Context) Role {
+	if role, ok := ctx.Get(roleKey); ok {
+		return role.(Role)
+	}
+
+	return RoleNone
+}
+
+// Get the name of the token of the authenticated request, or anonymous.
+func TokenOf(ctx *gin.Context) string {
+	if name, ok := ctx.Get(tokenKey); ok {
+		return name.(string)
+	}
+
+	return "anonymous"
+}
+
+// Generate the new random API token and the hash stored in the configuration.
+func Generate() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	token = "zoe_" + base64.RawURLEncoding.EncodeToString(secret)
+	return token, Hash(token), nil
+}
+
+// Get the hash of the API token, stored as sha256:<hex> in the configuration.
+func Hash(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hashPrefix + hex.EncodeToString(digest[:])
+}
+
+// lookup the token by the secret, compare all the tokens in the constant time.
+func (a *Auth) lookup(secret string) *Token {
+	digest := sha256.Sum256([]byte(secret))
+
+	var found *Token
+	for _, token := range a.tokens {
+		if subtle.ConstantTimeCompare(token.digest, digest[:]) == 1 {
+			found = token
+		}
+	}
+
+	return found
+}
+
+// extract the token from the Authorization header or the access_token query. The
+// query is removed from the URL, so the token is never written to the logs.
+func extractToken(ctx *gin.Context) string {
+	if header := ctx.GetHeader("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	query := ctx.Request.URL.Query()
+	token := query.Get(tokenQuery)
+	if query.Has(tokenQuery) {
+		query.Del(tokenQuery)
+		ctx.Request.URL.RawQuery = query.Encode()
+	}
+
+	return token
+}
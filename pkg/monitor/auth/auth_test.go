@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRole(t *testing.T) {
+	cases := []struct {
+		role     Role
+		required Role
+		allow    bool
+	}{
+		{role: RoleNone, required: RoleNone, allow: true},
+		{role: RoleNone, required: RolePublic},
+		{role: RolePublic, required: RolePublic, allow: true},
+		{role: RolePublic, required: RoleAnalyst},
+		{role: RoleAnalyst, required: RolePublic, allow: true},
+		{role: RoleAnalyst, required: RoleAnalyst, allow: true},
+		{role: "admin", required: RolePublic},
+	}
+
+	for _, c := range cases {
+		if allow := c.role.Allow(c.required); allow != c.allow {
+			t.Errorf("expect %s allow %s=%t, got %t", c.role, c.required, c.allow, allow)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, hash, err := Generate()
+	if err != nil {
+		t.Fatalf("failed to generate the token: %v", err)
+	}
+
+	a := New([]Token{
+		{Name: "alice", Hash: hash, Role: RoleAnalyst},
+		{Hash: hash, Role: RoleAnalyst},
+		{Name: "short", Hash: "sha256:abcd", Role: RoleAnalyst},
+		{Name: "hex", Hash: "sha256:" + strings.Repeat("z", 64), Role: RoleAnalyst},
+		{Name: "admin", Hash: hash, Role: "admin"},
+	}, "admin", "")
+	defer a.Close()
+
+	switch {
+	case len(a.tokens) != 1 || a.tokens[0].Name != "alice":
+		t.Errorf("expect only the valid token loaded, got %d", len(a.tokens))
+	case a.anonymous != RoleNone:
+		t.Errorf("expect the unknown anonymous role fallback to none, got %s", a.anonymous)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	analyst, analystHash, _ := Generate()
+	public, publicHash, _ := Generate()
+	tokens := []Token{
+		{Name: "alice", Hash: analystHash, Role: RoleAnalyst},
+		{Name: "grafana", Hash: publicHash, Role: RolePublic},
+	}
+
+	cases := []struct {
+		name      string
+		anonymous Role
+		path      string
+		header    string
+		query     string
+		status    int
+		token     string
+		role      Role
+	}{
+		{name: "anonymous public", anonymous: RolePublic, path: "/public", status: http.StatusOK, token: "anonymous", role: RolePublic},
+		{name: "anonymous analyst", anonymous: RolePublic, path: "/analyst", status: http.StatusUnauthorized, token: "anonymous", role: RolePublic},
+		{name: "anonymous none", anonymous: RoleNone, path: "/public", status: http.StatusUnauthorized, token: "anonymous", role: RoleNone},
+		{name: "analyst", anonymous: RoleNone, path: "/analyst", header: "Bearer " + analyst, status: http.StatusOK, token: "alice", role: RoleAnalyst},
+		{name: "analyst public", anonymous: RoleNone, path: "/public", header: "Bearer " + analyst, status: http.StatusOK, token: "alice", role: RoleAnalyst},
+		{name: "scheme case", anonymous: RoleNone, path: "/analyst", header: "bearer  " + analyst, status: http.StatusOK, token: "alice", role: RoleAnalyst},
+		{name: "lower role", anonymous: RoleNone, path: "/analyst", header: "Bearer " + public, status: http.StatusForbidden, token: "grafana", role: RolePublic},
+		{name: "invalid", anonymous: RolePublic, path: "/public", header: "Bearer zoe_invalid", status: http.StatusUnauthorized, token: "invalid", role: RoleNone},
+		{name: "hash as token", anonymous: RolePublic, path: "/public", header: "Bearer " + analystHash, status: http.StatusUnauthorized, token: "invalid", role: RoleNone},
+		{name: "basic", anonymous: RoleNone, path: "/public", header: "Basic " + analyst, status: http.StatusUnauthorized, token: "anonymous", role: RoleNone},
+		{name: "query", anonymous: RoleNone, path: "/analyst", query: "access_token=" + analyst + "&since=1h", status: http.StatusOK, token: "alice", role: RoleAnalyst},
+		{name: "invalid query", anonymous: RolePublic, path: "/public", query: "access_token=zoe_invalid", status: http.StatusUnauthorized, token: "invalid", role: RoleNone},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			audit := filepath.Join(t.TempDir(), "audit.log")
+			a := New(tokens, c.anonymous, audit)
+
+			var query string
+			engine := gin.New()
+			engine.Use(a.Middleware())
+			handler := func(ctx *gin.Context) {
+				query = ctx.Request.URL.RawQuery
+				ctx.String(http.StatusOK, "%s %s", TokenOf(ctx), RoleOf(ctx))
+			}
+			engine.GET("/public", Require(RolePublic), handler)
+			engine.GET("/analyst", Require(RoleAnalyst), handler)
+
+			target := c.path
+			if c.query != "" {
+				target += "?" + c.query
+			}
+
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			switch {
+			case recorder.Code != c.status:
+				t.Fatalf("expect %d, got %d: %s", c.status, recorder.Code, recorder.Body.String())
+			case c.status == http.StatusOK && recorder.Body.String() != string(c.token)+" "+string(c.role):
+				t.Errorf("expect %s %s, got %q", c.token, c.role, recorder.Body.String())
+			case c.status == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "":
+				t.Errorf("expect the WWW-Authenticate of 401")
+			case strings.Contains(query, "access_token"):
+				t.Errorf("expect the token removed from the query, got %q", query)
+			}
+
+			// flush the audit log
+			a.Close()
+			data, err := os.ReadFile(audit)
+			if err != nil {
+				t.Fatalf("failed to read the audit log: %v", err)
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil {
+				t.Fatalf("expect one audit log entry, got %q", data)
+			}
+
+			switch {
+			case entry["token"] != c.token || entry["role"] != string(c.role):
+				t.Errorf("expect the audit of %s %s, got %v", c.token, c.role, entry)
+			case entry["status"] != float64(c.status):
+				t.Errorf("expect the audit status %d, got %v", c.status, entry["status"])
+			case strings.Contains(string(data), analyst) || strings.Contains(string(data), public):
+				t.Errorf("expect no token in the audit log, got %q", data)
+			}
+		})
+	}
+}
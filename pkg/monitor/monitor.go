@@ -2,20 +2,33 @@ package monitor
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/logger"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
+	"github.com/cmj0121/zoe/pkg/metrics"
+	"github.com/cmj0121/zoe/pkg/monitor/auth"
 	"github.com/cmj0121/zoe/pkg/monitor/routes"
+	"github.com/cmj0121/zoe/pkg/types"
 )
 
 // The HTTP server that show the records of the honeypot.
 type Server struct {
-	Bind *string `name:"bind" help:"The address to bind the HTTP server"`
+	Bind      *string `name:"bind" help:"The address to bind the HTTP server"`
+	Templates string  `name:"templates" help:"The directory of the custom report templates, served on /reports/<name>"`
+
+	// The API tokens and the role of the request without the token.
+	Tokens    []auth.Token `kong:"-"`
+	Anonymous auth.Role    `name:"anonymous" enum:"none,public,analyst" default:"public" help:"The role of the request without the API token, one of none, public and analyst"`
+	Audit     string       `name:"audit" help:"The file of the audit log in JSON lines, or the application log when empty"`
 
 	*gin.Engine `kong:"-"`
+	auth        *auth.Auth
 }
 
 func (s *Server) Run(ctx context.Context) {
@@ -24,29 +37,40 @@ func (s *Server) Run(ctx context.Context) {
 		return
 	}
 
-	srv := s.serve()
-	// gracefun shutdown the server
+	s.auth = auth.New(s.Tokens, s.Anonymous, s.Audit)
+	defer s.auth.Close()
+
+	srv := s.serve(ctx)
+	// gracefun shutdown the server, the streams are closed by the cancelled context
 	<-ctx.Done()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal().Err(err).Msg("failed to shutdown the HTTP server")
+
+	timeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(timeout); err != nil {
+		log.Warn().Err(err).Msg("failed to shutdown the HTTP server")
 		return
 	}
 
 	log.Info().Msg("successfully shutdown the HTTP server")
 }
 
-func (s *Server) serve() *http.Server {
+func (s *Server) serve(ctx context.Context) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 
 	s.Engine = gin.New()
 	// setup the middleware
 	s.Engine.Use(gin.Recovery())
+	// authenticate before the logger, the token in the query is never logged
+	s.Engine.Use(s.auth.Middleware())
 	s.Engine.Use(logger.SetLogger())
 	s.register()
 
 	srv := &http.Server{
 		Addr:    *s.Bind,
 		Handler: s.Engine,
+		// the requests are cancelled when shutting down, like the event streams
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
@@ -64,9 +88,35 @@ func (s *Server) serve() *http.Server {
 	return srv
 }
 
-// register the routes of the HTTP server.
+// register the routes of the HTTP server. The public role reads the sanitized
+// aggregates, and the analyst role reads the raw events and the custom reports.
 func (s *Server) register() {
-	s.Engine.GET("/", routes.APIIndex)
-	s.Engine.GET("/messages/daily-popular", routes.MessagePopular)
-	s.Engine.GET("/messages/daily-popular/:field", routes.APIMessagePopular)
+	// the static assets of the dashboard, the data is read from the API by the role
+	s.Engine.StaticFS("/dashboard", routes.Dashboard())
+
+	public := s.Engine.Group("/", auth.Require(auth.RolePublic))
+	public.GET("/", routes.APIIndex)
+	public.GET("/metrics", gin.WrapH(metrics.Handler()))
+	public.GET("/messages/timeline", routes.APITimeline)
+	public.GET("/blocklist", routes.APIBlocklist)
+	for _, period := range []types.Period{types.PeriodDaily, types.PeriodWeekly, types.PeriodMonthly} {
+		public.GET(fmt.Sprintf("/messages/%s-popular", period), routes.MessagePopular(period))
+		public.GET(fmt.Sprintf("/messages/%s-popular/:field", period), routes.APIMessagePopular(period))
+	}
+
+	analyst := s.Engine.Group("/", auth.Require(auth.RoleAnalyst))
+	analyst.GET("/messages", routes.APIMessages)
+	analyst.GET("/events/stream", routes.EventStream)
+	analyst.GET("/events/ws", routes.EventWebSocket)
+	analyst.GET("/sessions", routes.APISessions)
+	analyst.GET("/sessions/:session", routes.APISession)
+	analyst.GET("/export/stix", routes.APIExportSTIX)
+	analyst.GET("/export/misp", routes.APIExportMISP)
+
+	if s.Templates != "" {
+		for name, path := range routes.LoadTemplates(s.Templates) {
+			log.Info().Str("name", name).Str("path", path).Msg("register the custom template")
+			analyst.GET("/reports/"+name, routes.CustomReport(path))
+		}
+	}
 }
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/blocklist"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// Get the blocklist of the source IPs seen in the time range, default is the last
+// 24 hours. The format is one of text (default), cidr, nftables, ipset, fail2ban
+// and json, and the thresholds are set by the min_attempts, logged_in and commands
+// query parameters. The allow query excludes the IPs or the CIDRs, besides the
+// allowlist of the configuration.
+func APIBlocklist(ctx *gin.Context) {
+	r, ok := parseSinceUntil(ctx, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	filter := types.BlocklistFilter{Since: r.Since, Until: r.Until}
+	opts := blocklist.Options{
+		Format: blocklist.Format(ctx.DefaultQuery("format", string(blocklist.FormatText))),
+		Name:   ctx.DefaultQuery("name", "zoe"),
+	}
+
+	if err := opts.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var err error
+	if filter.MinAttempts, err = parseInt(ctx.Query("min_attempts"), 0, 1<<20); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_attempts: " + err.Error()})
+		return
+	}
+	if filter.LoggedIn, err = parseBool(ctx.Query("logged_in")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid logged_in: " + err.Error()})
+		return
+	}
+	if filter.Commands, err = parseBool(ctx.Query("commands")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid commands: " + err.Error()})
+		return
+	}
+	if opts.Prefix4, err = parseInt(ctx.Query("prefix4"), 0, 32); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid prefix4: " + err.Error()})
+		return
+	}
+	if opts.Prefix6, err = parseInt(ctx.Query("prefix6"), 0, 128); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid prefix6: " + err.Error()})
+		return
+	}
+
+	allowlist, err := types.ParseAllowlist(ctx.QueryArray("allow")...)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid allow: " + err.Error()})
+		return
+	}
+	filter.Allowlist = append(blocklist.Allowlist(), allowlist...)
+
+	ips, err := types.Blocklist(ctx, filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buff bytes.Buffer
+	if err := blocklist.Write(&buff, ips, opts); err != nil {
+		log.Debug().Err(err).Msg("failed to write the blocklist")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("zoe-blocklist-%s.txt", opts.Format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	ctx.Data(http.StatusOK, opts.Format.MIME()+"; charset=utf-8", buff.Bytes())
+}
+
+// parse the boolean, the empty value is false.
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIBlocklistName(t *testing.T) {
+	engine := gin.New()
+	engine.GET("/blocklist", APIBlocklist)
+
+	cases := []struct {
+		format string
+		name   string
+		status int
+	}{
+		{format: "nftables", status: http.StatusOK},
+		{format: "nftables", name: "honeypot", status: http.StatusOK},
+		{format: "ipset", name: "honeypot", status: http.StatusOK},
+		{format: "nftables", name: "x\nflush ruleset\n", status: http.StatusBadRequest},
+		{format: "ipset", name: "x; flush", status: http.StatusBadRequest},
+		{format: "text", name: "x y", status: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		query := url.Values{"format": {c.format}}
+		if c.name != "" {
+			query.Set("name", c.name)
+		}
+
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/blocklist?"+query.Encode(), nil))
+		switch {
+		case recorder.Code != c.status:
+			t.Errorf("expect %d of the name %q, got %d: %s", c.status, c.name, recorder.Code, recorder.Body.String())
+		case c.status != http.StatusOK && strings.Contains(recorder.Body.String(), "flush ruleset\n"):
+			t.Errorf("expect no script of the name %q, got %q", c.name, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The name of the custom template, used as the route.
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// The data model exposed to the custom templates, see docs/templates.md.
+type customReport struct {
+	*popularReport
+
+	// The sessions started in the range, with the enrichment of the source IP.
+	Sessions []*types.Session `json:"sessions"`
+}
+
+// Load the custom templates in the directory, return the map of the name and the
+// path. The name is the file name without the extension, like daily.md is daily.
+func LoadTemplates(dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Warn().Err(err).Str("dir", dir).Msg("failed to read the template directory")
+		return nil
+	}
+
+	templates := map[string]string{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+
+		switch {
+		case entry.IsDir():
+		case ext != ".md" && ext != ".html" && ext != ".txt" && ext != ".tmpl":
+			log.Debug().Str("file", entry.Name()).Msg("skip the non-template file")
+		case !templateName.MatchString(name):
+			log.Warn().Str("file", entry.Name()).Msg("invalid template name, skip it")
+		case templates[name] != "":
+			log.Warn().Str("file", entry.Name()).Msg("duplicated template name, skip it")
+		default:
+			templates[name] = filepath.Join(dir, entry.Name())
+		}
+	}
+
+	return templates
+}
+
+// Render the custom template of the operator. The template is parsed on each
+// request, so the change takes effect without restarting. The period is set by
+// the period query and the range by the from, to and tz queries.
+func CustomReport(path string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		period := types.Period(ctx.DefaultQuery("period", string(types.PeriodDaily)))
+		switch period {
+		case types.PeriodDaily, types.PeriodWeekly, types.PeriodMonthly:
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "unsupported period: " + string(period)})
+			return
+		}
+
+		r, ok := parseRange(ctx, period)
+		if !ok {
+			return
+		}
+
+		text, err := os.ReadFile(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("failed to read the template")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read the template"})
+			return
+		}
+
+		report := &customReport{
+			popularReport: newPopularReport(ctx, period, r, true),
+			Sessions:      types.RangeSessions(ctx, r),
+		}
+
+		name := filepath.Base(path)
+		fn := templateFuncs(ctx, r)
+
+		switch filepath.Ext(path) {
+		case ".html":
+			tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(fn)).Parse(string(text))
+			if err != nil {
+				log.Warn().Err(err).Str("path", path).Msg("failed to parse the template")
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			render(ctx, gin.MIMEHTML, tmpl.Execute, report)
+		default:
+			tmpl, err := template.New(name).Funcs(fn).Parse(string(text))
+			if err != nil {
+				log.Warn().Err(err).Str("path", path).Msg("failed to parse the template")
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			mime := gin.MIMEPlain
+			if filepath.Ext(path) == ".md" {
+				mime = mimeMarkdown
+			}
+			render(ctx, mime, tmpl.Execute, report)
+		}
+	}
+}
+
+// get the functions of the templates, both the embedded and the custom ones.
+func templateFuncs(ctx *gin.Context, r types.Range) template.FuncMap {
+	return template.FuncMap{
+		// the escape function for the cell in the markdown table
+		"escapeTable": func(value string) string {
+			value = strings.ReplaceAll(value, "|", "\\|")
+			return strings.ReplaceAll(value, "\n", "<br>")
+		},
+		// get the top N popular values of the field in the range
+		"popular": func(field string, count int) []*types.Report {
+			return types.PopularEvents(ctx, field, r, count)
+		},
+		// get the value of the optional string, or the default value
+		"deref": func(value *string) string {
+			return derefString(value)
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"truncate": func(size int, value string) string {
+			if runes := []rune(value); len(runes) > size {
+				return string(runes[:size]) + "..."
+			}
+			return value
+		},
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"trim":     strings.TrimSpace,
+		"replace":  strings.ReplaceAll,
+		"join":     strings.Join,
+		"contains": strings.Contains,
+		"date": func(layout string, t time.Time) string {
+			return t.In(r.Since.Location()).Format(layout)
+		},
+		// get the total count of the reports
+		"sum": func(reports []*types.Report) int {
+			total := 0
+			for _, report := range reports {
+				total += report.Count
+			}
+			return total
+		},
+		"percent": func(count, total int) string {
+			if total == 0 {
+				return "0.0%"
+			}
+			return fmt.Sprintf("%.1f%%", float64(count)*100/float64(total))
+		},
+		"json": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+}
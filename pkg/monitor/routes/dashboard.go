@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+const (
+	// The maximum number of the buckets in the timeline.
+	maxBuckets = 1000
+	// The maximum number of the events in the session.
+	maxSessionEvents = 1000
+)
+
+//go:embed dashboard
+var dashboard embed.FS
+
+// Get the static assets of the web dashboard, all embedded in the binary.
+func Dashboard() http.FileSystem {
+	assets, err := fs.Sub(dashboard, "dashboard")
+	if err != nil {
+		// the embedded directory always exists
+		panic(err)
+	}
+
+	return http.FS(assets)
+}
+
+// Get the number of the events in the time range, bucketed by the interval. The
+// range is set by the since, until and tz query parameters, default is the last
+// 24 hours, and the interval is hour (default), day or the duration like 15m.
+func APITimeline(ctx *gin.Context) {
+	loc, err := time.LoadLocation(ctx.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz: " + err.Error()})
+		return
+	}
+
+	r, ok := parseSinceUntil(ctx, 24*time.Hour)
+	if !ok {
+		return
+	}
+	r.Since, r.Until = r.Since.In(loc), r.Until.In(loc)
+
+	var interval time.Duration
+	switch value := ctx.DefaultQuery("interval", "hour"); value {
+	case "hour":
+		interval = time.Hour
+	case "day":
+		interval = 24 * time.Hour
+	default:
+		if interval, err = time.ParseDuration(value); err != nil || interval < time.Minute {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval: " + value})
+			return
+		}
+	}
+
+	if r.Until.Sub(r.Since)/interval > maxBuckets {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "too many buckets, use the larger interval"})
+		return
+	}
+
+	timeline, err := types.Timeline(ctx, r, interval)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, timeline)
+}
+
+// Get the sessions started in the time range, from the latest to the oldest. The
+// range is set by the since and until query parameters, default is the last 24 hours.
+func APISessions(ctx *gin.Context) {
+	r, ok := parseSinceUntil(ctx, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	limit, err := parseInt(ctx.DefaultQuery("limit", "100"), 1, 1000)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+		return
+	}
+
+	sessions := types.RangeSessions(ctx, r)
+	slices.Reverse(sessions)
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+
+	if sessions == nil {
+		sessions = []*types.Session{}
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// Get all the events of the session, from the oldest to the latest.
+func APISession(ctx *gin.Context) {
+	filter := types.EventFilter{Session: ctx.Param("session"), Limit: maxSessionEvents}
+
+	page, err := types.QueryEvents(ctx, filter)
+	switch {
+	case err != nil:
+		log.Warn().Err(err).Msg("failed to query the session")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	case len(page.Events) == 0:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	slices.Reverse(page.Events)
+	ctx.JSON(http.StatusOK, page.Events)
+}
+
+// parse the since and until query parameters, default is the last duration until
+// now, response the bad request when failed.
+func parseSinceUntil(ctx *gin.Context, last time.Duration) (types.Range, bool) {
+	var r types.Range
+	var err error
+
+	if r.Since, err = parseTime(ctx.Query("since")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return r, false
+	}
+	if r.Until, err = parseTime(ctx.Query("until")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+		return r, false
+	}
+
+	if r.Until.IsZero() {
+		r.Until = time.Now()
+	}
+	if r.Since.IsZero() {
+		r.Since = r.Until.Add(-last)
+	}
+
+	if !r.Since.Before(r.Until) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "the since must be before the until"})
+		return r, false
+	}
+
+	return r, true
+}
@@ -0,0 +1,448 @@
+// The web dashboard of ZOE, all the data is read from the monitor API.
+"use strict";
+
+(function () {
+  // the API is served on the parent of the dashboard, like /dashboard/ -> /
+  const base = new URL("..", location.href);
+  const eventTypes = ["connect", "auth.password", "auth.publickey", "command", "download", "upload", "forward", "request", "disconnect"];
+  const liveSize = 50;
+  const refreshInterval = 30 * 1000;
+
+  const state = { counters: {}, stream: null, session: null, replay: null, cursor: 0, query: null };
+
+  // ---- helpers ----
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  // create the element with the text children, the text is never parsed as HTML
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    for (const [key, value] of Object.entries(attrs || {})) {
+      if (key === "onclick") {
+        node.addEventListener("click", value);
+      } else {
+        node.setAttribute(key, value);
+      }
+    }
+    for (const child of children) {
+      node.append(child instanceof Node ? child : String(child ?? ""));
+    }
+    return node;
+  }
+
+  function token() {
+    return localStorage.getItem("zoe.token") || "";
+  }
+
+  function url(path, params) {
+    const target = new URL(path, base);
+    for (const [key, value] of Object.entries(params || {})) {
+      if (value !== "" && value !== undefined && value !== null) {
+        target.searchParams.set(key, value);
+      }
+    }
+    return target;
+  }
+
+  // fetch the JSON from the API, the error is raised with the status
+  async function api(path, params) {
+    const headers = { Accept: "application/json" };
+    if (token()) {
+      headers.Authorization = "Bearer " + token();
+    }
+
+    const resp = await fetch(url(path, params), { headers });
+    const body = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+      const error = new Error(body.error || resp.statusText);
+      error.status = resp.status;
+      throw error;
+    }
+    return body;
+  }
+
+  function date(value) {
+    return new Date(value).toISOString().slice(0, 10);
+  }
+
+  function time(value) {
+    return new Date(value).toLocaleString();
+  }
+
+  function duration(since, until) {
+    const seconds = Math.round((new Date(until) - new Date(since)) / 1000);
+    return seconds < 60 ? seconds + "s" : Math.floor(seconds / 60) + "m" + (seconds % 60) + "s";
+  }
+
+  function status(message, error) {
+    $("status").textContent = message;
+    $("status").className = error ? "error" : "muted";
+  }
+
+  // show the error in the table, like the role is not allowed to read it
+  function tableError(table, error) {
+    const message = error.status === 401 || error.status === 403 ? "analyst token required" : error.message;
+    table.replaceChildren(el("tr", {}, el("td", { class: "muted" }, message)));
+  }
+
+  // the range of the dashboard and the interval of the timeline
+  function range() {
+    const until = new Date();
+    switch ($("range").value) {
+      case "7d":
+        return { since: new Date(until - 7 * 864e5), until, interval: "6h" };
+      case "30d":
+        return { since: new Date(until - 30 * 864e5), until, interval: "day" };
+      default:
+        return { since: new Date(until - 864e5), until, interval: "hour" };
+    }
+  }
+
+  function summary(event) {
+    switch (event.type) {
+      case "auth.password":
+        return (event.username || "") + " / " + (event.password || "");
+      case "auth.publickey":
+        return (event.username || "") + " " + ((event.payload || {}).fingerprint || "");
+      case "command":
+        return event.command || "";
+      case "download":
+      case "upload":
+        return (event.payload || {}).url || (event.payload || {}).path || JSON.stringify(event.payload || {});
+      default:
+        return event.payload ? JSON.stringify(event.payload) : "";
+    }
+  }
+
+  function eventRow(event, onclick) {
+    return el("tr", onclick ? { class: "clickable", onclick } : {},
+      el("td", {}, time(event.created_at)),
+      el("td", {}, event.type),
+      el("td", {}, event.protocol),
+      el("td", {}, event.src_ip + (event.country ? " (" + event.country + ")" : "")),
+      el("td", {}, el("code", {}, summary(event))),
+    );
+  }
+
+  function eventHeader() {
+    return el("tr", {}, el("th", {}, "Time"), el("th", {}, "Type"), el("th", {}, "Service"), el("th", {}, "Source"), el("th", {}, "Detail"));
+  }
+
+  // ---- counters and timeline ----
+
+  function setCounter(name, value) {
+    state.counters[name] = value;
+    document.querySelector(`[data-counter="${name}"]`).textContent = value;
+  }
+
+  async function loadTimeline() {
+    const r = range();
+    const tz = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    const timeline = await api("messages/timeline", {
+      since: r.since.toISOString(), until: r.until.toISOString(), interval: r.interval, tz,
+    });
+
+    const total = { events: 0, connects: 0, auths: 0, commands: 0 };
+    for (const bucket of timeline) {
+      for (const key of Object.keys(total)) {
+        total[key] += bucket[key];
+      }
+    }
+    for (const [key, value] of Object.entries(total)) {
+      setCounter(key, value);
+    }
+
+    drawTimeline(timeline);
+  }
+
+  // draw the timeline as the SVG bar chart, the commands overlay the events
+  function drawTimeline(timeline) {
+    const ns = "http://www.w3.org/2000/svg";
+    const width = 1000, height = 200, bottom = 20;
+    const max = Math.max(1, ...timeline.map((bucket) => bucket.events));
+    const step = width / Math.max(1, timeline.length);
+
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("viewBox", `0 0 ${width} ${height}`);
+    svg.setAttribute("preserveAspectRatio", "none");
+
+    timeline.forEach((bucket, index) => {
+      for (const [key, value] of [["events", bucket.events], ["commands", bucket.commands]]) {
+        const h = (value / max) * (height - bottom);
+        const bar = document.createElementNS(ns, "rect");
+        bar.setAttribute("class", key);
+        bar.setAttribute("x", index * step + 1);
+        bar.setAttribute("y", height - bottom - h);
+        bar.setAttribute("width", Math.max(1, step - 2));
+        bar.setAttribute("height", h);
+
+        const title = document.createElementNS(ns, "title");
+        title.textContent = `${time(bucket.time)}: ${bucket.events} events, ${bucket.commands} commands`;
+        bar.append(title);
+        svg.append(bar);
+      }
+    });
+
+    // label the first, the middle and the last bucket
+    for (const index of new Set([0, Math.floor(timeline.length / 2), timeline.length - 1])) {
+      if (!timeline[index]) {
+        continue;
+      }
+      const label = document.createElementNS(ns, "text");
+      label.setAttribute("x", Math.min(index * step, width - 120));
+      label.setAttribute("y", height - 5);
+      label.textContent = time(timeline[index].time);
+      svg.append(label);
+    }
+
+    const peak = document.createElementNS(ns, "text");
+    peak.setAttribute("x", 2);
+    peak.setAttribute("y", 10);
+    peak.textContent = "max " + max;
+    svg.append(peak);
+
+    $("timeline").replaceChildren(svg);
+  }
+
+  async function loadPipeline() {
+    const index = await api("");
+    setCounter("queued", index.pipeline.queued);
+  }
+
+  // ---- top values ----
+
+  async function loadTop(field) {
+    const table = $("top-" + field);
+    const r = range();
+
+    try {
+      const reports = await api("messages/daily-popular/" + field, { from: date(r.since), to: date(r.until) });
+      const rows = reports.map((report) => el("tr", {}, el("td", {}, el("code", {}, report.value)), el("td", { class: "count" }, report.count)));
+      table.replaceChildren(...(rows.length ? rows : [el("tr", {}, el("td", { class: "muted" }, "No record"))]));
+    } catch (error) {
+      tableError(table, error);
+    }
+  }
+
+  // ---- live events ----
+
+  function startStream() {
+    if (state.stream) {
+      state.stream.close();
+      state.stream = null;
+    }
+
+    setCounter("live", "off");
+    $("live").replaceChildren(eventHeader());
+    if (!token()) {
+      $("live").append(el("tr", {}, el("td", { class: "muted", colspan: 5 }, "analyst token required")));
+      return;
+    }
+
+    const stream = new EventSource(url("events/stream", { access_token: token() }));
+    stream.onopen = () => setCounter("live", "on");
+    stream.onerror = () => setCounter("live", "off");
+
+    const onEvent = (message) => {
+      const event = JSON.parse(message.data);
+      setCounter("events", state.counters.events + 1);
+      switch (event.type) {
+        case "connect":
+          setCounter("connects", state.counters.connects + 1);
+          break;
+        case "auth.password":
+        case "auth.publickey":
+          setCounter("auths", state.counters.auths + 1);
+          break;
+        case "command":
+          setCounter("commands", state.counters.commands + 1);
+          break;
+      }
+
+      const row = eventRow(event, event.session ? () => loadSession(event.session) : null);
+      $("live").firstChild.after(row);
+      while ($("live").rows.length > liveSize + 1) {
+        $("live").lastChild.remove();
+      }
+    };
+
+    for (const type of eventTypes) {
+      stream.addEventListener(type, onEvent);
+    }
+    stream.addEventListener("dropped", (message) => status(`dropped ${JSON.parse(message.data).dropped} live events`, true));
+    state.stream = stream;
+  }
+
+  // ---- sessions ----
+
+  async function loadSessions() {
+    const table = $("sessions");
+    const r = range();
+
+    try {
+      const sessions = await api("sessions", { since: r.since.toISOString(), until: r.until.toISOString() });
+      const header = el("tr", {},
+        el("th", {}, "Started"), el("th", {}, "Service"), el("th", {}, "Source"), el("th", {}, "Username"),
+        el("th", {}, "Duration"), el("th", {}, "Events"), el("th", {}, "Commands"),
+      );
+      const rows = sessions.map((session) => el("tr", { class: "clickable", onclick: () => loadSession(session.id) },
+        el("td", {}, time(session.started_at)),
+        el("td", {}, session.service),
+        el("td", {}, session.src_ip + (session.country ? " (" + session.country + ")" : "")),
+        el("td", {}, session.username),
+        el("td", {}, duration(session.started_at, session.ended_at)),
+        el("td", { class: "count" }, session.events),
+        el("td", { class: "count" }, session.commands),
+      ));
+      table.replaceChildren(header, ...rows);
+    } catch (error) {
+      tableError(table, error);
+    }
+  }
+
+  async function loadSession(id) {
+    stopReplay();
+
+    let events;
+    try {
+      events = await api("sessions/" + encodeURIComponent(id));
+    } catch (error) {
+      status(error.message, true);
+      return;
+    }
+
+    state.session = events;
+    const first = events[0];
+    $("session-title").textContent = `Session ${id} from ${first.src_ip} (${first.country || "??"}, ${first.org || "unknown"})`;
+
+    const credentials = events.filter((event) => event.type.startsWith("auth."));
+    $("session-credentials").replaceChildren(...(credentials.length ? credentials.map((event) => el("tr", {},
+      el("td", {}, event.type.slice(5)),
+      el("td", {}, el("code", {}, event.username)),
+      el("td", {}, el("code", {}, event.type === "auth.password" ? event.password : (event.payload || {}).fingerprint)),
+    )) : [el("tr", {}, el("td", { class: "muted" }, "No record"))]));
+
+    // the downloads by wget and curl, the hash is empty when the file is not fetched
+    const downloads = events.filter((event) => event.type === "download");
+    $("session-downloads").replaceChildren(...(downloads.length ? downloads.map((event) => {
+      const payload = event.payload || {};
+      return el("tr", {},
+        el("td", {}, el("code", {}, payload.url || "")),
+        el("td", {}, el("code", {}, payload.filename || "-")),
+        el("td", {}, payload.sha256 ? el("code", { title: payload.size + " bytes" }, payload.sha256.slice(0, 12)) : el("span", { class: "muted" }, "not fetched")),
+      );
+    }) : [el("tr", {}, el("td", { class: "muted" }, "No record"))]));
+
+    $("terminal").textContent = events
+      .filter((event) => event.type === "command")
+      .map((event) => "$ " + event.command + (event.decoded ? "\n# decoded: " + event.decoded : ""))
+      .join("\n");
+
+    $("session-events").replaceChildren(eventHeader(), ...events.map((event) => eventRow(event)));
+    $("session").hidden = false;
+    $("session").scrollIntoView({ behavior: "smooth" });
+  }
+
+  // replay the commands of the session in the recorded pace, the idle time is
+  // capped to keep the replay watchable
+  function replay() {
+    stopReplay();
+    const commands = (state.session || []).filter((event) => event.type === "command");
+    const terminal = $("terminal");
+    terminal.textContent = "";
+
+    let index = 0;
+    const next = () => {
+      if (index >= commands.length) {
+        state.replay = null;
+        return;
+      }
+
+      const event = commands[index++];
+      const line = "$ " + event.command + "\n";
+      let typed = 0;
+      const type = () => {
+        terminal.textContent += line[typed++];
+        terminal.scrollTop = terminal.scrollHeight;
+        if (typed < line.length) {
+          state.replay = setTimeout(type, 30);
+          return;
+        }
+
+        const after = commands[index];
+        const idle = after ? Math.min(2000, new Date(after.created_at) - new Date(event.created_at)) : 0;
+        state.replay = setTimeout(next, Math.max(200, idle));
+      };
+      type();
+    };
+    next();
+  }
+
+  function stopReplay() {
+    clearTimeout(state.replay);
+    state.replay = null;
+  }
+
+  // ---- search ----
+
+  async function search(more) {
+    const table = $("results");
+    if (!more) {
+      const form = new FormData($("search"));
+      state.query = Object.fromEntries([...form.entries()].filter(([, value]) => value !== ""));
+      state.cursor = 0;
+      table.replaceChildren(eventHeader());
+    }
+
+    try {
+      const page = await api("messages", { ...state.query, cursor: state.cursor, limit: 100 });
+      table.append(...page.events.map((event) => eventRow(event, event.session ? () => loadSession(event.session) : null)));
+      state.cursor = page.next_cursor || 0;
+      $("more").hidden = !state.cursor;
+      if (!page.events.length && !more) {
+        table.append(el("tr", {}, el("td", { class: "muted", colspan: 5 }, "No record")));
+      }
+    } catch (error) {
+      tableError(table, error);
+      $("more").hidden = true;
+    }
+  }
+
+  // ---- main ----
+
+  async function refresh() {
+    try {
+      await Promise.all([loadTimeline(), loadPipeline()]);
+      status("updated at " + new Date().toLocaleTimeString());
+    } catch (error) {
+      status(error.message, true);
+    }
+
+    await Promise.all(["src_ip", "country", "username", "password", "command"].map(loadTop));
+    await loadSessions();
+  }
+
+  $("token").value = token();
+  $("save-token").addEventListener("click", () => {
+    localStorage.setItem("zoe.token", $("token").value.trim());
+    startStream();
+    refresh();
+  });
+  $("range").addEventListener("change", refresh);
+  $("replay").addEventListener("click", replay);
+  $("close-session").addEventListener("click", () => {
+    stopReplay();
+    $("session").hidden = true;
+  });
+  $("search").addEventListener("submit", (event) => {
+    event.preventDefault();
+    search(false);
+  });
+  $("more").addEventListener("click", () => search(true));
+
+  startStream();
+  refresh();
+  setInterval(refresh, refreshInterval);
+})();
@@ -4,8 +4,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/cmj0121/zoe/pkg/pipeline"
 )
 
 func APIIndex(ctx *gin.Context) {
-	ctx.JSON(http.StatusOK, gin.H{})
+	ctx.JSON(http.StatusOK, gin.H{
+		"pipeline": pipeline.Metrics(),
+	})
 }
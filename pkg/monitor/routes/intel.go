@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cmj0121/zoe/pkg/intel"
+)
+
+// Get the observed indicators in the time range as the STIX 2.1 bundle, default
+// is the last 24 hours. The group query is day (default) or session.
+func APIExportSTIX(ctx *gin.Context) {
+	observations, ok := observe(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Disposition", `inline; filename="zoe-stix.json"`)
+	ctx.JSON(http.StatusOK, intel.STIX(observations))
+}
+
+// Get the observed indicators in the time range as the MISP events, default is
+// the last 24 hours. The group query is day (default) or session.
+func APIExportMISP(ctx *gin.Context) {
+	observations, ok := observe(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Disposition", `inline; filename="zoe-misp.json"`)
+	ctx.JSON(http.StatusOK, intel.MISP(observations))
+}
+
+// get the observations of the request, or respond the error.
+func observe(ctx *gin.Context) ([]*intel.Observation, bool) {
+	r, ok := parseSinceUntil(ctx, 24*time.Hour)
+	if !ok {
+		return nil, false
+	}
+
+	group := intel.Group(ctx.DefaultQuery("group", string(intel.GroupDay)))
+	switch group {
+	case intel.GroupDay, intel.GroupSession:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid group: %s", group)})
+		return nil, false
+	}
+
+	observations, err := intel.Observe(ctx, r, group)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return observations, true
+}
@@ -1,74 +1,191 @@
 package routes
 
 import (
-	"embed"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
+	"github.com/cmj0121/zoe/pkg/monitor/auth"
 	"github.com/cmj0121/zoe/pkg/types"
 )
 
-//go:embed *.md
-var index embed.FS
+// Get the popular messages of the period. The range is set by the optional from,
+// to and tz query parameters, and the format is set by the format query or the
+// Accept header, one of markdown (default), html, json, csv and atom.
+func MessagePopular(period types.Period) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		r, ok := parseRange(ctx, period)
+		if !ok {
+			return
+		}
 
-// Get the daily popular messages, return the markdown page.
-func MessagePopular(ctx *gin.Context) {
-	// the escape function for the cell in table
-	fn := template.FuncMap{
-		"escapeTable": func(value string) string {
-			return strings.ReplaceAll(value, "|", "\\|")
-		},
+		format := reportFormat(ctx)
+		switch format {
+		case "atom", "rss":
+			renderAtom(ctx, period, r)
+			return
+		}
+
+		// the executed commands are only listed in the daily report
+		report := newPopularReport(ctx, period, r, period == types.PeriodDaily)
+		switch format {
+		case "markdown", "md":
+			renderMarkdown(ctx, report)
+		case "html":
+			renderHTML(ctx, report)
+		case "json":
+			ctx.JSON(http.StatusOK, report)
+		case "csv":
+			renderCSV(ctx, report)
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format: " + format})
+		}
+	}
+}
+
+// Get the popular messages of the period based on the passed-in field.
+func APIMessagePopular(period types.Period) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		field := ctx.Param("field")
+		switch field {
+		case "client_ip":
+			// the legacy name of the source IP
+			field = "src_ip"
+		case "src_ip":
+		case "src_port":
+		case "dst_ip":
+		case "dst_port":
+		case "username":
+		case "password", "command", "decoded":
+			// the passwords and the commands, which often embed the credentials
+			// and the tokens, are only reported to the analyst
+			if !auth.RoleOf(ctx).Allow(auth.RoleAnalyst) {
+				auth.Require(auth.RoleAnalyst)(ctx)
+				return
+			}
+		case "country":
+		case "city":
+		case "asn":
+		default:
+			// show the default 404 page
+			ctx.String(http.StatusNotFound, "404 page not found")
+			return
+		}
+
+		r, ok := parseRange(ctx, period)
+		if !ok {
+			return
+		}
+
+		report := types.PopularEvents(ctx, field, r, 10)
+		ctx.JSON(http.StatusOK, report)
 	}
+}
 
-	// get the template from embeded file
-	tmpl, err := template.New("index.md").Funcs(fn).ParseFS(index, "*.md")
+// parse the range of the period from the query, response the bad request when failed.
+func parseRange(ctx *gin.Context, period types.Period) (types.Range, bool) {
+	r, err := types.NewRange(period, ctx.Query("from"), ctx.Query("to"), ctx.Query("tz"))
 	if err != nil {
-		log.Warn().Err(err).Msg("failed to parse the template")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return r, false
+	}
+
+	return r, true
+}
+
+// Get the events matched the filters, from the latest to the oldest. The next page
+// is fetched by passing the next_cursor as the cursor. The command filter is the
+// case-sensitive substring, the same as the event streams.
+func APIMessages(ctx *gin.Context) {
+	filter, ok := parseFilter(ctx)
+	if !ok {
 		return
 	}
 
-	var report = struct {
-		ClientIP []*types.Report  `json:"client_ip"`
-		Username []*types.Report  `json:"username"`
-		Password []*types.Report  `json:"password"`
-		Command  []*types.Message `json:"command"`
-	}{}
-
-	report.ClientIP = types.DailyPopularMessages(ctx, "client_ip", 10)
-	report.Username = types.DailyPopularMessages(ctx, "username", 10)
-	report.Password = types.DailyPopularMessages(ctx, "password", 10)
-	report.Command = types.DailyMessage(ctx, "command")
-
-	// render the template
-	if err := tmpl.Execute(ctx.Writer, report); err != nil {
-		log.Warn().Err(err).Msg("failed to render the template")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var err error
+	if filter.Cursor, err = parseInt(ctx.Query("cursor"), 0, math.MaxInt64); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor: " + err.Error()})
+		return
+	}
+	if filter.Limit, err = parseInt(ctx.DefaultQuery("limit", "100"), 1, 1000); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
 		return
 	}
 
-	// make the response as markdown
-	ctx.Header("Content-Type", "text/markdown")
-	ctx.Status(http.StatusOK)
+	page, err := types.QueryEvents(ctx, filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the events")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
 }
 
-// Get the daily popular messages based on the passed-in field.
-func APIMessagePopular(ctx *gin.Context) {
-	field := ctx.Param("field")
-	switch field {
-	case "client_ip":
-	case "username":
-	case "password":
-	case "command":
+// parse the filters of the events from the query, response the bad request when failed.
+func parseFilter(ctx *gin.Context) (types.EventFilter, bool) {
+	filter := types.EventFilter{
+		Type:     types.EventType(ctx.Query("type")),
+		Service:  ctx.Query("service"),
+		Session:  ctx.Query("session"),
+		Username: ctx.Query("username"),
+		Password: ctx.Query("password"),
+		Command:  ctx.Query("command"),
+		ClientIP: ctx.DefaultQuery("client_ip", ctx.Query("src_ip")),
+	}
+
+	if strings.Contains(filter.ClientIP, "/") {
+		if _, _, err := net.ParseCIDR(filter.ClientIP); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid CIDR: " + filter.ClientIP})
+			return filter, false
+		}
+	}
+
+	var err error
+	if filter.Since, err = parseTime(ctx.Query("since")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return filter, false
+	}
+	if filter.Until, err = parseTime(ctx.Query("until")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// parse the time in RFC 3339 or the date, the empty value is the zero time.
+func parseTime(value string) (time.Time, error) {
+	switch {
+	case value == "":
+		return time.Time{}, nil
+	case len(value) == len(time.DateOnly):
+		return time.Parse(time.DateOnly, value)
 	default:
-		// show the default 404 page
-		ctx.String(http.StatusNotFound, "404 page not found")
+		return time.Parse(time.RFC3339, value)
 	}
+}
 
-	report := types.DailyPopularMessages(ctx, field, 10)
-	ctx.JSON(http.StatusOK, report)
+// parse the integer in the range, the empty value is the minimum.
+func parseInt(value string, min, max int) (int, error) {
+	if value == "" {
+		return min, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return 0, err
+	case number < min || number > max:
+		return 0, fmt.Errorf("out of range [%d, %d]", min, max)
+	default:
+		return number, nil
+	}
 }
@@ -0,0 +1,345 @@
+package routes
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/monitor/auth"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+const (
+	mimeMarkdown = "text/markdown"
+	mimeCSV      = "text/csv"
+	mimeAtom     = "application/atom+xml"
+
+	// The number of the reports in the feed.
+	feedSize = 10
+)
+
+// The maximum number of the executed commands listed in the report, the range
+// is chosen by the caller.
+var maxReportCommands = 1000
+
+//go:embed *.md *.html
+var index embed.FS
+
+// The templates of the reports by the period.
+var templates = map[types.Period]string{
+	types.PeriodDaily:   "index.md",
+	types.PeriodWeekly:  "weekly.md",
+	types.PeriodMonthly: "monthly.md",
+}
+
+// The popular messages of the report in the range.
+type popularReport struct {
+	Period types.Period `json:"period"`
+	TZ     string       `json:"tz"`
+	Since  time.Time    `json:"since"`
+	Until  time.Time    `json:"until"`
+
+	ClientIP   []*types.Report `json:"client_ip"`
+	DstPort    []*types.Report `json:"dst_port"`
+	Country    []*types.Report `json:"country"`
+	ASN        []*types.Report `json:"asn"`
+	Username   []*types.Report `json:"username"`
+	Password   []*types.Report `json:"password"`
+	TopCommand []*types.Report `json:"top_command"`
+	// The executed commands, only listed in the daily report.
+	Command []*types.Event `json:"command,omitempty"`
+	// The executed commands exceed the limit and only the oldest are listed.
+	CommandTruncated bool `json:"command_truncated,omitempty"`
+
+	// The report without the passwords and the commands, for the public role.
+	Sanitized bool `json:"sanitized,omitempty"`
+}
+
+// The table of the report, used by the HTML and CSV.
+type reportTable struct {
+	Name    string
+	Title   string
+	Column  string
+	Reports []*types.Report
+}
+
+// The Atom feed of the reports.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    []atomLink  `xml:"link"`
+	Entry   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Get the report of the period in the range, the passwords and the commands,
+// which often embed the credentials and the tokens, are only reported to the
+// analyst.
+func newPopularReport(ctx *gin.Context, period types.Period, r types.Range, commands bool) *popularReport {
+	report := &popularReport{
+		Period:    period,
+		TZ:        r.Since.Location().String(),
+		Since:     r.Since,
+		Until:     r.Until,
+		Sanitized: !auth.RoleOf(ctx).Allow(auth.RoleAnalyst),
+	}
+
+	report.ClientIP = types.PopularEvents(ctx, "src_ip", r, 10)
+	report.DstPort = types.PopularEvents(ctx, "dst_port", r, 10)
+	report.Country = types.PopularEvents(ctx, "country", r, 10)
+	report.ASN = types.PopularEvents(ctx, "asn", r, 10)
+	report.Username = types.PopularEvents(ctx, "username", r, 10)
+	if report.Sanitized {
+		return report
+	}
+
+	report.TopCommand = types.PopularEvents(ctx, "command", r, 10)
+	report.Password = types.PopularEvents(ctx, "password", r, 10)
+	if commands {
+		// one more to know the commands are truncated
+		report.Command = types.RangeEvents(ctx, "command", r, maxReportCommands+1)
+		if len(report.Command) > maxReportCommands {
+			report.Command = report.Command[:maxReportCommands]
+			report.CommandTruncated = true
+		}
+	}
+
+	return report
+}
+
+// Get the tables of the report in the order of the page.
+func (r *popularReport) Tables() []reportTable {
+	tables := []reportTable{
+		{Name: "client_ip", Title: "Top 10 malicious users", Column: "Client IP", Reports: r.ClientIP},
+		{Name: "dst_port", Title: "Top 10 targeted ports", Column: "Port", Reports: r.DstPort},
+		{Name: "country", Title: "Top 10 source countries", Column: "Country", Reports: r.Country},
+		{Name: "asn", Title: "Top 10 source ASNs", Column: "ASN", Reports: r.ASN},
+		{Name: "username", Title: "Top 10 malicious try to login as", Column: "Username", Reports: r.Username},
+		{Name: "password", Title: "Top 10 malicious try to authenticate with", Column: "Password", Reports: r.Password},
+		{Name: "top_command", Title: "Top 10 malicious commands try to execute", Column: "Command", Reports: r.TopCommand},
+	}
+
+	if !r.Sanitized {
+		return tables
+	}
+
+	sanitized := tables[:0]
+	for _, table := range tables {
+		if table.Name != "password" && table.Name != "top_command" {
+			sanitized = append(sanitized, table)
+		}
+	}
+
+	return sanitized
+}
+
+// get the format of the report, by the format query or the Accept header.
+func reportFormat(ctx *gin.Context) string {
+	if format := ctx.Query("format"); format != "" {
+		return strings.ToLower(format)
+	}
+
+	switch ctx.NegotiateFormat(mimeMarkdown, gin.MIMEHTML, gin.MIMEJSON, mimeCSV, mimeAtom) {
+	case gin.MIMEHTML:
+		return "html"
+	case gin.MIMEJSON:
+		return "json"
+	case mimeCSV:
+		return "csv"
+	case mimeAtom:
+		return "atom"
+	default:
+		return "markdown"
+	}
+}
+
+// render the report as the markdown page.
+func renderMarkdown(ctx *gin.Context, report *popularReport) {
+	fn := templateFuncs(ctx, types.Range{Since: report.Since, Until: report.Until})
+
+	// get the template from embeded file
+	tmpl, err := template.New(templates[report.Period]).Funcs(fn).ParseFS(index, "*.md")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse the template")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	render(ctx, mimeMarkdown, tmpl.Execute, report)
+}
+
+// render the report as the HTML page, all the values are escaped by the html/template.
+func renderHTML(ctx *gin.Context, report *popularReport) {
+	tmpl, err := htmltemplate.ParseFS(index, "report.html")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse the template")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	render(ctx, gin.MIMEHTML, tmpl.Execute, report)
+}
+
+// render the tables of the report as CSV, only the table passed by the table query
+// when set. The command table lists the executed commands.
+func renderCSV(ctx *gin.Context, report *popularReport) {
+	table := ctx.Query("table")
+
+	var buff bytes.Buffer
+	writer := csv.NewWriter(&buff)
+
+	switch table {
+	case "command":
+		_ = writer.Write([]string{"created_at", "src_ip", "src_port", "dst_ip", "dst_port", "command", "decoded"})
+		for _, event := range report.Command {
+			_ = writer.Write([]string{
+				event.CreatedAt.Format(time.RFC3339), event.SrcIP, strconv.Itoa(event.SrcPort),
+				event.DstIP, strconv.Itoa(event.DstPort), derefString(event.Command), derefString(event.Decoded),
+			})
+		}
+	default:
+		_ = writer.Write([]string{"table", "value", "count"})
+		for _, t := range report.Tables() {
+			if table != "" && table != t.Name {
+				continue
+			}
+
+			for _, r := range t.Reports {
+				_ = writer.Write([]string{t.Name, r.Value, strconv.Itoa(r.Count)})
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Warn().Err(err).Msg("failed to write the CSV")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("zoe-%s-%s.csv", report.Period, report.Since.Format(time.DateOnly))
+	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	ctx.Data(http.StatusOK, mimeCSV+"; charset=utf-8", buff.Bytes())
+}
+
+// render the latest reports of the period as the Atom feed, each entry is the
+// report of one period.
+func renderAtom(ctx *gin.Context, period types.Period, r types.Range) {
+	tmpl, err := htmltemplate.ParseFS(index, "report.html")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse the template")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := baseURL(ctx)
+	tz := r.Since.Location().String()
+
+	feed := atomFeed{
+		ID:      base + ctx.Request.URL.Path,
+		Title:   fmt.Sprintf("ZOE - the %s report", period),
+		Updated: r.Until.UTC().Format(time.RFC3339),
+		Link: []atomLink{
+			{Href: base + ctx.Request.URL.RequestURI(), Rel: "self", Type: mimeAtom},
+		},
+	}
+
+	for count := 0; count < feedSize; count++ {
+		report := newPopularReport(ctx, period, r, false)
+
+		var content bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&content, "content", report); err != nil {
+			log.Warn().Err(err).Msg("failed to render the feed entry")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		query := url.Values{"format": {"html"}, "from": {r.Since.Format(time.DateOnly)}, "tz": {tz}}
+		link := fmt.Sprintf("%s%s?%s", base, ctx.Request.URL.Path, query.Encode())
+
+		feed.Entry = append(feed.Entry, atomEntry{
+			ID:      link,
+			Title:   fmt.Sprintf("The %s report of %s", period, r.Since.Format(time.DateOnly)),
+			Updated: r.Until.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: link, Rel: "alternate", Type: gin.MIMEHTML},
+			Content: atomContent{Type: "html", Body: content.String()},
+		})
+
+		r = period.Before(r)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to marshal the feed")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Data(http.StatusOK, mimeAtom+"; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+// render the report by the template into the response.
+func render(ctx *gin.Context, mime string, execute func(w io.Writer, data any) error, report any) {
+	var buff bytes.Buffer
+	if err := execute(&buff, report); err != nil {
+		log.Warn().Err(err).Msg("failed to render the template")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Data(http.StatusOK, mime+"; charset=utf-8", buff.Bytes())
+}
+
+// get the base URL of the request, the X-Forwarded-Proto is respected behind the proxy.
+func baseURL(ctx *gin.Context) string {
+	scheme := "http"
+	switch {
+	case ctx.Request.TLS != nil:
+		scheme = "https"
+	case ctx.GetHeader("X-Forwarded-Proto") != "":
+		scheme = ctx.GetHeader("X-Forwarded-Proto")
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, ctx.Request.Host)
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/monitor/auth"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	database.Init("sqlite3", ":memory:")
+
+	source, err := iofs.New(os.DirFS("../../../assets/migrations"), "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migration.Up(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestPopularReportRole(t *testing.T) {
+	yesterday := types.Yesterday()
+	password, command := "hunter2", "curl -H 'Authorization: Bearer secret' http://example.com"
+	events := []*types.Event{
+		{CreatedAt: yesterday.Since.Add(time.Hour), Type: types.EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Password: &password},
+		{CreatedAt: yesterday.Since.Add(time.Hour), Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &command},
+	}
+	if err := types.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	token, hash, err := auth.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate the token: %v", err)
+	}
+
+	authenticator := auth.New([]auth.Token{{Name: "alice", Hash: hash, Role: auth.RoleAnalyst}}, auth.RolePublic, "")
+	defer authenticator.Close()
+
+	engine := gin.New()
+	engine.Use(authenticator.Middleware())
+	public := engine.Group("/", auth.Require(auth.RolePublic))
+	public.GET("/messages/daily-popular", MessagePopular(types.PeriodDaily))
+	public.GET("/messages/daily-popular/:field", APIMessagePopular(types.PeriodDaily))
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		cases := []struct {
+			field  string
+			token  string
+			status int
+		}{
+			{field: "src_ip", status: http.StatusOK},
+			{field: "username", status: http.StatusOK},
+			{field: "password", status: http.StatusUnauthorized},
+			{field: "command", status: http.StatusUnauthorized},
+			{field: "decoded", status: http.StatusUnauthorized},
+			{field: "password", token: token, status: http.StatusOK},
+			{field: "command", token: token, status: http.StatusOK},
+			{field: "decoded", token: token, status: http.StatusOK},
+			{field: "unknown", token: token, status: http.StatusNotFound},
+		}
+
+		for _, c := range cases {
+			if recorder := request("/messages/daily-popular/"+c.field, c.token); recorder.Code != c.status {
+				t.Errorf("expect %d of %s (token=%v), got %d", c.status, c.field, c.token != "", recorder.Code)
+			}
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			token     string
+			sanitized bool
+		}{
+			{name: "public", sanitized: true},
+			{name: "analyst", token: token},
+		}
+
+		for _, c := range cases {
+			recorder := request("/messages/daily-popular?format=json", c.token)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expect 200 of the %s report, got %d", c.name, recorder.Code)
+			}
+
+			var report popularReport
+			if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to parse the %s report: %v", c.name, err)
+			}
+
+			leaked := len(report.Password) > 0 || len(report.TopCommand) > 0 || len(report.Command) > 0
+			switch {
+			case report.Sanitized != c.sanitized:
+				t.Errorf("expect the %s report sanitized=%v", c.name, c.sanitized)
+			case c.sanitized && leaked:
+				t.Errorf("expect no password and command in the %s report, got %+v", c.name, report)
+			case !c.sanitized && !leaked:
+				t.Errorf("expect the password and command in the %s report", c.name)
+			case len(report.ClientIP) != 1:
+				t.Errorf("expect the source IP in the %s report, got %+v", c.name, report.ClientIP)
+			}
+
+			for _, table := range report.Tables() {
+				if c.sanitized && (table.Name == "password" || table.Name == "top_command") {
+					t.Errorf("expect no %s table in the %s report", table.Name, c.name)
+				}
+			}
+		}
+	})
+}
+
+func TestPopularReportCommandLimit(t *testing.T) {
+	defer func(limit int) { maxReportCommands = limit }(maxReportCommands)
+	maxReportCommands = 2
+
+	since := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+	var events []*types.Event
+	for index := 0; index < 3; index++ {
+		command := fmt.Sprintf("echo %d", index)
+		events = append(events, &types.Event{CreatedAt: since.Add(time.Duration(index) * time.Minute), Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.9", Command: &command})
+	}
+	if err := types.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	cases := []struct {
+		to        string
+		commands  []string
+		truncated bool
+	}{
+		{to: "2001-02-03T00:01:30Z", commands: []string{"echo 0", "echo 1"}},
+		{to: "2001-02-04T00:00:00Z", commands: []string{"echo 0", "echo 1"}, truncated: true},
+	}
+
+	token, hash, err := auth.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate the token: %v", err)
+	}
+
+	authenticator := auth.New([]auth.Token{{Name: "alice", Hash: hash, Role: auth.RoleAnalyst}}, auth.RoleNone, "")
+	defer authenticator.Close()
+
+	engine := gin.New()
+	engine.Use(authenticator.Middleware())
+	engine.GET("/messages/daily-popular", MessagePopular(types.PeriodDaily))
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/messages/daily-popular?format=json&tz=UTC&from=2001-02-03T00:00:00Z&to="+c.to, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+
+		var report popularReport
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatalf("failed to parse the report: %v: %s", err, recorder.Body.String())
+		}
+
+		var commands []string
+		for _, event := range report.Command {
+			commands = append(commands, *event.Command)
+		}
+
+		switch {
+		case !reflect.DeepEqual(commands, c.commands):
+			t.Errorf("expect the commands %q until %s, got %q", c.commands, c.to, commands)
+		case report.CommandTruncated != c.truncated:
+			t.Errorf("expect truncated=%t until %s", c.truncated, c.to)
+		}
+
+		for _, format := range []string{"md", "html"} {
+			req := httptest.NewRequest(http.MethodGet, "/messages/daily-popular?tz=UTC&from=2001-02-03T00:00:00Z&format="+format+"&to="+c.to, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			if noted := strings.Contains(recorder.Body.String(), "Only the first 2 commands are listed."); noted != c.truncated {
+				t.Errorf("expect the truncation noted=%t in the %s until %s, got %d: %s", c.truncated, format, c.to, recorder.Code, recorder.Body.String())
+			}
+		}
+	}
+}
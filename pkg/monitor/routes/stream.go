@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/pipeline"
+)
+
+const (
+	// The number of the events buffered for each stream, the events are dropped
+	// when the client is slower than that.
+	streamBuffer = 256
+	// The interval of the heartbeat, keep the idle connection alive behind the proxy.
+	heartbeatInterval = 15 * time.Second
+	// The maximum time to write the event to the client.
+	writeTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// Stream the recorded events matched the filters as the Server-Sent Events. The
+// filters are the same as the /messages, and the dropped event is sent when the
+// client is too slow to receive all the events.
+func EventStream(ctx *gin.Context) {
+	filter, ok := parseFilter(ctx)
+	if !ok {
+		return
+	}
+
+	sub := pipeline.Subscribe(streamBuffer)
+	defer pipeline.Unsubscribe(sub)
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// disable the response buffering of the nginx
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	dropped := uint64(0)
+	for {
+		var err error
+
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+
+			var data []byte
+			if data, err = json.Marshal(event); err == nil {
+				_, err = fmt.Fprintf(ctx.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			}
+		case <-heartbeat.C:
+			switch count := sub.Dropped(); {
+			case count > dropped:
+				_, err = fmt.Fprintf(ctx.Writer, "event: dropped\ndata: {\"dropped\":%d}\n\n", count-dropped)
+				dropped = count
+			default:
+				_, err = fmt.Fprint(ctx.Writer, ": heartbeat\n\n")
+			}
+		}
+
+		if err != nil {
+			log.Debug().Err(err).Msg("failed to write the event stream")
+			return
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+// Stream the recorded events matched the filters over the WebSocket, each event is
+// sent as the JSON text message.
+func EventWebSocket(ctx *gin.Context) {
+	filter, ok := parseFilter(ctx)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to upgrade the WebSocket")
+		return
+	}
+	defer conn.Close()
+
+	sub := pipeline.Subscribe(streamBuffer)
+	defer pipeline.Unsubscribe(sub)
+
+	// read and discard the messages from the client, until the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+			_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+			return
+		case <-closed:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				log.Debug().Err(err).Msg("failed to write the WebSocket")
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				log.Debug().Err(err).Msg("failed to ping the WebSocket")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The subscribers of the recorded events, like the live stream of the monitor,
+// and the taps of the published events, like the alerts and the syslog sink.
+var (
+	mu          sync.RWMutex
+	subscribers = map[*Subscriber]struct{}{}
+	taps        = map[*Subscriber]struct{}{}
+)
+
+// The subscriber that receives the events after they are recorded, or right after
+// they are published by the tap. The events are dropped when the subscriber is
+// slower than the honeypots, so the write path is never blocked.
+type Subscriber struct {
+	ch      chan *types.Event
+	dropped atomic.Uint64
+}
+
+// Subscribe the recorded events with the buffer size, the subscriber must be
+// closed by Unsubscribe.
+func Subscribe(size int) *Subscriber {
+	if size <= 0 {
+		size = 1
+	}
+
+	sub := &Subscriber{ch: make(chan *types.Event, size)}
+
+	mu.Lock()
+	subscribers[sub] = struct{}{}
+	mu.Unlock()
+
+	return sub
+}
+
+// Tap the published events with the buffer size before they are persisted, so
+// the tap keeps receiving the events when the database is down. The tapped event
+// is the prepared copy without the ID and not decoded yet, since the publisher
+// may be the SSH handshake, and must be closed by Unsubscribe.
+func Tap(size int) *Subscriber {
+	if size <= 0 {
+		size = 1
+	}
+
+	sub := &Subscriber{ch: make(chan *types.Event, size)}
+
+	mu.Lock()
+	taps[sub] = struct{}{}
+	mu.Unlock()
+
+	return sub
+}
+
+// Unsubscribe and close the channel of the subscriber or the tap.
+func Unsubscribe(sub *Subscriber) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, registry := range []map[*Subscriber]struct{}{subscribers, taps} {
+		if _, ok := registry[sub]; ok {
+			delete(registry, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Get the channel of the recorded events, closed after unsubscribed.
+func (s *Subscriber) Events() <-chan *types.Event {
+	return s.ch
+}
+
+// Get the number of the events dropped since the subscriber is too slow.
+func (s *Subscriber) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// broadcast the recorded events to all the subscribers without blocking.
+func broadcast(events []*types.Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for sub := range subscribers {
+		for _, event := range events {
+			sub.send(event)
+		}
+	}
+}
+
+// send the copy of the published event to all the taps without blocking, the
+// event is written by the writer after published.
+func tap(event *types.Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for sub := range taps {
+		copied := *event
+		sub.send(&copied)
+	}
+}
+
+// send the event without blocking, the event is dropped when the buffer is full.
+func (s *Subscriber) send(event *types.Event) {
+	select {
+	case s.ch <- event:
+	default:
+		if s.dropped.Add(1) == 1 {
+			log.Warn().Msg("the subscriber is too slow, drop the events")
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// The buffered event pipeline between the honeypots and the database.
+//
+// The honeypots publish the events into the bounded queue and never touch the
+// database directly, the writer flushes the queued events in the transactions
+// by the batch size or the flush interval.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/metrics"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The default pipeline used by the honeypots, nil when not initialized.
+var defaultPipeline atomic.Pointer[Pipeline]
+
+// The first backoff between the retries of the failed batch, doubled by each retry.
+var retryBackoff = 500 * time.Millisecond
+
+// The buffered event pipeline that writes the events in batches.
+type Pipeline struct {
+	Sensor        string        `name:"sensor" help:"The name of the sensor stamped on the events, default is the hostname"`
+	QueueSize     int           `name:"queue-size" help:"The maximum number of the queued events" default:"4096"`
+	BatchSize     int           `name:"batch-size" help:"The maximum number of the events flushed in one transaction" default:"256"`
+	FlushInterval time.Duration `name:"flush-interval" help:"The maximum time the queued events wait before flushed" default:"1s"`
+	Backpressure  time.Duration `name:"backpressure" help:"The maximum time to wait for the full queue before dropping the event" default:"50ms"`
+	Retries       int           `name:"retries" help:"The number of the retries of the failed batch, then the events are inserted one by one" default:"3"`
+
+	queue  chan *types.Event
+	done   chan struct{}
+	closed atomic.Bool
+
+	// the metrics of the pipeline
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	written   atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// The snapshot of the pipeline metrics.
+type Stats struct {
+	Queued    int    `json:"queued"`
+	Published uint64 `json:"published"`
+	Dropped   uint64 `json:"dropped"`
+	Written   uint64 `json:"written"`
+	Failed    uint64 `json:"failed"`
+}
+
+// New creates the pipeline with the default settings.
+func New() *Pipeline {
+	return &Pipeline{
+		QueueSize:     4096,
+		BatchSize:     256,
+		FlushInterval: time.Second,
+		Backpressure:  50 * time.Millisecond,
+		Retries:       3,
+	}
+}
+
+// Init the queue of the pipeline and use it as the default pipeline.
+func (p *Pipeline) Init() {
+	if p.QueueSize <= 0 {
+		p.QueueSize = 1
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = 1
+	}
+	if p.FlushInterval <= 0 {
+		p.FlushInterval = time.Second
+	}
+	if p.Retries < 0 {
+		p.Retries = 0
+	}
+
+	if p.Sensor == "" {
+		p.Sensor = hostname()
+	}
+
+	p.queue = make(chan *types.Event, p.QueueSize)
+	p.done = make(chan struct{})
+
+	defaultPipeline.Store(p)
+	p.register()
+	log.Info().Int("queue", p.QueueSize).Int("batch", p.BatchSize).Dur("interval", p.FlushInterval).Msg("init the event pipeline")
+}
+
+// Publish the event into the default pipeline, the event is inserted directly
+// when the pipeline is not initialized.
+func Publish(event *types.Event) bool {
+	if p := defaultPipeline.Load(); p != nil {
+		return p.Publish(event)
+	}
+
+	if event.Sensor == "" {
+		event.Sensor = hostname()
+	}
+
+	event.Prepare()
+	tap(event)
+
+	if err := event.Insert(); err != nil {
+		log.Warn().Err(err).Msg("failed to insert the event")
+		return false
+	}
+
+	broadcast([]*types.Event{event})
+	return true
+}
+
+// Get the metrics of the default pipeline.
+func Metrics() Stats {
+	if p := defaultPipeline.Load(); p != nil {
+		return p.Stats()
+	}
+
+	return Stats{}
+}
+
+// Publish the event into the queue. The publisher waits for the backpressure
+// timeout when the queue is full, and the event is dropped after that.
+func (p *Pipeline) Publish(event *types.Event) bool {
+	if event.CreatedAt.IsZero() {
+		// keep the time the event happens, not the time it is flushed
+		event.CreatedAt = time.Now().UTC()
+	}
+	if event.Sensor == "" {
+		event.Sensor = p.Sensor
+	}
+
+	// the taps receive the event even the queue is full or the database is down,
+	// and the command is decoded by the writer, never blocks the publisher
+	event.Prepare()
+	tap(event)
+
+	if p.closed.Load() {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- event:
+		p.published.Add(1)
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(p.Backpressure)
+	defer timer.Stop()
+
+	select {
+	case p.queue <- event:
+		p.published.Add(1)
+		return true
+	case <-timer.C:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Get the snapshot of the pipeline metrics.
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Queued:    len(p.queue),
+		Published: p.published.Load(),
+		Dropped:   p.dropped.Load(),
+		Written:   p.written.Load(),
+		Failed:    p.failed.Load(),
+	}
+}
+
+// Run the writer that flushes the queued events until the context is done, the
+// remaining events are flushed before return.
+func (p *Pipeline) Run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*types.Event, 0, p.BatchSize)
+	dropped := uint64(0)
+
+	for {
+		select {
+		case event := <-p.queue:
+			if batch = append(batch, event); len(batch) >= p.BatchSize {
+				batch = p.flush(batch)
+			}
+		case <-ticker.C:
+			batch = p.flush(batch)
+
+			if count := p.dropped.Load(); count > dropped {
+				log.Warn().Uint64("dropped", count-dropped).Uint64("total", count).Msg("the event queue is full, drop the events")
+				dropped = count
+			}
+		case <-ctx.Done():
+			p.closed.Store(true)
+			p.drain(batch)
+			return
+		}
+	}
+}
+
+// Wait until the writer flushes the remaining events and stops.
+func (p *Pipeline) Wait() {
+	<-p.done
+}
+
+// drain the queue and flush all the remaining events.
+func (p *Pipeline) drain(batch []*types.Event) {
+	log.Info().Int("queued", len(p.queue)+len(batch)).Msg("flush the remaining events")
+
+	for {
+		select {
+		case event := <-p.queue:
+			if batch = append(batch, event); len(batch) >= p.BatchSize {
+				batch = p.flush(batch)
+			}
+		default:
+			p.flush(batch)
+			return
+		}
+	}
+}
+
+// flush the batch in a single transaction and return the emptied batch. The
+// failed batch is retried with the backoff, then the events are inserted one by
+// one so only the bad events are dropped.
+func (p *Pipeline) flush(batch []*types.Event) []*types.Event {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// the flush should not be interrupted by the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := p.insert(ctx, batch)
+		switch {
+		case err == nil:
+			p.written.Add(uint64(len(batch)))
+			log.Debug().Int("count", len(batch)).Msg("flush the events")
+			broadcast(batch)
+			return batch[:0]
+		case attempt >= p.Retries:
+			log.Warn().Err(err).Int("count", len(batch)).Msg("failed to flush the events, insert them one by one")
+			p.flushEach(ctx, batch)
+			return batch[:0]
+		}
+
+		log.Warn().Err(err).Int("count", len(batch)).Dur("backoff", backoff).Msg("failed to flush the events, retry")
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// insert the events one by one, the failed events are dropped and counted.
+func (p *Pipeline) flushEach(ctx context.Context, batch []*types.Event) {
+	written := make([]*types.Event, 0, len(batch))
+	for _, event := range batch {
+		if err := p.insert(ctx, []*types.Event{event}); err != nil {
+			p.failed.Add(1)
+			log.Warn().Err(err).Str("type", string(event.Type)).Str("src_ip", event.SrcIP).Msg("failed to insert the event, drop it")
+			continue
+		}
+
+		written = append(written, event)
+	}
+
+	p.written.Add(uint64(len(written)))
+	broadcast(written)
+}
+
+// insert the events in a single transaction.
+func (p *Pipeline) insert(ctx context.Context, events []*types.Event) error {
+	started := time.Now()
+	defer func() { metrics.DBWriteDuration.Observe(time.Since(started).Seconds()) }()
+
+	return types.InsertEvents(ctx, events)
+}
+
+// register the metrics of the pipeline.
+func (p *Pipeline) register() {
+	counter := func(name, help string, value *atomic.Uint64) prometheus.Collector {
+		opts := prometheus.CounterOpts{Name: metrics.Name(name), Help: help}
+		return prometheus.NewCounterFunc(opts, func() float64 { return float64(value.Load()) })
+	}
+
+	depth := prometheus.GaugeOpts{Name: metrics.Name("event_queue_depth"), Help: "The number of the queued events."}
+	metrics.Register(
+		prometheus.NewGaugeFunc(depth, func() float64 { return float64(len(p.queue)) }),
+		counter("events_published_total", "The number of the events published into the queue.", &p.published),
+		counter("events_dropped_total", "The number of the events dropped since the queue is full.", &p.dropped),
+		counter("events_written_total", "The number of the events written into the database.", &p.written),
+		counter("events_failed_total", "The number of the events failed to write into the database.", &p.failed),
+	)
+}
+
+// get the hostname as the default sensor name.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get the hostname")
+		return "zoe"
+	}
+
+	return name
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	database.Init("sqlite3", ":memory:")
+
+	source, err := iofs.New(os.DirFS("../../assets/migrations"), "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migration.Up(); err != nil {
+		panic(err)
+	}
+
+	retryBackoff = time.Millisecond
+	os.Exit(m.Run())
+}
+
+func TestFlush(t *testing.T) {
+	event := func(payload any) *types.Event {
+		return &types.Event{Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.1", Payload: map[string]any{"value": payload}}
+	}
+
+	cases := []struct {
+		name    string
+		batch   []*types.Event
+		written uint64
+		failed  uint64
+	}{
+		{name: "empty"},
+		{name: "all", batch: []*types.Event{event(1), event(2), event(3)}, written: 3},
+		// the payload cannot be encoded as the JSON
+		{name: "bad-row", batch: []*types.Event{event(1), event(func() {}), event(3)}, written: 2, failed: 1},
+		{name: "all-bad", batch: []*types.Event{event(func() {}), event(make(chan int))}, failed: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New()
+			p.Retries = 2
+
+			sub := Subscribe(len(c.batch) + 1)
+			defer Unsubscribe(sub)
+
+			if batch := p.flush(c.batch); len(batch) != 0 {
+				t.Errorf("expect the emptied batch, got %d", len(batch))
+			}
+
+			stats := p.Stats()
+			if stats.Written != c.written || stats.Failed != c.failed {
+				t.Errorf("expect %d written and %d failed, got %+v", c.written, c.failed, stats)
+			}
+
+			if received := len(sub.Events()); uint64(received) != c.written {
+				t.Errorf("expect %d broadcast events, got %d", c.written, received)
+			}
+		})
+	}
+}
+
+func TestRunDrain(t *testing.T) {
+	p := New()
+	p.BatchSize = 4
+	p.FlushInterval = time.Hour
+	p.Init()
+	defer defaultPipeline.Store(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go p.Run(ctx)
+
+	for index := 0; index < 10; index++ {
+		if !Publish(&types.Event{Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.2"}) {
+			t.Fatalf("failed to publish the event #%d", index)
+		}
+	}
+
+	cancel()
+	p.Wait()
+
+	if stats := p.Stats(); stats.Written != 10 || stats.Queued != 0 {
+		t.Errorf("expect all the events written, got %+v", stats)
+	}
+
+	if Publish(&types.Event{Type: types.EventConnect}) {
+		t.Errorf("expect the event dropped after closed")
+	}
+}
+
+func TestTap(t *testing.T) {
+	sub := Tap(2)
+	recorded := Subscribe(2)
+	defer Unsubscribe(sub)
+	defer Unsubscribe(recorded)
+
+	// the payload cannot be encoded, so the event is never persisted
+	event := &types.Event{Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.3", Payload: map[string]any{"value": func() {}}}
+	if Publish(event) {
+		t.Fatalf("expect the event failed to insert")
+	}
+
+	select {
+	case tapped := <-sub.Events():
+		switch {
+		case tapped == event:
+			t.Errorf("expect the copy of the event")
+		case tapped.SrcIP != event.SrcIP || tapped.CreatedAt.IsZero() || tapped.ID != 0:
+			t.Errorf("expect the prepared event without the ID, got %+v", tapped)
+		}
+	default:
+		t.Errorf("expect the tapped event before persisted")
+	}
+
+	if received := len(recorded.Events()); received != 0 {
+		t.Errorf("expect no recorded event, got %d", received)
+	}
+
+	Unsubscribe(sub)
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("expect the tap closed after unsubscribed")
+	}
+}
+
+func TestPublishDecode(t *testing.T) {
+	p := New()
+	p.FlushInterval = time.Hour
+	p.Init()
+	defer defaultPipeline.Store(nil)
+
+	sub := Tap(1)
+	recorded := Subscribe(1)
+	defer Unsubscribe(sub)
+	defer Unsubscribe(recorded)
+
+	command := "echo aWQ= | base64 -d | sh"
+	event := &types.Event{Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.4", Command: &command}
+	if !Publish(event) {
+		t.Fatalf("failed to publish the event")
+	}
+
+	// the command is never decoded by the publisher
+	tapped := <-sub.Events()
+	switch {
+	case event.Decoded != nil:
+		t.Errorf("expect the command not decoded by the publisher, got %q", *event.Decoded)
+	case tapped.Decoded != nil:
+		t.Errorf("expect the tapped event not decoded, got %q", *tapped.Decoded)
+	}
+
+	// the command is decoded by the writer before persisted
+	ctx, cancel := context.WithCancel(context.Background())
+	go p.Run(ctx)
+	cancel()
+	p.Wait()
+
+	select {
+	case written := <-recorded.Events():
+		if written.Decoded == nil || !strings.Contains(*written.Decoded, "id") {
+			t.Errorf("expect the decoded command persisted, got %+v", written)
+		}
+	default:
+		t.Errorf("expect the event written")
+	}
+}
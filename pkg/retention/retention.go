@@ -0,0 +1,180 @@
+// The data retention policy that prunes the expired raw events.
+//
+// Only the raw events are pruned, the hourly rollups are kept forever. The
+// events are pruned by the whole days in UTC, after the rollups of the pruned
+// days are repaired, and nothing is pruned by default. The expired events can be
+// archived into the gzip-compressed JSONL files before deleted, one file per
+// prune.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The retention policy of the raw events.
+type Retention struct {
+	Keep      time.Duration `name:"keep" help:"The time to keep the raw events, 0 to keep forever" default:"0"`
+	Interval  time.Duration `name:"interval" help:"The interval of the periodic prune, 0 to disable" default:"24h"`
+	Archive   string        `name:"archive" help:"The directory to archive the expired events as the .jsonl.gz files, empty to delete without archive"`
+	BatchSize int           `name:"batch-size" help:"The maximum number of the events pruned in one batch" default:"1000"`
+}
+
+// New creates the retention policy with the default settings.
+func New() *Retention {
+	return &Retention{
+		Interval:  24 * time.Hour,
+		BatchSize: 1000,
+	}
+}
+
+// Run the periodic prune until the context is done.
+func (r *Retention) Run(ctx context.Context) {
+	if r.Keep <= 0 || r.Interval <= 0 {
+		log.Info().Msg("the retention is disabled, keep the events forever")
+		return
+	}
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Prune(ctx); err != nil {
+			log.Warn().Err(err).Msg("failed to prune the expired events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune the events of the days in UTC older than the retention, the expired
+// events are archived before deleted when the archive directory is set. The
+// rollups of the pruned days are repaired first, and nothing is pruned when the
+// rollups cannot be repaired. Return the number of the deleted events.
+func (r *Retention) Prune(ctx context.Context) (int64, error) {
+	if r.Keep <= 0 {
+		log.Debug().Msg("keep the events forever, skip the prune")
+		return 0, nil
+	}
+
+	size := r.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+
+	// prune the whole days only, so the rollups of a day are never rebuilt from
+	// the partially pruned events
+	before := time.Now().UTC().Add(-r.Keep).Truncate(24 * time.Hour)
+
+	if _, err := types.RepairRollups(ctx, types.Range{Until: before}); err != nil {
+		return 0, fmt.Errorf("failed to repair the rollups before the prune: %w", err)
+	}
+
+	var archive *archiver
+	defer func() {
+		if archive != nil {
+			archive.Close()
+		}
+	}()
+
+	total := int64(0)
+	for {
+		events, err := types.ExpiredEvents(ctx, before, size)
+		if err != nil {
+			return total, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		if r.Archive != "" {
+			if archive == nil {
+				if archive, err = newArchiver(r.Archive); err != nil {
+					return total, err
+				}
+			}
+
+			// the events must be persisted before deleted
+			if err := archive.Write(events); err != nil {
+				return total, err
+			}
+		}
+
+		count, err := types.DeleteEvents(ctx, before, events[len(events)-1].ID)
+		if err != nil {
+			return total, err
+		}
+		total += count
+
+		if len(events) < size {
+			break
+		}
+	}
+
+	log.Info().Int64("count", total).Time("before", before).Msg("prune the expired events")
+	return total, nil
+}
+
+// the writer of the gzip-compressed JSONL archive.
+type archiver struct {
+	file    *os.File
+	writer  *gzip.Writer
+	encoder *json.Encoder
+}
+
+// create the archive file named by the current time in the directory.
+func newArchiver(dir string) (*archiver, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("events-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("path", file.Name()).Msg("archive the expired events")
+
+	writer := gzip.NewWriter(file)
+	return &archiver{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+// write the events as JSON lines and flush them into the file.
+func (a *archiver) Write(events []*types.Event) error {
+	for _, event := range events {
+		if err := a.encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	if err := a.writer.Flush(); err != nil {
+		return err
+	}
+
+	return a.file.Sync()
+}
+
+// close the gzip stream and the file.
+func (a *archiver) Close() {
+	if err := a.writer.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close the archive")
+	}
+
+	if err := a.file.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close the archive file")
+	}
+}
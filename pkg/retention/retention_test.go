@@ -0,0 +1,135 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	database.Init("sqlite3", ":memory:")
+
+	source, err := iofs.New(os.DirFS("../../assets/migrations"), "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migration.Up(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestNew(t *testing.T) {
+	r := New()
+	if r.Keep != 0 {
+		t.Errorf("expect to keep the events forever by default, got %v", r.Keep)
+	}
+
+	if count, err := r.Prune(context.Background()); err != nil || count != 0 {
+		t.Errorf("expect nothing pruned, got %d: %v", count, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	// the events of 3 days ago, 2 days ago and the noon of yesterday
+	var events []*types.Event
+	for _, at := range []time.Time{today.AddDate(0, 0, -3), today.AddDate(0, 0, -2).Add(23 * time.Hour), today.AddDate(0, 0, -1).Add(12 * time.Hour)} {
+		events = append(events, &types.Event{CreatedAt: at, Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.1"})
+	}
+
+	if err := types.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	// lose the rollups, which must be repaired before the prune
+	if _, err := database.Session().ExecContext(ctx, "DELETE FROM rollup"); err != nil {
+		t.Fatalf("failed to delete the rollups: %v", err)
+	}
+
+	// the cut is in the middle of yesterday, and only the whole days before are
+	// pruned
+	dir := t.TempDir()
+	r := New()
+	r.Keep = 24 * time.Hour
+	r.Archive = dir
+	r.BatchSize = 1
+
+	count, err := r.Prune(ctx)
+	if err != nil {
+		t.Fatalf("failed to prune the events: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expect 2 events pruned, got %d", count)
+	}
+
+	page, err := types.QueryEvents(ctx, types.EventFilter{})
+	if err != nil {
+		t.Fatalf("failed to query the events: %v", err)
+	}
+	if len(page.Events) != 1 || page.Events[0].ID != events[2].ID {
+		t.Errorf("expect the event of yesterday kept, got %+v", page.Events)
+	}
+
+	// the rollups of the pruned days are repaired and kept
+	reports := types.PopularEvents(ctx, "src_ip", types.Range{Since: today.AddDate(0, 0, -3), Until: today.AddDate(0, 0, -1)}, 10)
+	switch {
+	case len(reports) != 1:
+		t.Errorf("expect one source IP in the rollups, got %d", len(reports))
+	case reports[0].Count != 2:
+		t.Errorf("expect the rollups of the pruned events kept, got %d", reports[0].Count)
+	}
+
+	// the pruned events are archived
+	files, err := filepath.Glob(filepath.Join(dir, "events-*.jsonl.gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expect one archive, got %v: %v", files, err)
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("expect 2 archived events, got %q", lines)
+	}
+}
@@ -0,0 +1,300 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The binary operators of the arithmetic expansion, from the lowest precedence.
+var arithLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// The evaluator of the integer arithmetic expansion, like $((1 + 2)). The
+// variables are expanded before and the names are looked up as the variables.
+type arith struct {
+	text   string
+	pos    int
+	lookup func(string) string
+	// the last consumed operator, shown as the error token at the end
+	last string
+	// the nested depth of the names that refer to the other names
+	depth int
+}
+
+// evaluate the arithmetic expression as bash does, the variables are expanded
+// by the lookup.
+func evalArith(text string, lookup func(string) string) (int64, error) {
+	return (&arith{text: text, lookup: lookup}).eval()
+}
+
+func (a *arith) eval() (int64, error) {
+	if strings.TrimSpace(a.text) == "" {
+		return 0, nil
+	}
+
+	value, err := a.binary(0)
+	if err != nil {
+		return 0, err
+	}
+
+	if a.skip(); a.pos < len(a.text) {
+		return 0, fmt.Errorf("syntax error in expression (error token is %q)", a.text[a.pos:])
+	}
+
+	return value, nil
+}
+
+// parse the binary expression of the precedence level.
+func (a *arith) binary(level int) (int64, error) {
+	if level == len(arithLevels) {
+		return a.power()
+	}
+
+	left, err := a.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := a.operator(arithLevels[level])
+		if op == "" {
+			return left, nil
+		}
+
+		right, err := a.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if left, err = apply(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parse the exponentiation, which is right-associative.
+func (a *arith) power() (int64, error) {
+	base, err := a.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	if a.operator([]string{"**"}) == "" {
+		return base, nil
+	}
+
+	exp, err := a.power()
+	switch {
+	case err != nil:
+		return 0, err
+	case exp < 0:
+		return 0, fmt.Errorf("exponent less than 0 (error token is %q)", strconv.FormatInt(exp, 10))
+	}
+
+	// the exponentiation by squaring, overflowed as bash does
+	result := int64(1)
+	for ; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return result, nil
+}
+
+// parse the unary operators and the primary expression.
+func (a *arith) unary() (int64, error) {
+	a.skip()
+	if a.pos >= len(a.text) {
+		return 0, fmt.Errorf("syntax error: operand expected (error token is %q)", a.last)
+	}
+
+	switch ch := a.text[a.pos]; {
+	case ch == '-' || ch == '+' || ch == '!' || ch == '~':
+		a.pos++
+		value, err := a.unary()
+		if err != nil {
+			return 0, err
+		}
+
+		switch ch {
+		case '-':
+			return -value, nil
+		case '!':
+			return boolean(value == 0), nil
+		case '~':
+			return ^value, nil
+		default:
+			return value, nil
+		}
+	case ch == '(':
+		a.pos++
+		value, err := a.binary(0)
+		if err != nil {
+			return 0, err
+		}
+
+		if a.skip(); a.pos >= len(a.text) || a.text[a.pos] != ')' {
+			return 0, fmt.Errorf("missing `)' (error token is %q)", a.text[a.pos:])
+		}
+		a.pos++
+		return value, nil
+	case ch >= '0' && ch <= '9':
+		start := a.pos
+		for a.pos < len(a.text) && (isName(rune(a.text[a.pos])) || isDigit(a.text[a.pos])) {
+			a.pos++
+		}
+		return number(a.text[start:a.pos])
+	case isName(rune(ch)):
+		start := a.pos
+		for a.pos < len(a.text) && (isName(rune(a.text[a.pos])) || isDigit(a.text[a.pos])) {
+			a.pos++
+		}
+		return a.variable(a.text[start:a.pos])
+	default:
+		return 0, fmt.Errorf("syntax error: operand expected (error token is %q)", a.text[a.pos:])
+	}
+}
+
+// get the value of the variable, which may be the expression as well.
+func (a *arith) variable(name string) (int64, error) {
+	value := strings.TrimSpace(a.lookup(name))
+	if value == "" {
+		return 0, nil
+	}
+
+	if a.depth++; a.depth > 16 {
+		return 0, fmt.Errorf("expression recursion level exceeded (error token is %q)", name)
+	}
+	defer func() { a.depth-- }()
+
+	nested := &arith{text: value, lookup: a.lookup, depth: a.depth}
+	return nested.eval()
+}
+
+// consume the operator in the candidates, the longest one first.
+func (a *arith) operator(candidates []string) string {
+	a.skip()
+
+	for _, op := range candidates {
+		if !strings.HasPrefix(a.text[a.pos:], op) {
+			continue
+		}
+
+		// the single-char operator must not be the prefix of the longer one
+		rest := a.text[a.pos+len(op):]
+		if len(op) == 1 && rest != "" && (rest[0] == op[0] || rest[0] == '=') {
+			continue
+		}
+
+		a.pos += len(op)
+		a.last = op
+		return op
+	}
+
+	return ""
+}
+
+func (a *arith) skip() {
+	for a.pos < len(a.text) && (isBlank(rune(a.text[a.pos])) || a.text[a.pos] == '\n') {
+		a.pos++
+	}
+}
+
+// apply the binary operator.
+func apply(op string, left, right int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolean(left != 0 || right != 0), nil
+	case "&&":
+		return boolean(left != 0 && right != 0), nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&":
+		return left & right, nil
+	case "==":
+		return boolean(left == right), nil
+	case "!=":
+		return boolean(left != right), nil
+	case "<=":
+		return boolean(left <= right), nil
+	case ">=":
+		return boolean(left >= right), nil
+	case "<":
+		return boolean(left < right), nil
+	case ">":
+		return boolean(left > right), nil
+	case "<<":
+		return left << (uint64(right) & 63), nil
+	case ">>":
+		return left >> (uint64(right) & 63), nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		switch {
+		case right == 0:
+			return 0, fmt.Errorf("division by 0 (error token is %q)", strconv.FormatInt(right, 10))
+		case right == -1:
+			// avoid the overflow panic of the minimum integer
+			if op == "/" {
+				return -left, nil
+			}
+			return 0, nil
+		case op == "/":
+			return left / right, nil
+		default:
+			return left % right, nil
+		}
+	default:
+		return 0, fmt.Errorf("syntax error: invalid arithmetic operator (error token is %q)", op)
+	}
+}
+
+// parse the integer constant, the decimal, the hexadecimal (0x) or the octal (0).
+func number(text string) (int64, error) {
+	base := 10
+	digits := text
+
+	switch {
+	case strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X"):
+		base, digits = 16, text[2:]
+	case len(text) > 1 && text[0] == '0':
+		base, digits = 8, text[1:]
+	}
+
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value too great for base (error token is %q)", text)
+	}
+
+	return value, nil
+}
+
+func boolean(ok bool) int64 {
+	if ok {
+		return 1
+	}
+
+	return 0
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,438 @@
+package shell
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The builtin command of the shell, returns the output and the exit code.
+type Command func(r *RBash, stdin string, args ...string) (string, int)
+
+// The registry of the supported commands.
+var commands = map[string]Command{}
+
+func init() {
+	register("base64", cmdBase64)
+	register("cat", cmdCat)
+	register("cd", cmdCd)
+	register("chmod", cmdChmod)
+	register("echo", cmdEcho)
+	register("env", cmdEnv)
+	register("exit", cmdExit)
+	register("false", cmdFalse)
+	register("export", cmdExport)
+	register("history", cmdHistory)
+	register("id", cmdId)
+	register("ls", cmdLs)
+	register("mkdir", cmdMkdir)
+	register("pwd", cmdPwd)
+	register("rm", cmdRm)
+	register("su", cmdSu)
+	register("sudo", cmdSudo)
+	register("touch", cmdTouch)
+	register("true", cmdTrue)
+	register("unset", cmdUnset)
+	register("whoami", cmdWhoami)
+}
+
+// register the command into the registry.
+func register(name string, cmd Command) {
+	commands[name] = cmd
+}
+
+// Get the names of all the supported commands, sorted by the name.
+func Commands() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func cmdBase64(r *RBash, stdin string, args ...string) (string, int) {
+	decode := false
+	data := []byte(stdin)
+
+	for _, arg := range args {
+		switch arg {
+		case "-d", "--decode", "-D":
+			decode = true
+		case "-w0", "-i", "--ignore-garbage":
+		default:
+			content, err := r.Session.FS.ReadFile(r.Session.Abs(arg))
+			if err != nil {
+				return fmt.Sprintf("base64: %s: %s", arg, reason(err)), 1
+			}
+			data = content
+		}
+	}
+
+	if !decode {
+		return base64.StdEncoding.EncodeToString(data), 0
+	}
+
+	text := strings.Join(strings.Fields(string(data)), "")
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		// tolerate the missing padding, as the sloppy droppers do
+		if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(text, "=")); err != nil {
+			return "base64: invalid input", 1
+		}
+	}
+
+	return strings.TrimSuffix(string(decoded), "\n"), 0
+}
+
+func cmdCat(r *RBash, stdin string, args ...string) (string, int) {
+	var output []string
+	code := 0
+
+	if len(args) == 0 {
+		return strings.TrimSuffix(stdin, "\n"), 0
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			output = append(output, strings.TrimSuffix(stdin, "\n"))
+			continue
+		}
+
+		data, err := r.Session.FS.ReadFile(r.Session.Abs(arg))
+		if err != nil {
+			output = append(output, fmt.Sprintf("cat: %s: %s", arg, reason(err)))
+			code = 1
+			continue
+		}
+
+		output = append(output, strings.TrimSuffix(string(data), "\n"))
+	}
+
+	return strings.Join(output, "\n"), code
+}
+
+func cmdCd(r *RBash, stdin string, args ...string) (string, int) {
+	dir := r.Session.Home()
+
+	switch {
+	case len(args) > 1:
+		return "bash: cd: too many arguments", 1
+	case len(args) == 1 && args[0] == "-":
+		dir = r.Session.Getenv("OLDPWD")
+	case len(args) == 1:
+		dir = args[0]
+	}
+
+	if err := r.Session.Chdir(dir); err != nil {
+		return fmt.Sprintf("bash: cd: %s", err), 1
+	}
+
+	return "", 0
+}
+
+func cmdChmod(r *RBash, stdin string, args ...string) (string, int) {
+	if len(args) < 2 {
+		return "chmod: missing operand\nTry 'chmod --help' for more information.", 1
+	}
+
+	mode := args[0]
+	change := func(current os.FileMode) os.FileMode {
+		switch perm, err := strconv.ParseUint(mode, 8, 32); {
+		case err == nil:
+			return os.FileMode(perm)
+		case strings.Contains(mode, "+x"):
+			return current | 0111
+		case strings.Contains(mode, "-x"):
+			return current &^ 0111
+		default:
+			return current
+		}
+	}
+
+	for _, arg := range args[1:] {
+		if err := r.Session.FS.Chmod(r.Session.Abs(arg), change); err != nil {
+			return fmt.Sprintf("chmod: cannot access '%s': %s", arg, reason(err)), 1
+		}
+	}
+
+	return "", 0
+}
+
+func cmdEcho(r *RBash, stdin string, args ...string) (string, int) {
+	escape := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && strings.Trim(args[0], "-neE") == "" && args[0] != "-" {
+		escape = escape || strings.Contains(args[0], "e")
+		args = args[1:]
+	}
+
+	text := strings.Join(args, " ")
+	if escape {
+		text = unescape(text)
+	}
+
+	return text, 0
+}
+
+func cmdEnv(r *RBash, stdin string, args ...string) (string, int) {
+	return strings.Join(r.Session.Environ(), "\n"), 0
+}
+
+func cmdExit(r *RBash, stdin string, args ...string) (string, int) {
+	// leave the switched user shell, back to the previous one
+	if r.Session.Logout() {
+		return "logout", 0
+	}
+
+	r.exit = true
+
+	if len(args) > 0 {
+		code, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Sprintf("bash: exit: %s: numeric argument required", args[0]), 2
+		}
+
+		return "", code & 0xff
+	}
+
+	return "", r.ExitCode()
+}
+
+func cmdExport(r *RBash, stdin string, args ...string) (string, int) {
+	if len(args) == 0 {
+		var output []string
+		for _, env := range r.Session.Environ() {
+			key, value, _ := strings.Cut(env, "=")
+			output = append(output, fmt.Sprintf("declare -x %s=%q", key, value))
+		}
+
+		return strings.Join(output, "\n"), 0
+	}
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			value = r.Session.Getenv(key)
+		}
+
+		r.Session.Setenv(key, value)
+	}
+
+	return "", 0
+}
+
+func cmdFalse(r *RBash, stdin string, args ...string) (string, int) {
+	return "", 1
+}
+
+func cmdHistory(r *RBash, stdin string, args ...string) (string, int) {
+	var output []string
+	first, history := r.Session.numberedHistory()
+	for index, line := range history {
+		output = append(output, fmt.Sprintf("%5d  %s", first+index, line))
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdId(r *RBash, stdin string, args ...string) (string, int) {
+	user := r.Session.User()
+	if len(args) > 0 {
+		user = args[len(args)-1]
+	}
+
+	id := r.Session.UID(user)
+	if id < 0 {
+		return fmt.Sprintf("id: '%s': no such user", user), 1
+	}
+
+	return fmt.Sprintf("uid=%[1]d(%[2]s) gid=%[1]d(%[2]s) groups=%[1]d(%[2]s)", id, user), 0
+}
+
+func cmdLs(r *RBash, stdin string, args ...string) (string, int) {
+	all := false
+	dirs := []string{}
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-"):
+			all = all || strings.Contains(arg, "a")
+		default:
+			dirs = append(dirs, arg)
+		}
+	}
+
+	if len(dirs) == 0 {
+		dirs = append(dirs, ".")
+	}
+
+	var output []string
+	code := 0
+	for _, dir := range dirs {
+		files, err := r.Session.FS.ReadDir(r.Session.Abs(dir))
+		if err != nil {
+			output = append(output, fmt.Sprintf("ls: cannot access '%s': %s", dir, reason(err)))
+			code = 2
+			continue
+		}
+
+		var names []string
+		if all {
+			names = append(names, ".", "..")
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file.Name, ".") && !all {
+				continue
+			}
+			names = append(names, file.Name)
+		}
+
+		if len(dirs) > 1 {
+			output = append(output, fmt.Sprintf("%s:", dir))
+		}
+		output = append(output, strings.Join(names, "  "))
+	}
+
+	return strings.Join(output, "\n"), code
+}
+
+func cmdMkdir(r *RBash, stdin string, args ...string) (string, int) {
+	var output []string
+	code := 0
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		if err := r.Session.FS.MkdirAll(r.Session.Abs(arg)); err != nil {
+			output = append(output, fmt.Sprintf("mkdir: cannot create directory '%s': %s", arg, reason(err)))
+			code = 1
+		}
+	}
+
+	return strings.Join(output, "\n"), code
+}
+
+func cmdPwd(r *RBash, stdin string, args ...string) (string, int) {
+	return r.Session.Pwd(), 0
+}
+
+func cmdRm(r *RBash, stdin string, args ...string) (string, int) {
+	var output []string
+	code := 0
+	force := false
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			force = force || strings.Contains(arg, "f")
+			continue
+		}
+
+		if err := r.Session.FS.Remove(r.Session.Abs(arg)); err != nil && !force {
+			output = append(output, fmt.Sprintf("rm: cannot remove '%s': %s", arg, reason(err)))
+			code = 1
+		}
+	}
+
+	return strings.Join(output, "\n"), code
+}
+
+func cmdTouch(r *RBash, stdin string, args ...string) (string, int) {
+	for _, arg := range args {
+		filename := r.Session.Abs(arg)
+		if _, err := r.Session.FS.Stat(filename); err == nil {
+			continue
+		}
+
+		if err := r.Session.FS.WriteFile(filename, nil, true); err != nil {
+			return fmt.Sprintf("touch: cannot touch '%s': %s", arg, reason(err)), 1
+		}
+	}
+
+	return "", 0
+}
+
+func cmdTrue(r *RBash, stdin string, args ...string) (string, int) {
+	return "", 0
+}
+
+func cmdUnset(r *RBash, stdin string, args ...string) (string, int) {
+	for _, arg := range args {
+		r.Session.Unsetenv(arg)
+	}
+
+	return "", 0
+}
+
+func cmdWhoami(r *RBash, stdin string, args ...string) (string, int) {
+	return r.Session.User(), 0
+}
+
+// get the human-readable reason from the filesystem error.
+func reason(err error) string {
+	msg := err.Error()
+	if index := strings.LastIndex(msg, ": "); index >= 0 {
+		return msg[index+2:]
+	}
+
+	return msg
+}
+
+// interpret the backslash escapes as echo -e does, like \n, \t, \xHH and \0NNN.
+func unescape(text string) string {
+	var builder strings.Builder
+
+	for index := 0; index < len(text); index++ {
+		if text[index] != '\\' || index+1 == len(text) {
+			builder.WriteByte(text[index])
+			continue
+		}
+
+		index++
+		switch ch := text[index]; ch {
+		case 'n':
+			builder.WriteByte('\n')
+		case 't':
+			builder.WriteByte('\t')
+		case 'r':
+			builder.WriteByte('\r')
+		case '\\':
+			builder.WriteByte('\\')
+		case 'x', '0':
+			size, base, digits := 2, 16, "0123456789abcdefABCDEF"
+			if ch == '0' {
+				size, base, digits = 3, 8, "01234567"
+			}
+
+			end := index + 1
+			for end < len(text) && end <= index+size && strings.ContainsRune(digits, rune(text[end])) {
+				end++
+			}
+
+			value, err := strconv.ParseUint(text[index+1:end], base, 8)
+			if err != nil {
+				builder.WriteByte('\\')
+				builder.WriteByte(ch)
+				continue
+			}
+
+			builder.WriteByte(byte(value))
+			index = end - 1
+		default:
+			builder.WriteByte('\\')
+			builder.WriteByte(ch)
+		}
+	}
+
+	return builder.String()
+}
+
+// check the path looks like the executable path, like ./run.sh or /bin/ls.
+func isPath(name string) bool {
+	return strings.Contains(name, "/")
+}
@@ -0,0 +1,133 @@
+package shell
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// The key code of the Tab.
+const keyTab = '\t'
+
+// The command history of the session for the interactive terminal, the lines are
+// shared between all the channels of the same connection.
+type History struct {
+	session *Session
+}
+
+// Add the line into the history, it is no-op because the line is recorded when
+// executed by the shell.
+func (h *History) Add(entry string) {
+}
+
+// Get the number of the lines in the history.
+func (h *History) Len() int {
+	h.session.Lock()
+	defer h.session.Unlock()
+
+	return len(h.session.history)
+}
+
+// Get the line from the history, index 0 is the most-recently executed line.
+func (h *History) At(idx int) string {
+	h.session.Lock()
+	defer h.session.Unlock()
+
+	return h.session.history[len(h.session.history)-1-idx]
+}
+
+// Get the command history of the session for the interactive terminal.
+func (r *RBash) History() *History {
+	return &History{session: r.Session}
+}
+
+// Complete the line when the Tab is pressed, the first word of the command is
+// completed by the supported commands and others are completed by the paths in the
+// virtual filesystem. It is compatible with the AutoCompleteCallback of the terminal.
+func (r *RBash) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != keyTab {
+		return "", 0, false
+	}
+
+	prefix := line[:pos]
+	start := strings.LastIndexAny(prefix, " \t;|&") + 1
+	word := prefix[start:]
+
+	var candidates []string
+	switch segment := strings.TrimSpace(prefix[strings.LastIndexAny(prefix, ";|&")+1 : start]); {
+	case segment == "" && !strings.Contains(word, "/"):
+		candidates = r.completeCommand(word)
+	default:
+		candidates = r.completePath(word)
+	}
+
+	completed := commonPrefix(candidates)
+	switch {
+	case len(candidates) == 0:
+		return "", 0, false
+	case len(candidates) == 1 && !strings.HasSuffix(completed, "/"):
+		completed += " "
+	case len(completed) <= len(word) && r.Terminal != nil:
+		// show all the candidates as bash does when nothing can be completed
+		_, _ = r.Terminal.Write([]byte(strings.Join(candidates, "  ") + "\n"))
+		return "", 0, false
+	}
+
+	newLine := line[:start] + completed + line[pos:]
+	return newLine, start + len(completed), true
+}
+
+// complete the command name from the registry.
+func (r *RBash) completeCommand(word string) []string {
+	var candidates []string
+	for _, name := range Commands() {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	return candidates
+}
+
+// complete the path from the virtual filesystem, the directory is ended with the slash.
+func (r *RBash) completePath(word string) []string {
+	dir, base := path.Split(word)
+
+	files, err := r.Session.FS.ReadDir(r.Session.Abs(dir + "."))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, file := range files {
+		switch {
+		case !strings.HasPrefix(file.Name, base):
+			continue
+		case strings.HasPrefix(file.Name, ".") && !strings.HasPrefix(base, "."):
+			continue
+		case file.IsDir():
+			candidates = append(candidates, dir+file.Name+"/")
+		default:
+			candidates = append(candidates, dir+file.Name)
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+// get the longest common prefix of the candidates.
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
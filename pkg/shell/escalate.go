@@ -0,0 +1,184 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The policy to decide the privilege escalation, by su or sudo, is granted or not.
+type Escalation string
+
+const (
+	// Always reject the escalation, whatever the password is.
+	EscalateDeny Escalation = "deny"
+	// Always grant the escalation, whatever the password is.
+	EscalateAllow Escalation = "allow"
+	// Grant the escalation only when the password is the same as the login one.
+	EscalatePassword Escalation = "password"
+)
+
+// The maximum password attempts of sudo, as the default of the sudoers.
+const sudoRetry = 3
+
+// Get the prompt of the shell, which is changed to the root prompt when the
+// effective user is root.
+func (r *RBash) Prompt(prompt string) string {
+	if r.Session.User() == "root" && strings.HasSuffix(prompt, "$ ") {
+		prompt = strings.TrimSuffix(prompt, "$ ") + "# "
+	}
+
+	return prompt
+}
+
+// Ask the password from the terminal and check it based on the escalation policy.
+func (r *RBash) authenticate(prompt, username string) (bool, error) {
+	if r.Terminal == nil {
+		return false, fmt.Errorf("a terminal is required to read the password")
+	}
+
+	password, err := r.Terminal.ReadPassword(prompt)
+	if err != nil {
+		return false, err
+	}
+
+	if r.Recorder != nil {
+		r.Recorder.Credential(r.Session, username, password)
+	}
+
+	switch r.Escalate {
+	case EscalateAllow:
+		return true, nil
+	case EscalatePassword:
+		return password == r.Session.Password, nil
+	default:
+		return false, nil
+	}
+}
+
+func cmdSu(r *RBash, stdin string, args ...string) (string, int) {
+	username := "root"
+	login := false
+
+	for _, arg := range args {
+		switch arg {
+		case "-", "-l", "--login":
+			login = true
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				username = arg
+			}
+		}
+	}
+
+	if r.Session.UID(username) < 0 {
+		return fmt.Sprintf("su: user %s does not exist or the user entry does not contain all the required fields", username), 1
+	}
+
+	if r.Session.User() != "root" {
+		switch ok, err := r.authenticate("Password: ", username); {
+		case err != nil:
+			return fmt.Sprintf("su: %s", err), 1
+		case !ok:
+			log.Info().Str("session", r.Session.ID).Str("user", username).Msg("reject the su escalation")
+			return "su: Authentication failure", 1
+		}
+	}
+
+	log.Info().Str("session", r.Session.ID).Str("user", username).Msg("grant the su escalation")
+	r.Session.Login(username, login)
+	return "", 0
+}
+
+func cmdSudo(r *RBash, stdin string, args ...string) (string, int) {
+	username := "root"
+	shell := false
+	login := false
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-i", "--login":
+			shell, login = true, true
+		case "-s", "--shell":
+			shell = true
+		case "-u", "--user":
+			if len(args) > 1 {
+				username = args[1]
+				args = args[1:]
+			}
+		case "-h", "--help", "-V", "--version":
+			return "Sudo version 1.9.9", 0
+		}
+
+		args = args[1:]
+	}
+
+	if !shell && len(args) == 0 {
+		return "usage: sudo -h | -K | -k | -V\nusage: sudo [-AbEHknPS] [-C num] [-D directory] [-g group] [-h host] [-p prompt] [-R directory] [-T timeout] [-u user] [VAR=value] [-i|-s] [<command>]", 1
+	}
+
+	if r.Session.UID(username) < 0 {
+		return fmt.Sprintf("sudo: unknown user %s", username), 1
+	}
+
+	if output, code := r.sudo(); code != 0 {
+		return output, code
+	}
+
+	switch {
+	case shell && len(args) == 0:
+		r.Session.Login(username, login)
+		return "", 0
+	case args[0] == "su" || args[0] == "bash" || args[0] == "sh":
+		// the root shell by sudo su, the client may want to switch to another user
+		r.Session.Login(username, true)
+		if args[0] == "su" && len(args) > 1 {
+			return cmdSu(r, stdin, args[1:]...)
+		}
+		return "", 0
+	default:
+		// execute the command as the user, and switch back after done
+		r.Session.Login(username, false)
+		defer r.Session.Logout()
+		return r.exec(stdin, args[0], args[1:]...)
+	}
+}
+
+// check the sudo credential, ask the password if not cached.
+func (r *RBash) sudo() (string, int) {
+	user := r.Session.User()
+
+	r.Session.Lock()
+	cached := r.Session.sudoer
+	r.Session.Unlock()
+
+	if user == "root" || cached {
+		return "", 0
+	}
+
+	prompt := fmt.Sprintf("[sudo] password for %s: ", user)
+	for retry := 0; retry < sudoRetry; retry++ {
+		ok, err := r.authenticate(prompt, user)
+		switch {
+		case err != nil:
+			output := []string{
+				fmt.Sprintf("sudo: %s; either use the -S option to read from standard input or configure an askpass helper", err),
+				"sudo: a password is required",
+			}
+			return strings.Join(output, "\n"), 1
+		case ok:
+			log.Info().Str("session", r.Session.ID).Str("user", user).Msg("grant the sudo escalation")
+
+			r.Session.Lock()
+			r.Session.sudoer = true
+			r.Session.Unlock()
+			return "", 0
+		case retry < sudoRetry-1:
+			_, _ = r.Terminal.Write([]byte("Sorry, try again.\n"))
+		}
+	}
+
+	log.Info().Str("session", r.Session.ID).Str("user", user).Msg("reject the sudo escalation")
+	return fmt.Sprintf("sudo: %d incorrect password attempts", sudoRetry), 1
+}
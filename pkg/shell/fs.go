@@ -0,0 +1,333 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The maximum size of the file in the virtual filesystem.
+	maxFileSize = 4 << 20
+	// The maximum total size of the files in the virtual filesystem of the session.
+	maxQuota = 16 << 20
+)
+
+// The file or directory in the virtual filesystem.
+type File struct {
+	Name    string
+	Mode    os.FileMode
+	ModTime time.Time
+
+	data     []byte
+	children map[string]*File
+	// generate the content on read, for the pseudo file like /proc/uptime
+	generate func() []byte
+}
+
+// Check the file is the directory or not.
+func (f *File) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// get the copy of the file without the children, the content is shared and never
+// changed in place.
+func (f *File) snapshot() *File {
+	return &File{Name: f.Name, Mode: f.Mode, ModTime: f.ModTime, data: f.data[:len(f.data):len(f.data)], generate: f.generate}
+}
+
+// Get the size of the file.
+func (f *File) Size() int {
+	switch f.IsDir() {
+	case true:
+		return 4096
+	default:
+		return len(f.data)
+	}
+}
+
+// The in-memory virtual filesystem that only lives within the session, all the
+// changes are discarded when the session is closed.
+type FileSystem struct {
+	sync.RWMutex
+
+	root *File
+	// the total size of the files
+	used int
+}
+
+// NewFileSystem creates the virtual filesystem with the common Linux layout.
+func NewFileSystem(username string) *FileSystem {
+	fs := &FileSystem{
+		root: &File{Name: "/", Mode: os.ModeDir | 0755, ModTime: time.Now(), children: map[string]*File{}},
+	}
+
+	dirs := []string{
+		"/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/media", "/mnt", "/opt", "/proc",
+		"/root", "/run", "/sbin", "/srv", "/sys", "/tmp", "/usr/bin", "/usr/lib", "/usr/local/bin",
+		"/usr/sbin", "/usr/share", "/var/log", "/var/tmp", "/var/www",
+	}
+	for _, dir := range dirs {
+		_ = fs.MkdirAll(dir)
+	}
+
+	home := HomeDir(username)
+	files := map[string]string{
+		"/etc/hostname":            "ubuntu\n",
+		"/etc/shells":              "/bin/sh\n/bin/bash\n/bin/rbash\n",
+		"/etc/passwd":              passwd(username),
+		home + "/.bashrc":          "# ~/.bashrc: executed by bash(1) for non-login shells.\n",
+		home + "/.profile":         "# ~/.profile: executed by the command interpreter for login shells.\n",
+		home + "/.ssh/known_hosts": "",
+	}
+	for name, data := range files {
+		_ = fs.MkdirAll(path.Dir(name))
+		_ = fs.WriteFile(name, []byte(data), false)
+	}
+
+	return fs
+}
+
+// Get the file information of the path, as the snapshot that is safe to read
+// without the lock.
+func (fs *FileSystem) Stat(name string) (*File, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	file, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return file.snapshot(), nil
+}
+
+// List the entries of the directory, sorted by the name.
+func (fs *FileSystem) ReadDir(name string) ([]*File, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	dir, err := fs.lookup(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case !dir.IsDir():
+		return []*File{dir.snapshot()}, nil
+	}
+
+	files := make([]*File, 0, len(dir.children))
+	for _, file := range dir.children {
+		files = append(files, file.snapshot())
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Read the content of the file.
+func (fs *FileSystem) ReadFile(name string) ([]byte, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	file, err := fs.lookup(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case file.IsDir():
+		return nil, fmt.Errorf("%s: Is a directory", name)
+	case file.generate != nil:
+		return file.generate(), nil
+	}
+
+	data := make([]byte, len(file.data))
+	copy(data, file.data)
+	return data, nil
+}
+
+// Write the content into the file, create the file if not exists. The write
+// fails when the file or the total size of the files exceeds the limit.
+func (fs *FileSystem) WriteFile(name string, data []byte, extend bool) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	dir, err := fs.lookup(path.Dir(name))
+	switch {
+	case err != nil:
+		return err
+	case !dir.IsDir():
+		return fmt.Errorf("%s: Not a directory", name)
+	}
+
+	base := path.Base(name)
+	file, ok := dir.children[base]
+	if ok && file.IsDir() {
+		return fmt.Errorf("%s: Is a directory", name)
+	}
+
+	size := len(data)
+	if ok && extend {
+		size += len(file.data)
+	}
+
+	used := fs.used + size
+	if ok {
+		used -= len(file.data)
+	}
+
+	if size > maxFileSize || used > maxQuota {
+		return fmt.Errorf("%s: No space left on device", name)
+	}
+
+	if !ok {
+		file = &File{Name: base, Mode: 0644}
+		dir.children[base] = file
+	}
+
+	fs.used = used
+	switch extend {
+	case true:
+		file.data = append(file.data, data...)
+	default:
+		file.data = data
+	}
+
+	file.generate = nil
+	file.ModTime = time.Now()
+	return nil
+}
+
+// Mount the pseudo file that the content is generated on read, the parent
+// directories are created if not exist.
+func (fs *FileSystem) Mount(name string, generate func() []byte) error {
+	if err := fs.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+
+	if err := fs.WriteFile(name, nil, false); err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	file, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	file.generate = generate
+	return nil
+}
+
+// Create the directory and all the necessary parents.
+func (fs *FileSystem) MkdirAll(name string) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	dir := fs.root
+	for _, part := range split(name) {
+		child, ok := dir.children[part]
+		switch {
+		case !ok:
+			child = &File{Name: part, Mode: os.ModeDir | 0755, ModTime: time.Now(), children: map[string]*File{}}
+			dir.children[part] = child
+		case !child.IsDir():
+			return fmt.Errorf("%s: Not a directory", name)
+		}
+
+		dir = child
+	}
+
+	return nil
+}
+
+// Remove the file or the empty directory.
+func (fs *FileSystem) Remove(name string) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	dir, err := fs.lookup(path.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	base := path.Base(name)
+	file, ok := dir.children[base]
+	switch {
+	case !ok:
+		return fmt.Errorf("%s: No such file or directory", name)
+	case file.IsDir() && len(file.children) > 0:
+		return fmt.Errorf("%s: Directory not empty", name)
+	}
+
+	fs.used -= len(file.data)
+	delete(dir.children, base)
+	return nil
+}
+
+// Change the mode of the file by the callback, which gets the current mode and
+// returns the new one.
+func (fs *FileSystem) Chmod(name string, change func(os.FileMode) os.FileMode) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	file, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	file.Mode = file.Mode&os.ModeType | change(file.Mode)&os.ModePerm
+	return nil
+}
+
+// lookup the file by the absolute path, the caller should hold the lock.
+func (fs *FileSystem) lookup(name string) (*File, error) {
+	file := fs.root
+	for _, part := range split(name) {
+		child, ok := file.children[part]
+		if !ok {
+			return nil, fmt.Errorf("%s: No such file or directory", name)
+		}
+
+		file = child
+	}
+
+	return file, nil
+}
+
+// split the absolute path into the non-empty parts.
+func split(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// generate the fake /etc/passwd that contains the logged-in user.
+func passwd(username string) string {
+	lines := []string{
+		"root:x:0:0:root:/root:/bin/bash",
+		"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin",
+		"bin:x:2:2:bin:/bin:/usr/sbin/nologin",
+		"sys:x:3:3:sys:/dev:/usr/sbin/nologin",
+		"www-data:x:33:33:www-data:/var/www:/usr/sbin/nologin",
+		"nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin",
+		"sshd:x:110:65534::/run/sshd:/usr/sbin/nologin",
+	}
+
+	switch username {
+	case "root", "nobody":
+	default:
+		lines = append(lines, fmt.Sprintf("%[1]s:x:1000:1000:%[1]s:%[2]s:/bin/rbash", username, HomeDir(username)))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,107 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileSystemWriteFileLimit(t *testing.T) {
+	block := bytes.Repeat([]byte("x"), 1<<20)
+
+	cases := []struct {
+		name   string
+		writes []int
+		extend bool
+		err    bool
+	}{
+		{name: "small", writes: []int{1}},
+		{name: "file-cap", writes: []int{maxFileSize>>20 + 1}, err: true},
+		{name: "extend-cap", writes: []int{maxFileSize >> 20, 1}, extend: true, err: true},
+		{name: "overwrite", writes: []int{maxFileSize >> 20, maxFileSize >> 20, maxFileSize >> 20}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := NewFileSystem("root")
+
+			var err error
+			for _, size := range c.writes {
+				if err = fs.WriteFile("/tmp/a", bytes.Repeat(block, size), c.extend); err != nil {
+					break
+				}
+			}
+
+			switch {
+			case c.err && (err == nil || !strings.HasSuffix(err.Error(), "No space left on device")):
+				t.Errorf("expect no space left, got %v", err)
+			case !c.err && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileSystemQuota(t *testing.T) {
+	fs := NewFileSystem("root")
+	data := bytes.Repeat([]byte("x"), maxFileSize)
+
+	var err error
+	var count int
+	for count = 0; count < maxQuota/maxFileSize+1; count++ {
+		if err = fs.WriteFile("/tmp/"+string(rune('a'+count)), data, false); err != nil {
+			break
+		}
+	}
+
+	if err == nil || count != maxQuota/maxFileSize-1 {
+		t.Fatalf("expect the quota exceeded after %d files, got %d: %v", maxQuota/maxFileSize-1, count, err)
+	}
+
+	// the space is released after the file is removed
+	if err := fs.Remove("/tmp/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/tmp/z", data, false); err != nil {
+		t.Errorf("expect the space released, got %v", err)
+	}
+}
+
+func TestFileSystemChmod(t *testing.T) {
+	fs := NewFileSystem("root")
+	if err := fs.WriteFile("/tmp/a", []byte("#!/bin/sh\n"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Chmod("/tmp/a", func(mode os.FileMode) os.FileMode { return mode | 0111 }); err != nil {
+		t.Fatal(err)
+	}
+
+	switch file, err := fs.Stat("/tmp/a"); {
+	case err != nil:
+		t.Fatal(err)
+	case file.Mode != 0755:
+		t.Errorf("expect the mode 0755, got %v", file.Mode)
+	}
+
+	if err := fs.Chmod("/tmp/missing", func(mode os.FileMode) os.FileMode { return mode }); err == nil {
+		t.Errorf("expect the error of the missing file")
+	}
+}
+
+func TestFileSystemGrowth(t *testing.T) {
+	r := New(NewSession("", "root", nil))
+	r.Exec("echo 0123456789abcde > /tmp/a")
+
+	line := strings.Repeat("cat /tmp/a /tmp/a > /tmp/b; cat /tmp/b /tmp/b > /tmp/a; ", 11)
+	output := r.Exec(line)
+
+	if !strings.Contains(output, "No space left on device") {
+		t.Errorf("expect no space left on device, got %q", output)
+	}
+
+	if file, err := r.Session.FS.Stat("/tmp/a"); err != nil || file.Size() > maxFileSize {
+		t.Errorf("expect the file within the limit, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package shell
+
+import (
+	"strings"
+)
+
+// The pipeline of the commands, joined by the operator with the previous one.
+type pipeline struct {
+	// The operator before the pipeline, one of ";", "&&" and "||".
+	op       string
+	commands []*command
+}
+
+// The simple command with the raw words and the I/O redirections.
+type command struct {
+	raw       string
+	redirects []redirect
+}
+
+// The I/O redirection of the command, like > file, < file or <<< word.
+type redirect struct {
+	op     string
+	target string
+}
+
+// parse the command line into the pipelines, the words are kept raw and expanded
+// right before the command is executed.
+func parse(line string) []*pipeline {
+	var pipelines []*pipeline
+
+	current := &pipeline{op: ";"}
+	cmd := &command{}
+	var raw strings.Builder
+
+	// flush the current command into the pipeline
+	flushCommand := func() {
+		cmd.raw = strings.TrimSpace(raw.String())
+		raw.Reset()
+
+		if cmd.raw != "" || len(cmd.redirects) > 0 {
+			current.commands = append(current.commands, cmd)
+		}
+		cmd = &command{}
+	}
+	// flush the current pipeline, the next one is joined by the operator
+	flushPipeline := func(op string) {
+		flushCommand()
+
+		if len(current.commands) > 0 {
+			pipelines = append(pipelines, current)
+		}
+		current = &pipeline{op: op}
+	}
+
+	runes := []rune(line)
+	for index := 0; index < len(runes); index++ {
+		ch := runes[index]
+		next := rune(0)
+		if index+1 < len(runes) {
+			next = runes[index+1]
+		}
+
+		switch {
+		case ch == '\\' && next != 0:
+			raw.WriteRune(ch)
+			raw.WriteRune(next)
+			index++
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := closing(runes, index+1, ch)
+			raw.WriteString(string(runes[index:end]))
+			index = end - 1
+		case ch == '$' && next == '(':
+			end, _ := closingParen(runes, index+2)
+			raw.WriteString(string(runes[index:end]))
+			index = end - 1
+		case ch == '#' && (raw.Len() == 0 || isBlank(lastRune(raw.String()))):
+			// the comment till the end of the line
+			for index < len(runes) && runes[index] != '\n' {
+				index++
+			}
+			index--
+		case ch == ';' || ch == '\n':
+			flushPipeline(";")
+		case ch == '&' && next == '&':
+			flushPipeline("&&")
+			index++
+		case ch == '|' && next == '|':
+			flushPipeline("||")
+			index++
+		case ch == '|':
+			flushCommand()
+		case ch == '&' && next == '>':
+			index = parseRedirect(runes, index+1, cmd, "&")
+		case ch == '&':
+			// run in the background, treat as the sequential command
+			flushPipeline(";")
+		case ch == '>' || ch == '<':
+			prefix := ""
+			if text := raw.String(); strings.HasSuffix(text, "2") && (len(text) == 1 || isBlank(lastRune(text[:len(text)-1]))) {
+				// the stderr redirection, like 2>/dev/null
+				raw.Reset()
+				raw.WriteString(text[:len(text)-1])
+				prefix = "2"
+			}
+			index = parseRedirect(runes, index, cmd, prefix)
+		default:
+			raw.WriteRune(ch)
+		}
+	}
+
+	flushPipeline(";")
+	return pipelines
+}
+
+// parse the redirection from the operator, return the index of the last consumed rune.
+func parseRedirect(runes []rune, index int, cmd *command, prefix string) int {
+	op := string(runes[index])
+	if index+1 < len(runes) && runes[index+1] == runes[index] {
+		op += op
+		index++
+	}
+	// the here-string, like <<< word
+	if op == "<<" && index+1 < len(runes) && runes[index+1] == '<' {
+		op = "<<<"
+		index++
+	}
+
+	// the file descriptor duplication, like 2>&1
+	if index+1 < len(runes) && runes[index+1] == '&' {
+		index += 2
+		for index < len(runes) && !isBlank(runes[index]) {
+			index++
+		}
+		return index - 1
+	}
+
+	// skip the blanks between the operator and the target
+	index++
+	for index < len(runes) && isBlank(runes[index]) {
+		index++
+	}
+
+	start := index
+	for index < len(runes) && !isBlank(runes[index]) && !strings.ContainsRune(";&|<>\n", runes[index]) {
+		switch {
+		case runes[index] == '\\' && index+1 < len(runes):
+			index++
+		case runes[index] == '\'' || runes[index] == '"' || runes[index] == '`':
+			index = closing(runes, index+1, runes[index]) - 1
+		case runes[index] == '$' && index+1 < len(runes) && runes[index+1] == '(':
+			end, _ := closingParen(runes, index+2)
+			index = end - 1
+		}
+		index++
+	}
+
+	cmd.redirects = append(cmd.redirects, redirect{op: prefix + op, target: string(runes[start:index])})
+	return index - 1
+}
+
+// find the index after the closing quote, or the end of the runes.
+func closing(runes []rune, index int, quote rune) int {
+	_, end := quoted(runes, index, quote)
+	return end
+}
+
+// get the content till the closing quote and the index after the quote, the
+// content runs to the end of the runes when the quote is not closed.
+func quoted(runes []rune, index int, quote rune) ([]rune, int) {
+	start := min(index, len(runes))
+	for ; index < len(runes); index++ {
+		switch {
+		case runes[index] == '\\' && quote != '\'':
+			index++
+		case runes[index] == quote:
+			return runes[start:index], index + 1
+		}
+	}
+
+	return runes[start:], len(runes)
+}
+
+// find the index after the closing parenthesis, or the end of the runes when the
+// parenthesis is not closed.
+func closingParen(runes []rune, index int) (int, bool) {
+	depth := 1
+	for ; index < len(runes); index++ {
+		switch runes[index] {
+		case '\'', '"', '`':
+			index = closing(runes, index+1, runes[index]) - 1
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return index + 1, true
+			}
+		}
+	}
+
+	return len(runes), false
+}
+
+func isBlank(ch rune) bool {
+	return ch == ' ' || ch == '\t'
+}
+
+func lastRune(text string) rune {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	return runes[len(runes)-1]
+}
@@ -0,0 +1,148 @@
+package shell
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// the terminal that always answers the same password, and keeps the output.
+type fakeTerminal struct {
+	password string
+	output   bytes.Buffer
+}
+
+func (t *fakeTerminal) Write(p []byte) (int, error) {
+	return t.output.Write(p)
+}
+
+func (t *fakeTerminal) ReadPassword(prompt string) (string, error) {
+	return t.password, nil
+}
+
+func TestParse(t *testing.T) {
+	type cmd struct {
+		raw       string
+		redirects []redirect
+	}
+
+	cases := []struct {
+		line string
+		ops  []string
+		cmds [][]cmd
+	}{
+		{line: "ls -la", ops: []string{";"}, cmds: [][]cmd{{{raw: "ls -la"}}}},
+		{line: "a; b && c || d", ops: []string{";", ";", "&&", "||"}, cmds: [][]cmd{{{raw: "a"}}, {{raw: "b"}}, {{raw: "c"}}, {{raw: "d"}}}},
+		{line: "cat x | grep y", ops: []string{";"}, cmds: [][]cmd{{{raw: "cat x"}, {raw: "grep y"}}}},
+		{line: "echo 'a; b' \"c | d\"", ops: []string{";"}, cmds: [][]cmd{{{raw: "echo 'a; b' \"c | d\""}}}},
+		{line: "echo $(a; b) # comment", ops: []string{";"}, cmds: [][]cmd{{{raw: "echo $(a; b)"}}}},
+		{line: "echo a > f 2>/dev/null", ops: []string{";"}, cmds: [][]cmd{{{raw: "echo a", redirects: []redirect{{">", "f"}, {"2>", "/dev/null"}}}}}},
+		{line: "echo a >> 'my file'", ops: []string{";"}, cmds: [][]cmd{{{raw: "echo a", redirects: []redirect{{">>", "'my file'"}}}}}},
+		{line: "cat < f 2>&1", ops: []string{";"}, cmds: [][]cmd{{{raw: "cat", redirects: []redirect{{"<", "f"}}}}}},
+		{line: "base64 -d <<< aGk=", ops: []string{";"}, cmds: [][]cmd{{{raw: "base64 -d", redirects: []redirect{{"<<<", "aGk="}}}}}},
+		{line: "cat <<<$(echo a b)|sh", ops: []string{";"}, cmds: [][]cmd{{{raw: "cat", redirects: []redirect{{"<<<", "$(echo a b)"}}}, {raw: "sh"}}}},
+		{line: "echo 'abc", ops: []string{";"}, cmds: [][]cmd{{{raw: "echo 'abc"}}}},
+		{line: "sleep 1 & echo a", ops: []string{";", ";"}, cmds: [][]cmd{{{raw: "sleep 1"}}, {{raw: "echo a"}}}},
+		{line: "  ;; ", ops: nil, cmds: nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			var ops []string
+			var cmds [][]cmd
+
+			for _, p := range parse(c.line) {
+				ops = append(ops, p.op)
+
+				var group []cmd
+				for _, command := range p.commands {
+					group = append(group, cmd{raw: command.raw, redirects: command.redirects})
+				}
+				cmds = append(cmds, group)
+			}
+
+			if !reflect.DeepEqual(ops, c.ops) {
+				t.Errorf("expect the operators %q, got %q", c.ops, ops)
+			}
+			if !reflect.DeepEqual(cmds, c.cmds) {
+				t.Errorf("expect the commands %+v, got %+v", c.cmds, cmds)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	cases := []struct {
+		command string
+		args    []string
+	}{
+		{command: "echo a  b", args: []string{"echo", "a", "b"}},
+		{command: "echo 'a  b' \"c d\"", args: []string{"echo", "a  b", "c d"}},
+		{command: "echo 'abc", args: []string{"echo", "abc"}},
+		{command: "echo \"abc", args: []string{"echo", "abc"}},
+		{command: "echo ''", args: []string{"echo", ""}},
+		{command: "echo a\\ b", args: []string{"echo", "a b"}},
+		{command: "echo $X \"$X\" '$X' ${X}y", args: []string{"echo", "1", "1", "$X", "1y"}},
+		{command: "echo ${X", args: []string{"echo", "1"}},
+		{command: "echo ~ ~/a a~", args: []string{"echo", "/root", "/root/a", "a~"}},
+		{command: "echo $(echo a) `echo b`", args: []string{"echo", "a", "b"}},
+		{command: "echo `echo a", args: []string{"echo", "a"}},
+		{command: "echo $((1 + 2 * 3)) $(( (1+2)*3 ))", args: []string{"echo", "7", "9"}},
+		{command: "echo $((X + 1)) $(($X << 4)) $((-X))", args: []string{"echo", "2", "16", "-1"}},
+		{command: "echo $((2**10)) $((7 % 3)) $((7 / 2)) $((0x10)) $((010))", args: []string{"echo", "1024", "1", "3", "16", "8"}},
+		{command: "echo $((1 < 2 && 2 <= 1)) $((1 || 0)) $((!0)) $((~0)) $((5 & 3 | 8 ^ 1))", args: []string{"echo", "0", "1", "1", "-1", "9"}},
+		{command: "echo $((1/0)) $NOPE \"$NOPE\"", args: []string{"echo", ""}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.command, func(t *testing.T) {
+			r := New(NewSession("", "root", nil))
+			r.Session.Setenv("X", "1")
+
+			if args := r.expand(c.command); !reflect.DeepEqual(args, c.args) {
+				t.Errorf("expect %q, got %q", c.args, args)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	cases := []struct {
+		line   string
+		output string
+	}{
+		{line: "$((1+2))", output: "bash: 3: command not found"},
+		{line: "echo $((1/0))", output: `bash: 1/0: division by 0 (error token is "0")`},
+		{line: "echo $((1+))", output: `bash: 1+: syntax error: operand expected (error token is "+")`},
+		// the failed expansion fails the command with the status 1
+		{line: "echo $((5/0)); echo $?", output: "bash: 5/0: division by 0 (error token is \"0\")\n1"},
+		{line: "echo $((5/0)) && echo ran", output: `bash: 5/0: division by 0 (error token is "0")`},
+		{line: "echo $((5/0)) || echo failed", output: "bash: 5/0: division by 0 (error token is \"0\")\nfailed"},
+		{line: "X=$((1/0)); echo \"[$X]\" $?", output: "bash: 1/0: division by 0 (error token is \"0\")\n[] 1"},
+		{line: "echo $((1/0)) > /tmp/a; cat /tmp/a", output: "bash: 1/0: division by 0 (error token is \"0\")\ncat: /tmp/a: No such file or directory"},
+		{line: "echo $(echo $((1/0)); echo $?) $?", output: "bash: 1/0: division by 0 (error token is \"0\")\n1 0"},
+		{line: "echo $(nope) a", output: "bash: nope: command not found\na"},
+		{line: "nope | cat", output: "bash: nope: command not found"},
+		{line: "nope > /tmp/a; cat /tmp/a", output: "bash: nope: command not found"},
+		{line: "echo a; nope; echo b", output: "a\nbash: nope: command not found\nb"},
+		{line: "echo 'abc", output: "abc"},
+		{line: "base64 -d <<< aGVsbG8=", output: "hello"},
+		{line: "cat <<< 'a  b'", output: "a  b"},
+		{line: "cat <<<$(echo hi there)", output: "hi there"},
+		{line: "sudo -s whoami", output: "root"},
+		{line: "sudo -s; whoami", output: "root"},
+		{line: "sudo -u root whoami; whoami", output: "root\nalice"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			r := New(NewSession("", "alice", nil))
+			r.Terminal = &fakeTerminal{password: "secret"}
+			r.Escalate = EscalateAllow
+
+			if output := r.Exec(c.line); output != c.output {
+				t.Errorf("expect %q, got %q", c.output, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package shell
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// The time the process started, the boot time of all the personas are based on it
+// so the uptime keeps advancing in the real time.
+var started = time.Now()
+
+// The fake hardware and system model of the host, all the system-inspection commands
+// are derived from the same persona so the answers never contradict each other.
+type Persona struct {
+	Name     string
+	Hostname string
+
+	// The OS release information.
+	OSName     string
+	OSID       string
+	OSVersion  string
+	OSCodename string
+
+	// The kernel release, version and the compiler that builds the kernel.
+	Kernel   string
+	Build    string
+	Compiler string
+	Arch     string
+
+	// The CPU model and the number of cores.
+	VendorID  string
+	CPUModel  string
+	CPUFamily int
+	Model     int
+	Stepping  int
+	MHz       float64
+	CacheKB   int
+	Cores     int
+
+	// The total memory in MiB and the total disk size in GiB.
+	Memory int
+	Disk   int
+
+	// The uptime when the process is started.
+	Uptime time.Duration
+}
+
+// The built-in personas.
+var personas = map[string]*Persona{
+	"ubuntu": {
+		Name:       "ubuntu",
+		Hostname:   "ubuntu-s-2vcpu-4gb-sgp1-01",
+		OSName:     "Ubuntu 22.04.4 LTS",
+		OSID:       "ubuntu",
+		OSVersion:  "22.04",
+		OSCodename: "jammy",
+		Kernel:     "5.15.0-113-generic",
+		Build:      "#123-Ubuntu SMP Mon Jun 10 08:16:17 UTC 2024",
+		Compiler:   "gcc (Ubuntu 11.4.0-1ubuntu1~22.04) 11.4.0, GNU ld (GNU Binutils for Ubuntu) 2.38",
+		Arch:       "x86_64",
+		VendorID:   "GenuineIntel",
+		CPUModel:   "DO-Regular",
+		CPUFamily:  6,
+		Model:      85,
+		Stepping:   7,
+		MHz:        2494.140,
+		CacheKB:    4096,
+		Cores:      2,
+		Memory:     3916,
+		Disk:       77,
+		Uptime:     37*24*time.Hour + 3*time.Hour + 12*time.Minute,
+	},
+	"debian": {
+		Name:       "debian",
+		Hostname:   "debian-12",
+		OSName:     "Debian GNU/Linux 12 (bookworm)",
+		OSID:       "debian",
+		OSVersion:  "12",
+		OSCodename: "bookworm",
+		Kernel:     "6.1.0-21-amd64",
+		Build:      "#1 SMP PREEMPT_DYNAMIC Debian 6.1.90-1 (2024-05-03)",
+		Compiler:   "gcc-12 (Debian 12.2.0-14) 12.2.0, GNU ld (GNU Binutils for Debian) 2.40",
+		Arch:       "x86_64",
+		VendorID:   "AuthenticAMD",
+		CPUModel:   "AMD EPYC 7543 32-Core Processor",
+		CPUFamily:  25,
+		Model:      1,
+		Stepping:   1,
+		MHz:        2794.748,
+		CacheKB:    512,
+		Cores:      4,
+		Memory:     7940,
+		Disk:       158,
+		Uptime:     12*24*time.Hour + 19*time.Hour + 47*time.Minute,
+	},
+	"centos": {
+		Name:       "centos",
+		Hostname:   "localhost.localdomain",
+		OSName:     "CentOS Linux 7 (Core)",
+		OSID:       "centos",
+		OSVersion:  "7",
+		OSCodename: "Core",
+		Kernel:     "3.10.0-1160.119.1.el7.x86_64",
+		Build:      "#1 SMP Tue Jun 4 14:43:51 UTC 2024",
+		Compiler:   "gcc version 4.8.5 20150623 (Red Hat 4.8.5-44) (GCC)",
+		Arch:       "x86_64",
+		VendorID:   "GenuineIntel",
+		CPUModel:   "Intel(R) Xeon(R) Gold 6148 CPU @ 2.40GHz",
+		CPUFamily:  6,
+		Model:      85,
+		Stepping:   4,
+		MHz:        2399.998,
+		CacheKB:    28160,
+		Cores:      8,
+		Memory:     15884,
+		Disk:       200,
+		Uptime:     211*24*time.Hour + 6*time.Hour + 5*time.Minute,
+	},
+}
+
+// The default persona when not specified.
+const DefaultPersona = "ubuntu"
+
+// Get the built-in persona by the name, return nil if not found.
+func LookupPersona(name string) *Persona {
+	return personas[name]
+}
+
+// Get the boot time of the host.
+func (p *Persona) Boot() time.Time {
+	return started.Add(-p.Uptime).Truncate(time.Second)
+}
+
+// Get the current uptime of the host.
+func (p *Persona) Up() time.Duration {
+	return time.Since(p.Boot())
+}
+
+// Get the load average of the last 1, 5 and 15 minutes, it slowly varies with
+// the time but keeps the same value in the same minute.
+func (p *Persona) Load() [3]float64 {
+	minute := float64(time.Now().Unix() / 60)
+	base := 0.02 * float64(p.Cores)
+
+	return [3]float64{
+		base + 0.06*math.Abs(math.Sin(minute/7)),
+		base + 0.03*math.Abs(math.Sin(minute/31)),
+		base + 0.01*math.Abs(math.Sin(minute/97)),
+	}
+}
+
+// Get the memory usage in KiB: total, used, free, shared, buff/cache and available.
+func (p *Persona) MemoryUsage() (total, used, free, shared, cache, available int) {
+	total = p.Memory * 1024
+	used = total * 22 / 100
+	shared = total / 400
+	cache = total * 41 / 100
+	free = total - used - cache
+	available = free + cache*9/10
+	return
+}
+
+// Get the uname of the host, the same as the uname -a.
+func (p *Persona) Uname() string {
+	return fmt.Sprintf("Linux %s %s %s %s %s %s GNU/Linux", p.Hostname, p.Kernel, p.Build, p.Arch, p.Arch, p.Arch)
+}
+
+// mount the pseudo files of the persona into the virtual filesystem.
+func (p *Persona) mount(fs *FileSystem) {
+	files := map[string]func() []byte{
+		"/etc/hostname":   func() []byte { return []byte(p.Hostname + "\n") },
+		"/etc/issue":      func() []byte { return []byte(p.OSName + " \\n \\l\n\n") },
+		"/etc/os-release": p.osRelease,
+		"/proc/cpuinfo":   p.cpuinfo,
+		"/proc/loadavg":   p.loadavg,
+		"/proc/meminfo":   p.meminfo,
+		"/proc/uptime":    p.uptime,
+		"/proc/version":   p.version,
+	}
+
+	for name, generate := range files {
+		_ = fs.Mount(name, generate)
+	}
+}
+
+func (p *Persona) osRelease() []byte {
+	lines := []string{
+		fmt.Sprintf("PRETTY_NAME=%q", p.OSName),
+		fmt.Sprintf("NAME=%q", strings.SplitN(p.OSName, " ", 2)[0]),
+		fmt.Sprintf("VERSION_ID=%q", p.OSVersion),
+		fmt.Sprintf("VERSION_CODENAME=%s", p.OSCodename),
+		fmt.Sprintf("ID=%s", p.OSID),
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func (p *Persona) cpuinfo() []byte {
+	var blocks []string
+	for index := 0; index < p.Cores; index++ {
+		lines := []string{
+			fmt.Sprintf("processor\t: %d", index),
+			fmt.Sprintf("vendor_id\t: %s", p.VendorID),
+			fmt.Sprintf("cpu family\t: %d", p.CPUFamily),
+			fmt.Sprintf("model\t\t: %d", p.Model),
+			fmt.Sprintf("model name\t: %s", p.CPUModel),
+			fmt.Sprintf("stepping\t: %d", p.Stepping),
+			"microcode\t: 0x1",
+			fmt.Sprintf("cpu MHz\t\t: %.3f", p.MHz),
+			fmt.Sprintf("cache size\t: %d KB", p.CacheKB),
+			fmt.Sprintf("physical id\t: %d", index),
+			"siblings\t: 1",
+			"core id\t\t: 0",
+			"cpu cores\t: 1",
+			fmt.Sprintf("apicid\t\t: %d", index),
+			"fpu\t\t: yes",
+			"fpu_exception\t: yes",
+			"cpuid level\t: 13",
+			"wp\t\t: yes",
+			"flags\t\t: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr pge mca cmov pat pse36 clflush mmx fxsr sse sse2 ss syscall nx pdpe1gb rdtscp lm constant_tsc rep_good nopl xtopology cpuid tsc_known_freq pni pclmulqdq ssse3 fma cx16 pcid sse4_1 sse4_2 x2apic movbe popcnt aes xsave avx f16c rdrand hypervisor lahf_lm abm 3dnowprefetch fsgsbase bmi1 avx2 smep bmi2 erms invpcid xsaveopt arat",
+			fmt.Sprintf("bogomips\t: %.2f", p.MHz*2),
+			"clflush size\t: 64",
+			"cache_alignment\t: 64",
+			"address sizes\t: 40 bits physical, 48 bits virtual",
+			"power management:",
+		}
+
+		blocks = append(blocks, strings.Join(lines, "\n")+"\n")
+	}
+
+	return []byte(strings.Join(blocks, "\n") + "\n")
+}
+
+func (p *Persona) loadavg() []byte {
+	load := p.Load()
+	return []byte(fmt.Sprintf("%.2f %.2f %.2f 1/%d %d\n", load[0], load[1], load[2], len(p.processes("")), pidShell+1))
+}
+
+func (p *Persona) meminfo() []byte {
+	total, _, free, shared, cache, available := p.MemoryUsage()
+
+	lines := []string{
+		fmt.Sprintf("MemTotal:       %8d kB", total),
+		fmt.Sprintf("MemFree:        %8d kB", free),
+		fmt.Sprintf("MemAvailable:   %8d kB", available),
+		fmt.Sprintf("Buffers:        %8d kB", cache/10),
+		fmt.Sprintf("Cached:         %8d kB", cache*9/10),
+		fmt.Sprintf("Shmem:          %8d kB", shared),
+		fmt.Sprintf("SwapTotal:      %8d kB", 0),
+		fmt.Sprintf("SwapFree:       %8d kB", 0),
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func (p *Persona) uptime() []byte {
+	up := p.Up().Seconds()
+	return []byte(fmt.Sprintf("%.2f %.2f\n", up, up*float64(p.Cores)*0.97))
+}
+
+func (p *Persona) version() []byte {
+	return []byte(fmt.Sprintf("Linux version %s (buildd@lcy02-amd64) (%s) %s\n", p.Kernel, p.Compiler, p.Build))
+}
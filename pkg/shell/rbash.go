@@ -3,48 +3,98 @@ package shell
 
 import (
 	"fmt"
+	"io"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
+// The interactive terminal that can read the password from the client.
+type Terminal interface {
+	io.Writer
+
+	ReadPassword(prompt string) (string, error)
+}
+
+// The recorder to notify the interesting behavior happens in the shell.
+type Recorder interface {
+	// Record the credential the client tried in the shell, like sudo or su.
+	Credential(session *Session, username, password string)
+	// Record the command executed inside the script.
+	Command(session *Session, command, script string)
+	// Record the file downloaded by wget or curl, even the fetch failed.
+	Download(session *Session, download Download)
+}
+
 // The restricted bash shell that provides the limited bash shell.
 // It is the semi-interactive shell that accepts the command and returns the output.
 type RBash struct {
+	// The session shared between the shells of the same connection.
+	Session *Session
+	// The terminal to interact with the client, nil for the non-interactive shell.
+	Terminal Terminal
+	// The recorder to notify the interesting behavior in the shell.
+	Recorder Recorder
+	// The policy of the privilege escalation.
+	Escalate Escalation
+	// The fetcher of the downloads, nil to never fetch.
+	Fetch Fetcher
+
 	exit bool
+	// the nested depth of the running scripts and the executed commands of the
+	// current command line, to limit the runaway scripts.
+	depth int
+	steps int
+	// the error messages of the shell, which are not captured by the command
+	// substitution or the pipe and shown before the output.
+	stderr       []string
+	substituting int
+	// the error of the expansion, like the division by zero of $((1/0)), which
+	// fails the command being expanded.
+	expandErr error
 }
 
-// New creates a new RBash instance that provides the restricted bash shell.
-func New() *RBash {
-	return &RBash{}
+// New creates a new RBash instance that provides the restricted bash shell, bound
+// to the session. The anonymous session is created if the session is nil.
+func New(session *Session) *RBash {
+	if session == nil {
+		session = NewSession("", "", nil)
+	}
+
+	return &RBash{Session: session}
 }
 
 // Exec the command and return the output as the rbash shell.
 func (r *RBash) Exec(command string) string {
-	cmds := strings.Split(command, "; ")
+	if strings.TrimSpace(command) != "" {
+		r.Session.AddHistory(command)
+	}
+
+	r.steps = 0
+	return r.run(command)
+}
 
+// run the command line, which may contain several pipelines, and return the output.
+func (r *RBash) run(line string) string {
 	result := []string{}
-	for _, cmd := range cmds {
-		// disallow the I/O redirection
+	for _, pipeline := range parse(line) {
 		switch {
-		case strings.Contains(cmd, ">"):
-			result = append(result, "bash: I/O redirection is not allowed")
-			continue
-		case strings.Contains(cmd, "<"):
-			result = append(result, "bash: I/O redirection is not allowed")
+		case pipeline.op == "&&" && r.ExitCode() != 0:
 			continue
-		case strings.Contains(cmd, "|"):
-			result = append(result, "bash: I/O redirection is not allowed")
+		case pipeline.op == "||" && r.ExitCode() == 0:
 			continue
 		}
 
-		if cmd = strings.TrimSpace(cmd); cmd == "" {
-			log.Debug().Msg("skip the empty command")
-			continue
+		output, code := r.pipe(pipeline)
+		if r.substituting == 0 {
+			output = r.flush(output)
 		}
-
-		args := strings.Split(cmd, " ")
-		result = append(result, r.exec(args[0], args[1:]...))
+		if output != "" {
+			result = append(result, output)
+		}
+		r.setExitCode(code)
 
 		if r.IsExit() {
 			log.Info().Msg("exit the restricted bash shell")
@@ -55,29 +105,376 @@ func (r *RBash) Exec(command string) string {
 	return strings.Join(result, "\n")
 }
 
-// Execute the command and return the output as the restricted bash shell.
-func (r *RBash) exec(command string, args ...string) string {
-	var output string
-	log.Info().Str("command", command).Strs("args", args).Msg("exec the command")
-
-	switch command {
-	case "ls":
-		output = ".ssh"
-	case "pwd":
-		output = "/home/nobody"
-	case "whoami":
-		output = "nobody"
-	case "echo":
-		output = strings.Join(args, " ")
-	case "exit":
-		r.exit = true
+// run the commands in the pipeline, the output of the command is passed as the
+// input of the next one.
+func (r *RBash) pipe(pipeline *pipeline) (string, int) {
+	var output, stdin string
+	var code int
+
+	for index, cmd := range pipeline.commands {
+		stdout := ""
+		stdin, stdout, code = r.redirect(cmd, stdin)
+		if code != 0 {
+			return stdout, code
+		}
+
+		args := r.expand(cmd.raw)
+		failed := r.expandErr != nil
+		r.expandErr = nil
+
+		for !failed && len(args) > 0 && isAssignment(args[0]) {
+			// the assignment only applies to the command itself when followed by one
+			if len(args) == 1 {
+				key, value, _ := strings.Cut(args[0], "=")
+				r.Session.Setenv(key, value)
+			}
+			args = args[1:]
+		}
+
+		switch {
+		case failed:
+			// the command is never executed when the expansion failed, as bash does
+			output, code = "", 1
+		case len(args) == 0:
+			output, code = "", 0
+		default:
+			output, code = r.exec(stdin, args[0], args[1:]...)
+		}
+
+		if stdout != "" && !failed {
+			if err := r.write(stdout, output); err != nil {
+				return fmt.Sprintf("bash: %s", err), 1
+			}
+			output = ""
+		}
+
+		if index < len(pipeline.commands)-1 {
+			// pass the output to the next command
+			stdin = output
+			if stdin != "" {
+				stdin += "\n"
+			}
+			output = ""
+		}
+	}
+
+	return output, code
+}
+
+// apply the input redirection and get the target of the output redirection, the
+// target is suffixed with >> when appending. The error message is returned as the
+// target when failed.
+func (r *RBash) redirect(cmd *command, stdin string) (string, string, int) {
+	stdout := ""
+
+	for _, redirect := range cmd.redirects {
+		target := strings.Join(r.expand(redirect.target), " ")
+
+		switch redirect.op {
+		case "<":
+			data, err := r.Session.FS.ReadFile(r.Session.Abs(target))
+			if err != nil {
+				return "", fmt.Sprintf("bash: %s: %s", target, reason(err)), 1
+			}
+			stdin = string(data)
+		case "<<<":
+			stdin = target + "\n"
+		case ">", "&>":
+			stdout = target
+		case ">>", "&>>":
+			stdout = target + ">>"
+		default:
+			// the stderr redirection is ignored since the output is combined
+		}
+	}
+
+	return stdin, stdout, 0
+}
+
+// write the output into the file of the virtual filesystem.
+func (r *RBash) write(target, output string) error {
+	extend := strings.HasSuffix(target, ">>")
+	target = strings.TrimSuffix(target, ">>")
+
+	if target == "/dev/null" {
+		return nil
+	}
+
+	if output != "" {
+		output += "\n"
+	}
+
+	if err := r.Session.FS.WriteFile(r.Session.Abs(target), []byte(output), extend); err != nil {
+		return fmt.Errorf("%s: %s", target, reason(err))
+	}
+
+	return nil
+}
+
+// Execute the command and return the output and exit code as the restricted bash shell.
+func (r *RBash) exec(stdin, command string, args ...string) (string, int) {
+	log.Info().Str("session", r.Session.ID).Str("command", command).Strs("args", args).Msg("exec the command")
+
+	if r.steps++; r.steps > maxSteps {
+		log.Warn().Str("session", r.Session.ID).Int("steps", r.steps).Msg("too many commands, stop executing")
+		return "", 1
+	}
+
+	if isPath(command) {
+		return r.execPath(stdin, command, args...)
+	}
+
+	cmd, ok := commands[command]
+	if !ok {
+		r.fail(fmt.Sprintf("bash: %s: command not found", command))
+		return "", 127
+	}
+
+	return cmd(r, stdin, args...)
+}
+
+// execute the command by the path, the well-known binary path is mapped to the
+// builtin command and others are executed as the script in the virtual filesystem.
+func (r *RBash) execPath(stdin, name string, args ...string) (string, int) {
+	filename := r.Session.Abs(name)
+
+	switch path.Dir(filename) {
+	case "/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin":
+		if cmd, ok := commands[path.Base(filename)]; ok {
+			return cmd(r, stdin, args...)
+		}
+	}
+
+	switch file, err := r.Session.FS.Stat(filename); {
+	case err != nil:
+		r.fail(fmt.Sprintf("bash: %s: No such file or directory", name))
+		return "", 127
+	case file.IsDir():
+		r.fail(fmt.Sprintf("bash: %s: Is a directory", name))
+		return "", 126
+	case file.Mode&0111 == 0:
+		r.fail(fmt.Sprintf("bash: %s: Permission denied", name))
+		return "", 126
+	}
+
+	return r.source(name, filename)
+}
+
+// Split the command into the arguments, expands the variables, the command
+// substitutions and removes the quotes as the shell does.
+func (r *RBash) expand(command string) []string {
+	var args []string
+	var arg strings.Builder
+
+	started := false
+	runes := []rune(command)
+	for index := 0; index < len(runes); index++ {
+		ch := runes[index]
+
+		switch {
+		case ch == '\\' && index+1 < len(runes):
+			arg.WriteRune(runes[index+1])
+			index++
+			started = true
+		case ch == '\'':
+			inner, end := quoted(runes, index+1, ch)
+			arg.WriteString(string(inner))
+			index = end - 1
+			started = true
+		case ch == '"':
+			inner, end := quoted(runes, index+1, ch)
+			arg.WriteString(r.expandQuoted(inner))
+			index = end - 1
+			started = true
+		case ch == '$' || ch == '`':
+			// the unquoted empty expansion is removed
+			value, size := r.variable(runes[index:])
+			arg.WriteString(value)
+			index += size - 1
+			started = started || value != ""
+		case ch == '~' && !started && (index+1 == len(runes) || runes[index+1] == '/' || isBlank(runes[index+1])):
+			arg.WriteString(r.Session.Home())
+			started = true
+		case isBlank(ch):
+			if started {
+				args = append(args, arg.String())
+				arg.Reset()
+				started = false
+			}
+		default:
+			arg.WriteRune(ch)
+			started = true
+		}
+	}
+
+	if started {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
+
+// expand the content inside the double quotes.
+func (r *RBash) expandQuoted(runes []rune) string {
+	var text strings.Builder
+
+	for index := 0; index < len(runes); index++ {
+		ch := runes[index]
+
+		switch {
+		case ch == '\\' && index+1 < len(runes) && strings.ContainsRune("$`\"\\", runes[index+1]):
+			text.WriteRune(runes[index+1])
+			index++
+		case ch == '$' || ch == '`':
+			value, size := r.variable(runes[index:])
+			text.WriteString(value)
+			index += size - 1
+		default:
+			text.WriteRune(ch)
+		}
+	}
+
+	return text.String()
+}
+
+// expand the variable or the command substitution at the beginning of the runes,
+// return the value and the number of consumed runes.
+func (r *RBash) variable(runes []rune) (string, int) {
+	if runes[0] == '`' {
+		inner, end := quoted(runes, 1, '`')
+		return r.substitute(string(inner)), end
+	}
+
+	if len(runes) < 2 {
+		return "$", 1
+	}
+
+	switch ch := runes[1]; {
+	case ch == '(':
+		end, ok := closingParen(runes, 2)
+		inner := runes[2:end]
+		if ok {
+			inner = runes[2 : end-1]
+		}
+
+		// the arithmetic expansion, like $((1 + 2))
+		if length := len(inner); length >= 2 && inner[0] == '(' && inner[length-1] == ')' {
+			if _, ok := closingParen(inner[:length-1], 1); !ok {
+				return r.arithmetic(string(inner[1 : length-1])), end
+			}
+		}
+
+		return r.substitute(string(inner)), end
+	case ch == '{':
+		inner, end := quoted(runes, 2, '}')
+		return r.lookupEnv(string(inner)), end
+	case ch == '?' || ch == '$' || ch == '#' || (ch >= '0' && ch <= '9'):
+		return r.lookupEnv(string(ch)), 2
+	case isName(ch):
+		end := 2
+		for end < len(runes) && (isName(runes[end]) || (runes[end] >= '0' && runes[end] <= '9')) {
+			end++
+		}
+		return r.lookupEnv(string(runes[1:end])), end
+	default:
+		return "$", 1
+	}
+}
+
+// run the command substitution and return the output without the trailing newlines.
+func (r *RBash) substitute(command string) string {
+	r.substituting++
+	defer func() { r.substituting-- }()
+
+	return strings.TrimRight(r.run(command), "\n")
+}
+
+// evaluate the arithmetic expansion after the variables are expanded, the error
+// is shown as bash does and fails the command being expanded.
+func (r *RBash) arithmetic(expression string) string {
+	expanded := r.expandQuoted([]rune(expression))
+
+	value, err := evalArith(expanded, r.lookupEnv)
+	if err != nil {
+		r.fail(fmt.Sprintf("bash: %s: %s", strings.TrimSpace(expanded), err))
+		r.expandErr = err
+		return ""
+	}
+
+	return strconv.FormatInt(value, 10)
+}
+
+// record the error message of the shell.
+func (r *RBash) fail(message string) {
+	r.stderr = append(r.stderr, message)
+}
+
+// prepend the recorded error messages of the shell to the output.
+func (r *RBash) flush(output string) string {
+	if len(r.stderr) == 0 {
+		return output
+	}
+
+	messages := r.stderr
+	r.stderr = nil
+	if output != "" {
+		messages = append(messages, output)
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// lookup the variables, including the special variables.
+func (r *RBash) lookupEnv(key string) string {
+	switch key {
+	case "?":
+		return strconv.Itoa(r.ExitCode())
+	case "$":
+		return strconv.Itoa(pidShell)
+	case "#":
+		return "0"
+	case "0":
+		return "-rbash"
 	default:
-		output = fmt.Sprintf("bash: %s: command not found", command)
+		return r.Session.Getenv(key)
 	}
+}
+
+func (r *RBash) setExitCode(code int) {
+	r.Session.Lock()
+	r.Session.ExitCode = code
+	r.Session.Unlock()
+}
+
+// Get the exit code of the last command.
+func (r *RBash) ExitCode() int {
+	r.Session.Lock()
+	defer r.Session.Unlock()
 
-	return output
+	return r.Session.ExitCode
 }
 
 func (r *RBash) IsExit() bool {
 	return r.exit
 }
+
+// check the word is the variable assignment, like NAME=value.
+func isAssignment(word string) bool {
+	key, _, ok := strings.Cut(word, "=")
+	if !ok || key == "" || !isName([]rune(key)[0]) {
+		return false
+	}
+
+	for _, ch := range key {
+		if !isName(ch) && (ch < '0' || ch > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check the rune can be the part of the variable name.
+func isName(ch rune) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
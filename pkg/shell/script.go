@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// The maximum nested depth of the scripts, like the script runs another script.
+	maxDepth = 8
+	// The maximum commands can be executed by a single command line, including the
+	// commands inside the scripts.
+	maxSteps = 1024
+
+	// The marker of the script read from the standard input, like curl ... | sh.
+	stdinScript = "(stdin)"
+)
+
+func init() {
+	register(".", cmdSource)
+	register("bash", cmdSh)
+	register("sh", cmdSh)
+	register("source", cmdSource)
+}
+
+func cmdSh(r *RBash, stdin string, args ...string) (string, int) {
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "-c":
+			if index+1 >= len(args) {
+				return "sh: 0: -c requires an argument", 2
+			}
+			return r.script("-c", args[index+1])
+		case arg == "-" || arg == "-s":
+			return r.script(stdinScript, stdin)
+		case strings.HasPrefix(arg, "-"):
+			// ignore the options like -x or -e
+			continue
+		default:
+			filename := r.Session.Abs(arg)
+			if _, err := r.Session.FS.Stat(filename); err != nil {
+				return fmt.Sprintf("sh: 0: cannot open %s: No such file", arg), 2
+			}
+			return r.source(arg, filename)
+		}
+	}
+
+	// read the script from the standard input, like curl ... | sh
+	return r.script(stdinScript, stdin)
+}
+
+func cmdSource(r *RBash, stdin string, args ...string) (string, int) {
+	if len(args) == 0 {
+		return "bash: source: filename argument required\nsource: usage: source filename [arguments]", 2
+	}
+
+	filename := r.Session.Abs(args[0])
+	if _, err := r.Session.FS.Stat(filename); err != nil {
+		return fmt.Sprintf("bash: %s: No such file or directory", args[0]), 1
+	}
+
+	return r.source(args[0], filename)
+}
+
+// load the script from the virtual filesystem and run it.
+func (r *RBash) source(name, filename string) (string, int) {
+	data, err := r.Session.FS.ReadFile(filename)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("bash: %s: %s", name, reason(err)), 126
+	case strings.HasPrefix(string(data), "\x7fELF"):
+		return fmt.Sprintf("bash: %s: cannot execute binary file: Exec format error", name), 126
+	}
+
+	return r.script(filename, string(data))
+}
+
+// run the script line by line through the same parser and the command registry,
+// and record every command with the marker of the script.
+func (r *RBash) script(name, content string) (string, int) {
+	if r.depth >= maxDepth {
+		log.Warn().Str("session", r.Session.ID).Str("script", name).Msg("too deep nested scripts, stop executing")
+		return fmt.Sprintf("bash: %s: maximum nested script depth exceeded", name), 1
+	}
+
+	r.depth++
+	defer func() { r.depth-- }()
+
+	log.Info().Str("session", r.Session.ID).Str("script", name).Int("depth", r.depth).Msg("run the script")
+
+	var output []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if r.Recorder != nil {
+			r.Recorder.Command(r.Session, line, name)
+		}
+
+		if text := r.run(line); text != "" {
+			output = append(output, text)
+		}
+
+		if r.IsExit() || r.steps > maxSteps {
+			break
+		}
+	}
+
+	// the exit inside the script only terminates the script itself
+	r.exit = false
+	return strings.Join(output, "\n"), r.ExitCode()
+}
@@ -0,0 +1,292 @@
+package shell
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The maximum number of the lines kept in the history, the default HISTSIZE of bash.
+const maxHistory = 500
+
+// The per-connection state of the shell, shared by all the channels of the same
+// SSH connection, so the behavior keeps consistent between the channels.
+type Session struct {
+	sync.Mutex
+
+	// The identifier of the session.
+	ID string
+	// The logged-in username and password from the authentication.
+	Username string
+	Password string
+	// The current working directory.
+	Cwd string
+	// The exit code of the last command.
+	ExitCode int
+
+	env     map[string]string
+	history []string
+	// the number of the oldest lines dropped from the history
+	dropped int
+	// the effective user and the stack of the switched users, by su or sudo
+	effective string
+	frames    []frame
+	// the sudo credential is cached or not
+	sudoer bool
+	// the number of the fetches and the bytes fetched by wget and curl
+	fetches int
+	fetched int
+
+	// The virtual filesystem of the session.
+	FS *FileSystem
+	// The fake hardware and system model of the host.
+	Persona *Persona
+}
+
+// NewSession creates a new session for the logged-in user on the host described
+// by the persona, the default persona is used if nil.
+func NewSession(id, username string, persona *Persona) *Session {
+	if username == "" {
+		username = "nobody"
+	}
+
+	if persona == nil {
+		persona = LookupPersona(DefaultPersona)
+	}
+
+	sess := &Session{
+		ID:        id,
+		Username:  username,
+		FS:        NewFileSystem(username),
+		Persona:   persona,
+		effective: username,
+	}
+	persona.mount(sess.FS)
+
+	home := sess.Home()
+	sess.Cwd = home
+	sess.env = map[string]string{
+		"HOME":     home,
+		"HOSTNAME": persona.Hostname,
+		"LOGNAME":  username,
+		"PATH":     "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"PWD":      home,
+		"SHELL":    "/bin/rbash",
+		"TERM":     "xterm-256color",
+		"USER":     username,
+	}
+
+	return sess
+}
+
+// The state of the shell before switching the user.
+type frame struct {
+	user string
+	cwd  string
+}
+
+// Get the effective user of the session, may be switched by su or sudo.
+func (s *Session) User() string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.user()
+}
+
+// get the effective user, the caller should hold the lock.
+func (s *Session) user() string {
+	return s.effective
+}
+
+// Switch to the user as the login shell and change to the home directory when
+// login is true, the previous state is restored by Logout.
+func (s *Session) Login(username string, login bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.frames = append(s.frames, frame{user: s.user(), cwd: s.Cwd})
+	s.setUser(username)
+
+	if login {
+		s.Cwd = HomeDir(username)
+		s.env["PWD"] = s.Cwd
+	}
+}
+
+// Restore to the previous user, return false if there is no switched user.
+func (s *Session) Logout() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.frames) == 0 {
+		return false
+	}
+
+	last := s.frames[len(s.frames)-1]
+	s.frames = s.frames[:len(s.frames)-1]
+
+	s.setUser(last.user)
+	s.Cwd = last.cwd
+	s.env["PWD"] = last.cwd
+	return true
+}
+
+// set the effective user, the caller should hold the lock.
+func (s *Session) setUser(username string) {
+	s.effective = username
+	s.env["USER"] = username
+	s.env["LOGNAME"] = username
+	s.env["HOME"] = HomeDir(username)
+}
+
+// Get the home directory of the effective user.
+func (s *Session) Home() string {
+	return HomeDir(s.User())
+}
+
+// Get the fake uid of the user, return -1 if the user does not exist.
+func (s *Session) UID(username string) int {
+	switch username {
+	case "root":
+		return 0
+	case "daemon":
+		return 1
+	case "bin":
+		return 2
+	case "sys":
+		return 3
+	case "www-data":
+		return 33
+	case "sshd":
+		return 110
+	case "nobody":
+		return 65534
+	case s.Username:
+		return 1000
+	default:
+		return -1
+	}
+}
+
+// Get the value of the environment variable, return empty string if not set.
+func (s *Session) Getenv(key string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.env[key]
+}
+
+// Set the environment variable.
+func (s *Session) Setenv(key, value string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.env[key] = value
+}
+
+// Remove the environment variable.
+func (s *Session) Unsetenv(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.env, key)
+}
+
+// Get the environment variables as KEY=VALUE pairs, sorted by the key.
+func (s *Session) Environ() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	environ := make([]string, 0, len(s.env))
+	for key, value := range s.env {
+		environ = append(environ, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	sort.Strings(environ)
+	return environ
+}
+
+// Append the command line into the history, only the latest lines are kept.
+func (s *Session) AddHistory(line string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.history = append(s.history, line)
+	if extra := len(s.history) - maxHistory; extra > 0 {
+		s.history = slices.Delete(s.history, 0, extra)
+		s.dropped += extra
+	}
+}
+
+// Get the snapshot of the command history, the oldest first.
+func (s *Session) History() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	history := make([]string, len(s.history))
+	copy(history, s.history)
+	return history
+}
+
+// get the number of the oldest line in the history and the snapshot of it, the
+// number continues after the oldest lines are dropped, as bash does.
+func (s *Session) numberedHistory() (int, []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.dropped + 1, slices.Clone(s.history)
+}
+
+// Resolve the path to the absolute path based on the current working directory.
+func (s *Session) Abs(name string) string {
+	switch {
+	case name == "~":
+		name = s.Home()
+	case strings.HasPrefix(name, "~/"):
+		name = path.Join(s.Home(), name[2:])
+	case !path.IsAbs(name):
+		name = path.Join(s.Pwd(), name)
+	}
+
+	return path.Clean(name)
+}
+
+// Get the current working directory.
+func (s *Session) Pwd() string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.Cwd
+}
+
+// Change the current working directory.
+func (s *Session) Chdir(name string) error {
+	dir := s.Abs(name)
+
+	switch info, err := s.FS.Stat(dir); {
+	case err != nil:
+		return fmt.Errorf("%s: No such file or directory", name)
+	case !info.IsDir():
+		return fmt.Errorf("%s: Not a directory", name)
+	}
+
+	s.Lock()
+	s.Cwd = dir
+	s.env["OLDPWD"] = s.env["PWD"]
+	s.env["PWD"] = dir
+	s.Unlock()
+	return nil
+}
+
+// Get the home directory of the username.
+func HomeDir(username string) string {
+	switch username {
+	case "root":
+		return "/root"
+	default:
+		return path.Join("/home", username)
+	}
+}
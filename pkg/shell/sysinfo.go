@@ -0,0 +1,381 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The pid of the login shell, the command executed by the shell is the next one.
+const pidShell = 2107
+
+// The fake process in the process list.
+type process struct {
+	PID   int
+	PPID  int
+	User  string
+	VSZ   int
+	RSS   int
+	TTY   string
+	Stat  string
+	Start time.Time
+	CPU   time.Duration
+	Cmd   string
+}
+
+func init() {
+	register("df", cmdDf)
+	register("free", cmdFree)
+	register("hostname", cmdHostname)
+	register("lscpu", cmdLscpu)
+	register("nproc", cmdNproc)
+	register("ps", cmdPs)
+	register("top", cmdTop)
+	register("uname", cmdUname)
+	register("uptime", cmdUptime)
+}
+
+// get the process list of the host, including the session of the user.
+func (p *Persona) processes(user string) []process {
+	boot := p.Boot()
+	now := time.Now()
+
+	procs := []process{
+		{1, 0, "root", 167744, 13120, "?", "Ss", boot, 41 * time.Second, "/sbin/init"},
+		{2, 0, "root", 0, 0, "?", "S", boot, 0, "[kthreadd]"},
+		{3, 2, "root", 0, 0, "?", "I<", boot, 0, "[rcu_gp]"},
+		{4, 2, "root", 0, 0, "?", "I<", boot, 0, "[rcu_par_gp]"},
+		{9, 2, "root", 0, 0, "?", "S", boot, 3 * time.Second, "[ksoftirqd/0]"},
+		{10, 2, "root", 0, 0, "?", "I", boot, 52 * time.Second, "[rcu_sched]"},
+		{11, 2, "root", 0, 0, "?", "S", boot, 2 * time.Second, "[migration/0]"},
+		{14, 2, "root", 0, 0, "?", "S", boot, 0, "[kdevtmpfs]"},
+		{38, 2, "root", 0, 0, "?", "S", boot, 0, "[kswapd0]"},
+		{382, 1, "root", 64172, 22416, "?", "S<s", boot, 9 * time.Second, "/lib/systemd/systemd-journald"},
+		{419, 1, "root", 25332, 6304, "?", "Ss", boot, time.Second, "/lib/systemd/systemd-udevd"},
+		{571, 1, "systemd+", 25528, 12800, "?", "Ss", boot, 2 * time.Second, "/lib/systemd/systemd-resolved"},
+		{611, 1, "root", 6896, 2880, "?", "Ss", boot, 3 * time.Second, "/usr/sbin/cron -f -P"},
+		{612, 1, "message+", 8584, 4736, "?", "Ss", boot, time.Second, "@dbus-daemon --system --address=systemd: --nofork --nopidfile --systemd-activation --syslog-only"},
+		{625, 1, "syslog", 222404, 5888, "?", "Ssl", boot, 4 * time.Second, "/usr/sbin/rsyslogd -n -iNONE"},
+		{633, 1, "root", 15432, 9088, "?", "Ss", boot, 0, "sshd: /usr/sbin/sshd -D [listener] 0 of 10-100 startups"},
+		{690, 1, "root", 5828, 1792, "ttyS0", "Ss+", boot, 0, "/sbin/agetty -o -p -- \\u --keep-baud 115200,57600,38400,9600 ttyS0 vt220"},
+		{2011, 633, "root", 17180, 10880, "?", "Ss", now, 0, fmt.Sprintf("sshd: %s [priv]", user)},
+		{2106, 2011, user, 17312, 6504, "?", "S", now, 0, fmt.Sprintf("sshd: %s@pts/0", user)},
+		{pidShell, 2106, user, 8904, 5376, "pts/0", "Ss", now, 0, "-rbash"},
+	}
+
+	return procs
+}
+
+func cmdDf(r *RBash, stdin string, args ...string) (string, int) {
+	p := r.Session.Persona
+	human := false
+	for _, arg := range args {
+		human = human || (strings.HasPrefix(arg, "-") && strings.Contains(arg, "h"))
+	}
+
+	_, _, _, shared, _, _ := p.MemoryUsage()
+	total := p.Memory * 1024
+	disk := p.Disk * 1024 * 1024
+	used := disk * 8 / 100
+
+	mounts := []struct {
+		name       string
+		size, used int
+		mountedOn  string
+	}{
+		{"udev", total / 2, 0, "/dev"},
+		{"tmpfs", total / 10, shared, "/run"},
+		{"/dev/vda1", disk, used, "/"},
+		{"tmpfs", total / 2, 0, "/dev/shm"},
+		{"tmpfs", 5120, 0, "/run/lock"},
+		{"/dev/vda15", 106858, 6186, "/boot/efi"},
+		{"tmpfs", total / 10, 4, "/run/user/1000"},
+	}
+
+	var output []string
+	switch human {
+	case true:
+		output = append(output, "Filesystem      Size  Used Avail Use% Mounted on")
+	default:
+		output = append(output, "Filesystem     1K-blocks    Used Available Use% Mounted on")
+	}
+
+	for _, mount := range mounts {
+		avail := mount.size - mount.used
+		percent := (mount.used*100 + mount.size - 1) / mount.size
+
+		switch human {
+		case true:
+			output = append(output, fmt.Sprintf("%-15s %4s %5s %5s %3d%% %s", mount.name, humanize(mount.size), humanize(mount.used), humanize(avail), percent, mount.mountedOn))
+		default:
+			output = append(output, fmt.Sprintf("%-14s %10d %7d %9d %3d%% %s", mount.name, mount.size, mount.used, avail, percent, mount.mountedOn))
+		}
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdFree(r *RBash, stdin string, args ...string) (string, int) {
+	total, used, free, shared, cache, available := r.Session.Persona.MemoryUsage()
+
+	unit := func(kb int) string { return fmt.Sprintf("%d", kb) }
+	for _, arg := range args {
+		switch arg {
+		case "-m", "--mebi":
+			unit = func(kb int) string { return fmt.Sprintf("%d", kb/1024) }
+		case "-g", "--gibi":
+			unit = func(kb int) string { return fmt.Sprintf("%d", kb/1024/1024) }
+		case "-h", "--human":
+			unit = func(kb int) string {
+				if kb == 0 {
+					return "0B"
+				}
+				return humanize(kb) + "i"
+			}
+		}
+	}
+
+	output := []string{
+		fmt.Sprintf("%20s%12s%12s%12s%12s%12s", "total", "used", "free", "shared", "buff/cache", "available"),
+		fmt.Sprintf("%-5s%15s%12s%12s%12s%12s%12s", "Mem:", unit(total), unit(used), unit(free), unit(shared), unit(cache), unit(available)),
+		fmt.Sprintf("%-5s%15s%12s%12s", "Swap:", unit(0), unit(0), unit(0)),
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdHostname(r *RBash, stdin string, args ...string) (string, int) {
+	return r.Session.Persona.Hostname, 0
+}
+
+func cmdLscpu(r *RBash, stdin string, args ...string) (string, int) {
+	p := r.Session.Persona
+
+	online := "0"
+	if p.Cores > 1 {
+		online = fmt.Sprintf("0-%d", p.Cores-1)
+	}
+
+	rows := [][2]string{
+		{"Architecture:", p.Arch},
+		{"  CPU op-mode(s):", "32-bit, 64-bit"},
+		{"  Address sizes:", "40 bits physical, 48 bits virtual"},
+		{"  Byte Order:", "Little Endian"},
+		{"CPU(s):", fmt.Sprintf("%d", p.Cores)},
+		{"  On-line CPU(s) list:", online},
+		{"Vendor ID:", p.VendorID},
+		{"  Model name:", p.CPUModel},
+		{"    CPU family:", fmt.Sprintf("%d", p.CPUFamily)},
+		{"    Model:", fmt.Sprintf("%d", p.Model)},
+		{"    Thread(s) per core:", "1"},
+		{"    Core(s) per socket:", "1"},
+		{"    Socket(s):", fmt.Sprintf("%d", p.Cores)},
+		{"    Stepping:", fmt.Sprintf("%d", p.Stepping)},
+		{"    BogoMIPS:", fmt.Sprintf("%.2f", p.MHz*2)},
+		{"Virtualization features:", ""},
+		{"  Hypervisor vendor:", "KVM"},
+		{"  Virtualization type:", "full"},
+		{"Caches (sum of all):", ""},
+		{"  L2:", fmt.Sprintf("%d KiB (%d instances)", p.CacheKB*p.Cores, p.Cores)},
+		{"NUMA:", ""},
+		{"  NUMA node(s):", "1"},
+		{"  NUMA node0 CPU(s):", online},
+	}
+
+	var output []string
+	for _, row := range rows {
+		output = append(output, strings.TrimRight(fmt.Sprintf("%-25s%s", row[0], row[1]), " "))
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdNproc(r *RBash, stdin string, args ...string) (string, int) {
+	return fmt.Sprintf("%d", r.Session.Persona.Cores), 0
+}
+
+func cmdPs(r *RBash, stdin string, args ...string) (string, int) {
+	p := r.Session.Persona
+	user := r.Session.User()
+
+	procs := append(p.processes(r.Session.Username), process{pidShell + 1, pidShell, user, 10072, 3456, "pts/0", "R+", time.Now(), 0, "ps " + strings.Join(args, " ")})
+	total, _, _, _, _, _ := p.MemoryUsage()
+
+	option := strings.TrimLeft(strings.Join(args, ""), "-")
+	var output []string
+	switch {
+	case strings.Contains(option, "a") && strings.Contains(option, "u"):
+		output = append(output, "USER         PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND")
+		for _, proc := range procs {
+			output = append(output, fmt.Sprintf("%-8s %7d %4.1f %4.1f %6d %5d %-8s %-4s %5s %6s %s",
+				proc.User, proc.PID, 0.0, float64(proc.RSS)*100/float64(total), proc.VSZ, proc.RSS, proc.TTY, proc.Stat,
+				startTime(proc.Start), cpuTime(proc.CPU, false), proc.Cmd))
+		}
+	case strings.Contains(option, "e") || strings.Contains(option, "A"):
+		output = append(output, "UID          PID    PPID  C STIME TTY          TIME CMD")
+		for _, proc := range procs {
+			output = append(output, fmt.Sprintf("%-8s %7d %7d  0 %5s %-8s %8s %s",
+				proc.User, proc.PID, proc.PPID, startTime(proc.Start), proc.TTY, cpuTime(proc.CPU, true), proc.Cmd))
+		}
+	default:
+		output = append(output, "    PID TTY          TIME CMD")
+		for _, proc := range procs[len(procs)-2:] {
+			name := strings.TrimPrefix(strings.Fields(proc.Cmd)[0], "-")
+			output = append(output, fmt.Sprintf("%7d %-8s %8s %s", proc.PID, proc.TTY, cpuTime(proc.CPU, true), name))
+		}
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdTop(r *RBash, stdin string, args ...string) (string, int) {
+	batch := false
+	for _, arg := range args {
+		batch = batch || (strings.HasPrefix(arg, "-") && strings.Contains(arg, "b"))
+	}
+
+	if !batch && r.Terminal == nil {
+		return "top: failed tty get", 1
+	}
+
+	p := r.Session.Persona
+	procs := append(p.processes(r.Session.Username), process{pidShell + 1, pidShell, r.Session.User(), 10072, 3456, "pts/0", "R", time.Now(), 0, "top"})
+	total, used, free, _, cache, available := p.MemoryUsage()
+	mib := func(kb int) float64 { return float64(kb) / 1024 }
+
+	output := []string{
+		fmt.Sprintf("top - %s", strings.TrimSpace(uptime(p))),
+		fmt.Sprintf("Tasks: %3d total,   1 running, %3d sleeping,   0 stopped,   0 zombie", len(procs), len(procs)-1),
+		"%Cpu(s):  1.6 us,  0.8 sy,  0.0 ni, 97.5 id,  0.0 wa,  0.0 hi,  0.1 si,  0.0 st",
+		fmt.Sprintf("MiB Mem : %8.1f total, %8.1f free, %8.1f used, %8.1f buff/cache", mib(total), mib(free), mib(used), mib(cache)),
+		fmt.Sprintf("MiB Swap: %8.1f total, %8.1f free, %8.1f used. %8.1f avail Mem", 0.0, 0.0, 0.0, mib(available)),
+		"",
+		"    PID USER      PR  NI    VIRT    RES    SHR S  %CPU  %MEM     TIME+ COMMAND",
+	}
+
+	for _, proc := range procs {
+		name := strings.TrimPrefix(strings.Fields(proc.Cmd)[0], "-")
+		name = strings.Trim(strings.TrimSuffix(name, ":"), "[]")
+		if index := strings.LastIndex(name, "/"); index >= 0 && !strings.HasPrefix(proc.Cmd, "[") {
+			name = name[index+1:]
+		}
+
+		output = append(output, fmt.Sprintf("%7d %-8s  20   0 %7d %6d %6d %s %5.1f %5.1f %9s %s",
+			proc.PID, proc.User, proc.VSZ, proc.RSS, proc.RSS*6/10, proc.Stat[:1], 0.0,
+			float64(proc.RSS)*100/float64(total), topTime(proc.CPU), name))
+	}
+
+	return strings.Join(output, "\n"), 0
+}
+
+func cmdUname(r *RBash, stdin string, args ...string) (string, int) {
+	p := r.Session.Persona
+	if len(args) == 0 {
+		return "Linux", 0
+	}
+
+	var output []string
+	for _, arg := range args {
+		switch arg {
+		case "-a", "--all":
+			return p.Uname(), 0
+		case "-s", "--kernel-name":
+			output = append(output, "Linux")
+		case "-n", "--nodename":
+			output = append(output, p.Hostname)
+		case "-r", "--kernel-release":
+			output = append(output, p.Kernel)
+		case "-v", "--kernel-version":
+			output = append(output, p.Build)
+		case "-m", "--machine", "-p", "--processor", "-i", "--hardware-platform":
+			output = append(output, p.Arch)
+		case "-o", "--operating-system":
+			output = append(output, "GNU/Linux")
+		default:
+			return fmt.Sprintf("uname: invalid option -- '%s'\nTry 'uname --help' for more information.", strings.TrimLeft(arg, "-")), 1
+		}
+	}
+
+	return strings.Join(output, " "), 0
+}
+
+func cmdUptime(r *RBash, stdin string, args ...string) (string, int) {
+	p := r.Session.Persona
+
+	for _, arg := range args {
+		switch arg {
+		case "-p", "--pretty":
+			up := p.Up()
+			days := int(up.Hours()) / 24
+			return fmt.Sprintf("up %d weeks, %d days, %d hours, %d minutes", days/7, days%7, int(up.Hours())%24, int(up.Minutes())%60), 0
+		case "-s", "--since":
+			return p.Boot().Format("2006-01-02 15:04:05"), 0
+		}
+	}
+
+	return uptime(p), 0
+}
+
+// format the uptime line, as the uptime and the top command shows.
+func uptime(p *Persona) string {
+	up := p.Up()
+	load := p.Load()
+
+	days := int(up.Hours()) / 24
+	clock := fmt.Sprintf("%2d:%02d", int(up.Hours())%24, int(up.Minutes())%60)
+
+	return fmt.Sprintf(" %s up %d days, %s,  1 user,  load average: %.2f, %.2f, %.2f",
+		time.Now().Format("15:04:05"), days, clock, load[0], load[1], load[2])
+}
+
+// format the start time of the process, the time is showed when started today.
+func startTime(start time.Time) string {
+	if time.Since(start) < 24*time.Hour {
+		return start.Format("15:04")
+	}
+
+	return start.Format("Jan02")
+}
+
+// format the cumulative CPU time of the process.
+func cpuTime(cpu time.Duration, long bool) string {
+	minutes := int(cpu.Minutes())
+	seconds := int(cpu.Seconds()) % 60
+
+	switch long {
+	case true:
+		return fmt.Sprintf("%02d:%02d:%02d", minutes/60, minutes%60, seconds)
+	default:
+		return fmt.Sprintf("%d:%02d", minutes, seconds)
+	}
+}
+
+// format the cumulative CPU time as the top shows.
+func topTime(cpu time.Duration) string {
+	return fmt.Sprintf("%d:%05.2f", int(cpu.Minutes()), float64(cpu%time.Minute)/float64(time.Second))
+}
+
+// format the size in KiB to the human-readable format.
+func humanize(kb int) string {
+	size := float64(kb)
+	units := []string{"K", "M", "G", "T"}
+
+	switch {
+	case kb == 0:
+		return "0"
+	case kb < 1024:
+		return fmt.Sprintf("%dK", kb)
+	}
+
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if size < 10 {
+		return fmt.Sprintf("%.1f%s", size, units[unit])
+	}
+
+	return fmt.Sprintf("%.0f%s", size, units[unit])
+}
@@ -0,0 +1,281 @@
+package syslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// The format of the syslog message body.
+type Format string
+
+const (
+	// The event as the JSON object, the same as the HTTP API.
+	FormatJSON Format = "json"
+	// The ArcSight Common Event Format.
+	FormatCEF Format = "cef"
+	// The QRadar Log Event Extended Format 2.0, delimited by the tab.
+	FormatLEEF Format = "leef"
+)
+
+const (
+	// The vendor and the product in the CEF and the LEEF header.
+	vendor  = "cmj0121"
+	product = "zoe"
+	// The time format of the LEEF devTime, in the Java SimpleDateFormat.
+	leefTimeFormat = "yyyy-MM-dd'T'HH:mm:ss.SSSZ"
+)
+
+// The syslog severity, from RFC 5424.
+const (
+	severityWarning       = 4
+	severityNotice        = 5
+	severityInformational = 6
+)
+
+// the escapers of the CEF header, the CEF extension and the LEEF attribute.
+var (
+	cefHeader    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtension = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefValue    = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+)
+
+// the key-value pair of the CEF extension or the LEEF attribute, kept in order.
+type field struct {
+	key   string
+	value string
+}
+
+// Get the severity of the event from 0 (lowest) to 10 (highest), used in the
+// CEF, the LEEF and mapped into the syslog severity.
+func Severity(event *types.Event) int {
+	switch event.Type {
+	case types.EventAuthPassword:
+		if event.Payload["success"] == true {
+			return 8
+		}
+		return 3
+	case types.EventAuthPublicKey, types.EventRequest:
+		return 3
+	case types.EventCommand, types.EventForward:
+		return 6
+	case types.EventDownload, types.EventUpload:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// get the syslog severity of the event.
+func syslogSeverity(event *types.Event) int {
+	switch severity := Severity(event); {
+	case severity >= 8:
+		return severityWarning
+	case severity >= 5:
+		return severityNotice
+	default:
+		return severityInformational
+	}
+}
+
+// format the event as the message body in the format.
+func format(f Format, event *types.Event, version string) (string, error) {
+	switch f {
+	case FormatJSON:
+		data, err := json.Marshal(event)
+		return string(data), err
+	case FormatCEF:
+		return formatCEF(event, version), nil
+	case FormatLEEF:
+		return formatLEEF(event, version), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", f)
+	}
+}
+
+// format the event in the CEF, like
+//
+//	CEF:0|cmj0121|zoe|0.2.9|auth.password|Password authentication|3|rt=... src=...
+func formatCEF(event *types.Event, version string) string {
+	fields := []field{
+		{"rt", strconv.FormatInt(event.CreatedAt.UnixMilli(), 10)},
+		{"externalId", positive(event.ID)},
+		{"dvchost", event.Sensor},
+		{"app", event.Protocol},
+		{"src", event.SrcIP},
+		{"spt", positive(event.SrcPort)},
+		{"dst", event.DstIP},
+		{"dpt", positive(event.DstPort)},
+		{"suser", deref(event.Username)},
+		{"outcome", outcome(event)},
+		{"cs1Label", "session"}, {"cs1", deref(event.Session)},
+		{"cs2Label", "password"}, {"cs2", deref(event.Password)},
+		{"cs3Label", "command"}, {"cs3", deref(event.Command)},
+		{"cs4Label", "decoded"}, {"cs4", event.Deobfuscated()},
+		{"cs5Label", "country"}, {"cs5", event.Country},
+		{"cs6Label", "payload"}, {"cs6", payload(event)},
+		{"requestUrl", payloadString(event, "url")},
+		{"fname", payloadString(event, "filename")},
+		{"fileHash", payloadString(event, "sha256")},
+	}
+
+	var ext []string
+	for index, f := range fields {
+		switch {
+		case f.value == "":
+			continue
+		case strings.HasSuffix(f.key, "Label") && index+1 < len(fields) && fields[index+1].value == "":
+			// skip the label of the empty custom string
+			continue
+		}
+
+		ext = append(ext, f.key+"="+cefExtension.Replace(f.value))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader.Replace(vendor),
+		cefHeader.Replace(product),
+		cefHeader.Replace(version),
+		cefHeader.Replace(string(event.Type)),
+		cefHeader.Replace(name(event)),
+		Severity(event),
+		strings.Join(ext, " "),
+	)
+}
+
+// format the event in the LEEF 2.0 with the tab delimiter, like
+//
+//	LEEF:2.0|cmj0121|zoe|0.2.9|auth.password|x09|devTime=...	src=...
+func formatLEEF(event *types.Event, version string) string {
+	fields := []field{
+		{"devTime", event.CreatedAt.Format("2006-01-02T15:04:05.000-0700")},
+		{"devTimeFormat", leefTimeFormat},
+		{"cat", string(event.Type)},
+		{"sev", strconv.Itoa(max(1, Severity(event)))},
+		{"identHostName", event.Sensor},
+		{"src", event.SrcIP},
+		{"srcPort", positive(event.SrcPort)},
+		{"dst", event.DstIP},
+		{"dstPort", positive(event.DstPort)},
+		{"usrName", deref(event.Username)},
+		{"externalId", positive(event.ID)},
+		{"service", event.Protocol},
+		{"session", deref(event.Session)},
+		{"password", deref(event.Password)},
+		{"command", deref(event.Command)},
+		{"decoded", event.Deobfuscated()},
+		{"outcome", outcome(event)},
+		{"srcCountry", event.Country},
+		{"srcASN", positive(event.ASN)},
+		{"srcOrg", event.Org},
+		{"url", payloadString(event, "url")},
+		{"fileName", payloadString(event, "filename")},
+		{"fileHash", payloadString(event, "sha256")},
+		{"payload", payload(event)},
+	}
+
+	var attrs []string
+	for _, f := range fields {
+		if f.value != "" {
+			attrs = append(attrs, f.key+"="+leefValue.Replace(f.value))
+		}
+	}
+
+	return fmt.Sprintf("LEEF:2.0|%s|%s|%s|%s|x09|%s",
+		cefHeader.Replace(vendor),
+		cefHeader.Replace(product),
+		cefHeader.Replace(version),
+		cefHeader.Replace(string(event.Type)),
+		strings.Join(attrs, "\t"),
+	)
+}
+
+// get the human-readable name of the event.
+func name(event *types.Event) string {
+	switch event.Type {
+	case types.EventConnect:
+		return "Client connected"
+	case types.EventAuthPassword:
+		if event.Payload["escalate"] == true {
+			return "Privilege escalation attempt"
+		}
+		return "Password authentication"
+	case types.EventAuthPublicKey:
+		return "Public key authentication"
+	case types.EventCommand:
+		return "Command executed"
+	case types.EventDownload:
+		return "File downloaded"
+	case types.EventUpload:
+		return "File uploaded"
+	case types.EventForward:
+		return "Port forwarding requested"
+	case types.EventRequest:
+		return "Request received"
+	case types.EventDisconnect:
+		return "Client disconnected"
+	default:
+		return string(event.Type)
+	}
+}
+
+// get the outcome of the password authentication, empty for the other events.
+func outcome(event *types.Event) string {
+	switch success, ok := event.Payload["success"].(bool); {
+	case event.Type != types.EventAuthPassword || !ok:
+		return ""
+	case success:
+		return "success"
+	default:
+		return "failure"
+	}
+}
+
+// get the payload of the event as the JSON, empty when no payload.
+func payload(event *types.Event) string {
+	if len(event.Payload) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// get the string in the payload of the event, or empty.
+func payloadString(event *types.Event, key string) string {
+	if value, ok := event.Payload[key].(string); ok {
+		return value
+	}
+
+	return ""
+}
+
+// get the positive number as the string, empty when unknown.
+func positive(value int) string {
+	if value <= 0 {
+		return ""
+	}
+
+	return strconv.Itoa(value)
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// format the timestamp of RFC 5424, at most the microseconds.
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+}
@@ -0,0 +1,177 @@
+package syslog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+func TestEscape(t *testing.T) {
+	cases := []struct {
+		name    string
+		escaper *strings.Replacer
+		value   string
+		expect  string
+	}{
+		{name: "cef header", escaper: cefHeader, value: "plain", expect: "plain"},
+		{name: "cef header", escaper: cefHeader, value: `a|b\c`, expect: `a\|b\\c`},
+		{name: "cef header", escaper: cefHeader, value: "a\nb\rc=d", expect: "a b c=d"},
+		{name: "cef extension", escaper: cefExtension, value: `k=v|x\y`, expect: `k\=v|x\\y`},
+		{name: "cef extension", escaper: cefExtension, value: "a\nb\rc", expect: `a\nb\rc`},
+		{name: "cef extension", escaper: cefExtension, value: `\=`, expect: `\\\=`},
+		{name: "leef value", escaper: leefValue, value: "a\tb\nc\rd", expect: `a\tb\nc\rd`},
+		{name: "leef value", escaper: leefValue, value: `k=v|x\y`, expect: `k=v|x\y`},
+	}
+
+	for _, c := range cases {
+		if got := c.escaper.Replace(c.value); got != c.expect {
+			t.Errorf("expect the %s %q of %q, got %q", c.name, c.expect, c.value, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC)
+	session, username, password := "s-1", "root", "p=a|ss\\"
+	command := "echo a=b | sh\nid"
+
+	cases := []struct {
+		name    string
+		format  Format
+		event   *types.Event
+		version string
+		expect  string
+	}{
+		{
+			name:    "cef command",
+			format:  FormatCEF,
+			version: "1.2.3",
+			event:   &types.Event{ID: 7, CreatedAt: created, Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", SrcPort: 4321, Session: &session, Command: &command},
+			expect:  `CEF:0|cmj0121|zoe|1.2.3|command|Command executed|6|rt=1704164645678 externalId=7 app=ssh src=192.0.2.1 spt=4321 cs1Label=session cs1=s-1 cs3Label=command cs3=echo a\=b | sh\nid`,
+		},
+		{
+			name:    "cef login without the ID",
+			format:  FormatCEF,
+			version: "1.2|3",
+			event:   &types.Event{CreatedAt: created, Type: types.EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password, Payload: map[string]any{"success": true}},
+			expect:  `CEF:0|cmj0121|zoe|1.2\|3|auth.password|Password authentication|8|rt=1704164645678 app=ssh src=192.0.2.1 suser=root outcome=success cs2Label=password cs2=p\=a|ss\\ cs6Label=payload cs6={"success":true}`,
+		},
+		{
+			name:    "cef download",
+			format:  FormatCEF,
+			version: "-",
+			event:   &types.Event{CreatedAt: created, Type: types.EventDownload, Protocol: "ssh", SrcIP: "192.0.2.1", Payload: map[string]any{"url": "http://203.0.113.1/x?a=b", "sha256": "abc"}},
+			expect:  `CEF:0|cmj0121|zoe|-|download|File downloaded|8|rt=1704164645678 app=ssh src=192.0.2.1 cs6Label=payload cs6={"sha256":"abc","url":"http://203.0.113.1/x?a\=b"} requestUrl=http://203.0.113.1/x?a\=b fileHash=abc`,
+		},
+		{
+			name:    "leef command",
+			format:  FormatLEEF,
+			version: "1.2.3",
+			event:   &types.Event{ID: 7, CreatedAt: created, Type: types.EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Session: &session, Command: &command, Country: "TW", ASN: 3462},
+			expect: "LEEF:2.0|cmj0121|zoe|1.2.3|command|x09|devTime=2024-01-02T03:04:05.678+0000\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tcat=command\tsev=6\t" +
+				"src=192.0.2.1\texternalId=7\tservice=ssh\tsession=s-1\tcommand=echo a=b | sh\\nid\tsrcCountry=TW\tsrcASN=3462",
+		},
+		{
+			name:    "leef connect",
+			format:  FormatLEEF,
+			version: "1.2.3",
+			event:   &types.Event{CreatedAt: created, Type: types.EventConnect, Protocol: "ssh", SrcIP: "192.0.2.1", Payload: map[string]any{"client_version": "SSH-2.0-Go\tx"}},
+			expect: "LEEF:2.0|cmj0121|zoe|1.2.3|connect|x09|devTime=2024-01-02T03:04:05.678+0000\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tcat=connect\tsev=1\t" +
+				`src=192.0.2.1` + "\t" + `service=ssh` + "\t" + `payload={"client_version":"SSH-2.0-Go\tx"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, err := format(c.format, c.event, c.version)
+			switch {
+			case err != nil:
+				t.Fatalf("failed to format the event: %v", err)
+			case body != c.expect:
+				t.Errorf("expect\n%s\ngot\n%s", c.expect, body)
+			}
+		})
+	}
+
+	if _, err := format("xml", &types.Event{}, "-"); err == nil {
+		t.Errorf("expect the unsupported format rejected")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	cases := []struct {
+		event    *types.Event
+		severity int
+		syslog   int
+	}{
+		{event: &types.Event{Type: types.EventConnect}, severity: 1, syslog: severityInformational},
+		{event: &types.Event{Type: types.EventAuthPassword}, severity: 3, syslog: severityInformational},
+		{event: &types.Event{Type: types.EventAuthPassword, Payload: map[string]any{"success": true}}, severity: 8, syslog: severityWarning},
+		{event: &types.Event{Type: types.EventCommand}, severity: 6, syslog: severityNotice},
+		{event: &types.Event{Type: types.EventDownload}, severity: 8, syslog: severityWarning},
+		{event: &types.Event{Type: types.EventDisconnect}, severity: 1, syslog: severityInformational},
+	}
+
+	for _, c := range cases {
+		if severity, syslog := Severity(c.event), syslogSeverity(c.event); severity != c.severity || syslog != c.syslog {
+			t.Errorf("expect %d and %d of %+v, got %d and %d", c.severity, c.syslog, c.event, severity, syslog)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	event := &types.Event{
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC),
+		Type:      types.EventConnect,
+		Sensor:    "sensor 1\n",
+		Protocol:  "ssh",
+		SrcIP:     "192.0.2.1",
+	}
+
+	body := "<134>1 2024-01-02T03:04:05.123456Z sensor1 zoe 42 connect - LEEF:2.0|cmj0121|zoe|1.2.3|connect|x09|"
+	for _, network := range []string{"udp", "tcp"} {
+		s := &Syslog{Network: network, Format: FormatLEEF, facility: facilities["local0"], procID: "42", Version: "1.2.3"}
+
+		message, err := s.message(event)
+		if err != nil {
+			t.Fatalf("failed to create the message: %v", err)
+		}
+
+		text := string(message)
+		if network == "tcp" {
+			// framed by the octet counting
+			length, rest, _ := strings.Cut(text, " ")
+			if length != strconv.Itoa(len(rest)) {
+				t.Errorf("expect the octet counting %d, got %q", len(rest), length)
+			}
+			text = rest
+		}
+
+		if !strings.HasPrefix(text, body) {
+			t.Errorf("expect the %s message %q, got %q", network, body, text)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	cases := []struct {
+		value  string
+		size   int
+		expect string
+	}{
+		{value: "", size: 8, expect: "-"},
+		{value: " \t\n", size: 8, expect: "-"},
+		{value: "sensor 1", size: 8, expect: "sensor1"},
+		{value: "séñsor", size: 8, expect: "ssor"},
+		{value: "auth.password", size: 4, expect: "auth"},
+	}
+
+	for _, c := range cases {
+		if got := header(c.value, c.size); got != c.expect {
+			t.Errorf("expect %q of %q, got %q", c.expect, c.value, got)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// The syslog output sink that forwards the published events to the SIEM.
+//
+// The events are forwarded in the RFC 5424 messages over UDP, TCP or TLS, and the
+// message body is the JSON, the ArcSight CEF or the QRadar LEEF. The sink taps
+// the events before they are persisted, so the SIEM keeps receiving the events
+// when the database is down. The sink owns the bounded queue of the events, the
+// events are kept in the queue while reconnecting and dropped when the queue is
+// full, so the honeypots are never blocked.
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/metrics"
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+const (
+	// The timeout of connecting and writing to the SIEM.
+	timeout = 5 * time.Second
+	// The maximum backoff between the reconnections.
+	maxBackoff = time.Minute
+	// The application name in the syslog header.
+	appName = "zoe"
+)
+
+// The deadline of forwarding the queued events on shutdown.
+var drainTimeout = 10 * time.Second
+
+// The facilities of the syslog, from RFC 5424.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// The syslog sink of the published events.
+type Syslog struct {
+	Address   string `name:"address" help:"The address of the syslog server, like siem.example.com:6514, empty to disable"`
+	Network   string `name:"network" enum:"udp,tcp,tls" default:"udp" help:"The transport of the syslog, one of udp, tcp and tls"`
+	Format    Format `name:"format" enum:"json,cef,leef" default:"json" help:"The format of the message, one of json, cef and leef"`
+	Facility  string `name:"facility" default:"local0" help:"The facility of the syslog, like auth or local0"`
+	QueueSize int    `name:"queue-size" default:"4096" help:"The maximum number of the queued events, the excess events are dropped"`
+
+	// The TLS options, the system CA is used when the CA is empty.
+	CA       string `name:"ca" help:"The CA certificate of the syslog server in PEM"`
+	Cert     string `name:"cert" help:"The client certificate in PEM, for the mutual TLS"`
+	Key      string `name:"key" help:"The client private key in PEM, for the mutual TLS"`
+	Insecure bool   `name:"insecure" help:"Skip the verification of the syslog server certificate"`
+
+	// The version of zoe in the CEF and the LEEF header.
+	Version string `kong:"-" mapstructure:"-"`
+
+	facility int
+	tls      *tls.Config
+	procID   string
+
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+	done    chan struct{}
+
+	// the metrics of the sink
+	sent   atomic.Uint64
+	failed atomic.Uint64
+	sub    atomic.Pointer[pipeline.Subscriber]
+}
+
+// New creates the syslog sink with the default settings.
+func New() *Syslog {
+	return &Syslog{
+		Network:   "udp",
+		Format:    FormatJSON,
+		Facility:  "local0",
+		QueueSize: 4096,
+	}
+}
+
+// Init the syslog sink, the sink is disabled when the settings are invalid.
+func (s *Syslog) Init() {
+	if s == nil || s.Address == "" {
+		log.Debug().Msg("no syslog server configured, skip the syslog sink")
+		return
+	}
+
+	if err := s.init(); err != nil {
+		log.Warn().Err(err).Msg("failed to init the syslog sink, disable it")
+		s.Address = ""
+		return
+	}
+
+	s.done = make(chan struct{})
+	s.register()
+	log.Info().Str("address", s.Address).Str("network", s.Network).Str("format", string(s.Format)).Msg("init the syslog sink")
+}
+
+// Run the sink that forwards the published events until the context is done, and
+// forward the queued events before it stops.
+func (s *Syslog) Run(ctx context.Context) {
+	if s == nil || s.Address == "" {
+		return
+	}
+
+	defer close(s.done)
+
+	sub := pipeline.Tap(s.QueueSize)
+	s.sub.Store(sub)
+	s.serve(ctx, sub)
+}
+
+// Wait until the sink forwards the queued events and stops.
+func (s *Syslog) Wait() {
+	if s == nil || s.done == nil {
+		return
+	}
+
+	<-s.done
+}
+
+// forward the events of the tap until the context is done, then drain the queue
+// within the deadline.
+func (s *Syslog) serve(ctx context.Context, sub *pipeline.Subscriber) {
+	defer pipeline.Unsubscribe(sub)
+	defer s.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(sub, nil)
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			if err := s.forward(ctx, event); err != nil {
+				// interrupted by the shutdown while reconnecting
+				s.drain(sub, event)
+				return
+			}
+		}
+	}
+}
+
+// forward the pending event and the queued events on shutdown, the events left
+// after the deadline are counted as failed.
+func (s *Syslog) drain(sub *pipeline.Subscriber, pending *types.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	for event := pending; ; {
+		if event != nil {
+			if err := s.forward(ctx, event); err != nil {
+				lost := 1 + len(sub.Events())
+				s.failed.Add(uint64(lost))
+				log.Warn().Err(err).Int("events", lost).Msg("failed to forward the queued events to the syslog before the shutdown")
+				return
+			}
+		}
+
+		select {
+		case next, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			event = next
+		default:
+			return
+		}
+	}
+}
+
+// forward the event, and keep it while reconnecting until the context is done.
+// The later events are queued in the tap meanwhile.
+func (s *Syslog) forward(ctx context.Context, event *types.Event) error {
+	// the tapped event is not decoded yet
+	event.Decode()
+
+	message, err := s.message(event)
+	if err != nil {
+		s.failed.Add(1)
+		log.Debug().Err(err).Str("type", string(event.Type)).Msg("failed to format the event for the syslog")
+		return nil
+	}
+
+	for {
+		if err := s.write(message); err == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(s.retryAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// check the settings and prepare the TLS configuration.
+func (s *Syslog) init() error {
+	facility, ok := facilities[strings.ToLower(s.Facility)]
+	if !ok {
+		return fmt.Errorf("unsupported facility: %q", s.Facility)
+	}
+	s.facility = facility
+
+	switch s.Format {
+	case "":
+		s.Format = FormatJSON
+	case FormatJSON, FormatCEF, FormatLEEF:
+	default:
+		return fmt.Errorf("unsupported format: %q", s.Format)
+	}
+
+	switch s.Network {
+	case "":
+		s.Network = "udp"
+	case "udp", "tcp":
+	case "tls":
+		config, err := s.tlsConfig()
+		if err != nil {
+			return err
+		}
+		s.tls = config
+	default:
+		return fmt.Errorf("unsupported network: %q", s.Network)
+	}
+
+	if s.QueueSize <= 0 {
+		s.QueueSize = 1
+	}
+	if s.Version == "" {
+		s.Version = "-"
+	}
+
+	s.procID = strconv.Itoa(os.Getpid())
+	return nil
+}
+
+// load the CA and the client certificate of the TLS.
+func (s *Syslog) tlsConfig() (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	config := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.Insecure,
+	}
+
+	if s.CA != "" {
+		data, err := os.ReadFile(s.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate in the CA: %s", s.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if s.Cert != "" || s.Key != "" {
+		cert, err := tls.LoadX509KeyPair(s.Cert, s.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// write the syslog message, reconnect once when the connection is broken, and
+// back off when failed.
+func (s *Syslog) write(message []byte) error {
+	for attempt := 0; ; attempt++ {
+		if err := s.connect(); err != nil {
+			return err
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(timeout))
+		_, err := s.conn.Write(message)
+		if err == nil {
+			s.sent.Add(1)
+			return nil
+		}
+
+		log.Warn().Err(err).Str("address", s.Address).Msg("failed to write the syslog, reconnect")
+		s.close()
+
+		if attempt > 0 {
+			s.retry()
+			return err
+		}
+	}
+}
+
+// get the RFC 5424 message of the event, framed by the octet counting over the
+// TCP and the TLS (RFC 6587 and RFC 5425).
+func (s *Syslog) message(event *types.Event) ([]byte, error) {
+	body, err := format(s.Format, event, s.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		s.facility*8+syslogSeverity(event),
+		timestamp(event.CreatedAt),
+		header(event.Sensor, 255),
+		appName,
+		s.procID,
+		header(string(event.Type), 32),
+		body,
+	)
+
+	if s.Network == "udp" {
+		return []byte(message), nil
+	}
+
+	return []byte(fmt.Sprintf("%d %s", len(message), message)), nil
+}
+
+// connect to the syslog server when not connected, and back off when failed.
+func (s *Syslog) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	var conn net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: timeout}
+	switch s.Network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.Address, s.tls)
+	default:
+		conn, err = dialer.Dial(s.Network, s.Address)
+	}
+
+	if err != nil {
+		s.retry()
+		log.Warn().Err(err).Str("address", s.Address).Dur("backoff", s.backoff).Msg("failed to connect the syslog server")
+		return err
+	}
+
+	log.Info().Str("address", s.Address).Str("network", s.Network).Msg("connected to the syslog server")
+	s.conn = conn
+	s.backoff = 0
+	return nil
+}
+
+// double the backoff up to the maximum, and reconnect after the backoff.
+func (s *Syslog) retry() {
+	s.backoff = min(max(2*s.backoff, time.Second), maxBackoff)
+	s.retryAt = time.Now().Add(s.backoff)
+}
+
+// close the connection, reconnected on the next write.
+func (s *Syslog) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// register the metrics of the sink.
+func (s *Syslog) register() {
+	counter := func(name, help string, value func() uint64) prometheus.Collector {
+		opts := prometheus.CounterOpts{Name: metrics.Name(name), Help: help}
+		return prometheus.NewCounterFunc(opts, func() float64 { return float64(value()) })
+	}
+
+	dropped := func() uint64 {
+		if sub := s.sub.Load(); sub != nil {
+			return sub.Dropped()
+		}
+		return 0
+	}
+
+	metrics.Register(
+		counter("syslog_sent_total", "The number of the events forwarded to the syslog.", s.sent.Load),
+		counter("syslog_failed_total", "The number of the events failed to forward to the syslog.", s.failed.Load),
+		counter("syslog_dropped_total", "The number of the events dropped since the syslog queue is full.", dropped),
+	)
+}
+
+// get the header field of RFC 5424, the printable ASCII without the space, or
+// the nil value (-) when empty.
+func header(value string, size int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+
+	switch {
+	case value == "":
+		return "-"
+	case len(value) > size:
+		return value[:size]
+	default:
+		return value
+	}
+}
@@ -0,0 +1,261 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/types"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	database.Init("sqlite3", ":memory:")
+
+	source, err := iofs.New(os.DirFS("../../assets/migrations"), "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migration.Up(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// the TCP syslog server that reads the messages framed by the octet counting.
+type server struct {
+	listener net.Listener
+	messages chan string
+}
+
+func listen(t *testing.T, address string) *server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to listen the syslog server: %v", err)
+	}
+
+	s := &server{listener: listener, messages: make(chan string, 64)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				for {
+					var size int
+					if _, err := fmt.Fscanf(reader, "%d ", &size); err != nil {
+						return
+					}
+
+					message := make([]byte, size)
+					if _, err := io.ReadFull(reader, message); err != nil {
+						return
+					}
+					s.messages <- string(message)
+				}
+			}()
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// wait for the number of the messages.
+func (s *server) receive(t *testing.T, count int, wait time.Duration) []string {
+	t.Helper()
+
+	var messages []string
+	deadline := time.After(wait)
+	for len(messages) < count {
+		select {
+		case message := <-s.messages:
+			messages = append(messages, message)
+		case <-deadline:
+			t.Fatalf("expect %d messages, got %d: %q", count, len(messages), messages)
+		}
+	}
+
+	return messages
+}
+
+// get the address that nobody listens.
+func unusedAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve the address: %v", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func newSink(t *testing.T, address string, format Format) *Syslog {
+	t.Helper()
+
+	s := New()
+	s.Address = address
+	s.Network = "tcp"
+	s.Format = format
+	s.Version = "1.2.3"
+	s.Init()
+
+	if s.Address == "" {
+		t.Fatalf("failed to init the syslog sink")
+	}
+	return s
+}
+
+// serve the events of the tap in the background until the test ends.
+func serve(t *testing.T, s *Syslog) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	sub := pipeline.Tap(s.QueueSize)
+	go func() {
+		defer close(done)
+		s.serve(ctx, sub)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func command(ip, command string) *types.Event {
+	return &types.Event{Type: types.EventCommand, Protocol: "ssh", SrcIP: ip, Command: &command}
+}
+
+func TestSyslog(t *testing.T) {
+	server := listen(t, "127.0.0.1:0")
+	s := newSink(t, server.listener.Addr().String(), FormatCEF)
+
+	serve(t, s)
+
+	pipeline.Publish(command("192.0.2.1", "uname -a"))
+	// the payload cannot be persisted, but is still forwarded
+	event := command("192.0.2.2", "id")
+	event.Payload = map[string]any{"value": func() {}}
+	pipeline.Publish(event)
+
+	messages := server.receive(t, 2, 5*time.Second)
+	for index, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		message := messages[index]
+		switch {
+		case !strings.HasPrefix(message, "<133>1 "):
+			t.Errorf("expect the local0.notice message, got %q", message)
+		case !strings.Contains(message, " zoe "+s.procID+" command - CEF:0|cmj0121|zoe|1.2.3|command|Command executed|6|"):
+			t.Errorf("expect the CEF header, got %q", message)
+		case !strings.Contains(message, "src="+ip):
+			t.Errorf("expect the source %s, got %q", ip, message)
+		case strings.Contains(message, "externalId="):
+			t.Errorf("expect no external ID before persisted, got %q", message)
+		}
+	}
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	address := unusedAddress(t)
+	s := newSink(t, address, FormatJSON)
+
+	serve(t, s)
+
+	// the events are kept in the queue while the server is down
+	for index := 0; index < 3; index++ {
+		pipeline.Publish(command("192.0.2.3", fmt.Sprintf("echo %d", index)))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	server := listen(t, address)
+	messages := server.receive(t, 3, 5*time.Second)
+	for index, message := range messages {
+		if !strings.Contains(message, fmt.Sprintf(`"command":"echo %d"`, index)) {
+			t.Errorf("expect the event #%d in order, got %q", index, message)
+		}
+	}
+
+	if failed := s.failed.Load(); failed != 0 {
+		t.Errorf("expect no failed event, got %d", failed)
+	}
+}
+
+func TestSyslogDrain(t *testing.T) {
+	server := listen(t, "127.0.0.1:0")
+	s := newSink(t, server.listener.Addr().String(), FormatLEEF)
+
+	sub := pipeline.Tap(s.QueueSize)
+	for index := 0; index < 5; index++ {
+		pipeline.Publish(command("192.0.2.4", fmt.Sprintf("echo %d", index)))
+	}
+
+	// the queued events are forwarded after the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.serve(ctx, sub)
+
+	server.receive(t, 5, 5*time.Second)
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("expect the tap closed after served")
+	}
+}
+
+func TestSyslogDrainTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { drainTimeout = timeout }(drainTimeout)
+	drainTimeout = 100 * time.Millisecond
+
+	s := newSink(t, unusedAddress(t), FormatJSON)
+
+	sub := pipeline.Tap(s.QueueSize)
+	for index := 0; index < 3; index++ {
+		pipeline.Publish(command("192.0.2.5", "id"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	s.serve(ctx, sub)
+
+	switch elapsed := time.Since(start); {
+	case elapsed > 2*time.Second:
+		t.Errorf("expect the drain stopped by the deadline, took %v", elapsed)
+	case s.failed.Load() != 3:
+		t.Errorf("expect 3 failed events, got %d", s.failed.Load())
+	}
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// The source IP seen in the honeypot, aggregated from the events.
+type BlockedIP struct {
+	IP        netip.Addr `json:"ip"`
+	Country   string     `json:"country,omitempty"`
+	Events    int        `json:"events"`
+	Attempts  int        `json:"attempts"`
+	LoggedIn  bool       `json:"logged_in"`
+	Commands  int        `json:"commands"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+}
+
+// The thresholds of the blocklist, the zero value lists all the source IPs in the
+// time range.
+type BlocklistFilter struct {
+	// The time range of the events, [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// The minimum number of the authentication attempts.
+	MinAttempts int
+	// Only the source IPs logged in the honeypot.
+	LoggedIn bool
+	// Only the source IPs executed the commands.
+	Commands bool
+	// The source IPs never listed, like the own scanners.
+	Allowlist []netip.Prefix
+}
+
+// Parse the allowlist of the IPs or the CIDRs, separated by the comma or listed.
+func ParseAllowlist(values ...string) ([]netip.Prefix, error) {
+	var allowlist []netip.Prefix
+
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			switch {
+			case item == "":
+			case strings.Contains(item, "/"):
+				prefix, err := netip.ParsePrefix(item)
+				if err != nil {
+					return nil, fmt.Errorf("invalid CIDR: %s", item)
+				}
+				allowlist = append(allowlist, prefix.Masked())
+			default:
+				addr, err := netip.ParseAddr(item)
+				if err != nil {
+					return nil, fmt.Errorf("invalid IP: %s", item)
+				}
+				allowlist = append(allowlist, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			}
+		}
+	}
+
+	return allowlist, nil
+}
+
+// The aggregates of the source IP, the disconnect with the session is only
+// recorded after the client logged in.
+const (
+	sumAttempts = "SUM(CASE WHEN type LIKE 'auth.%' THEN 1 ELSE 0 END)"
+	sumLoggedIn = "SUM(CASE WHEN type = 'command' OR (type = 'disconnect' AND session IS NOT NULL) THEN 1 ELSE 0 END)"
+	sumCommands = "SUM(CASE WHEN type = 'command' THEN 1 ELSE 0 END)"
+)
+
+// Get the source IPs matched the thresholds in the time range, ordered by the IP.
+func Blocklist(ctx context.Context, filter BlocklistFilter) ([]*BlockedIP, error) {
+	having := []string{"1 = 1"}
+	if filter.MinAttempts > 0 {
+		having = append(having, fmt.Sprintf("%s >= %d", sumAttempts, filter.MinAttempts))
+	}
+	if filter.LoggedIn {
+		having = append(having, sumLoggedIn+" > 0")
+	}
+	if filter.Commands {
+		having = append(having, sumCommands+" > 0")
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT
+			src_ip,
+			MAX(country),
+			COUNT(*),
+			%s,
+			%s,
+			%s,
+			MIN(created_at),
+			MAX(created_at)
+		FROM event
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY src_ip
+		HAVING %s
+	`, sumAttempts, sumLoggedIn, sumCommands, strings.Join(having, " AND "))
+
+	until := filter.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	rows, err := database.Session().QueryContext(ctx, stmt, filter.Since.UTC(), until.UTC())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the blocklist")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocklist []*BlockedIP
+	for rows.Next() {
+		var ip string
+		var country *string
+		var loggedIn int
+		var firstSeen, lastSeen database.Timestamp
+		var blocked BlockedIP
+
+		err := rows.Scan(&ip, &country, &blocked.Events, &blocked.Attempts, &loggedIn, &blocked.Commands, &firstSeen, &lastSeen)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to parse the blocklist")
+			return nil, err
+		}
+
+		if blocked.IP, err = netip.ParseAddr(ip); err != nil {
+			log.Debug().Str("ip", ip).Msg("skip the invalid source IP")
+			continue
+		}
+		blocked.IP = blocked.IP.Unmap()
+
+		if slices.ContainsFunc(filter.Allowlist, func(prefix netip.Prefix) bool { return prefix.Contains(blocked.IP) }) {
+			continue
+		}
+
+		blocked.Country = deref(country)
+		blocked.LoggedIn = loggedIn > 0
+		blocked.FirstSeen = firstSeen.Time
+		blocked.LastSeen = lastSeen.Time
+		blocklist = append(blocklist, &blocked)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(blocklist, func(a, b *BlockedIP) int { return a.IP.Compare(b.IP) })
+	return blocklist, nil
+}
@@ -0,0 +1,564 @@
+package types
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/database"
+	"github.com/cmj0121/zoe/pkg/decoder"
+	"github.com/cmj0121/zoe/pkg/geoip"
+)
+
+// The type of the event happens in the honeypot.
+type EventType string
+
+const (
+	// The client connects to the honeypot.
+	EventConnect EventType = "connect"
+	// The client tries to authenticate by the password.
+	EventAuthPassword EventType = "auth.password"
+	// The client tries to authenticate by the public key.
+	EventAuthPublicKey EventType = "auth.publickey"
+	// The client executes the command.
+	EventCommand EventType = "command"
+	// The client downloads the file into the honeypot, like wget or curl.
+	EventDownload EventType = "download"
+	// The client uploads the file into the honeypot, like scp or sftp.
+	EventUpload EventType = "upload"
+	// The client asks to forward the connection, like the direct-tcpip channel.
+	EventForward EventType = "forward"
+	// The client sends the request to the honeypot, like the HTTP request.
+	EventRequest EventType = "request"
+	// The client disconnects from the honeypot.
+	EventDisconnect EventType = "disconnect"
+)
+
+const (
+	// The maximum bytes of the indexed columns controlled by the clients, like the
+	// username and the session.
+	maxIndexed = 255
+	// The maximum bytes of the text columns, the TEXT of MySQL.
+	maxText = 65535
+)
+
+// The columns of the event table, in the order of the Scan.
+const eventColumns = `id, created_at, type, sensor, session, protocol, src_ip, src_port, dst_ip, dst_port, country, city, asn, org, username, password, command, script, decoded, payload`
+
+// The event that records the behavior in the honeypot, the common envelope is
+// shared by all the types and the type-specific details are kept in the payload.
+type Event struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// The common envelope of the event.
+	Type     EventType `json:"type"`
+	Sensor   string    `json:"sensor"`
+	Session  *string   `json:"session"`
+	Protocol string    `json:"protocol"`
+	SrcIP    string    `json:"src_ip"`
+	SrcPort  int       `json:"src_port"`
+	DstIP    string    `json:"dst_ip"`
+	DstPort  int       `json:"dst_port"`
+
+	// The location of the source IP, enriched from the local GeoIP databases.
+	Country string `json:"country"`
+	City    string `json:"city"`
+	ASN     int    `json:"asn"`
+	Org     string `json:"org"`
+
+	// The well-known fields, kept in the columns for the reports.
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Command  *string `json:"command"`
+	Script   *string `json:"script"`
+	// The command after decoding the obfuscations, like base64 or hex.
+	Decoded *string `json:"decoded"`
+
+	// The type-specific details of the event.
+	Payload map[string]any `json:"payload"`
+}
+
+// NewEvent creates the event with the envelope from the source and destination address.
+func NewEvent(kind EventType, protocol string, src, dst net.Addr) *Event {
+	event := &Event{Type: kind, Protocol: protocol}
+
+	if src != nil {
+		event.SrcIP, event.SrcPort = splitAddr(src.String())
+	}
+	if dst != nil {
+		event.DstIP, event.DstPort = splitAddr(dst.String())
+	}
+
+	return event
+}
+
+// Set the type-specific detail into the payload.
+func (e *Event) Set(key string, value any) *Event {
+	if e.Payload == nil {
+		e.Payload = map[string]any{}
+	}
+
+	e.Payload[key] = value
+	return e
+}
+
+// Insert the event into the database.
+func (e *Event) Insert() error {
+	return InsertEvents(context.Background(), []*Event{e})
+}
+
+// Insert the events and merge their daily rollups into the database in a single
+// transaction.
+func InsertEvents(ctx context.Context, events []*Event) error {
+	tx, err := database.Session().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := event.insert(ctx, tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	for _, rollup := range RollupEvents(events) {
+		if err := rollup.Merge(ctx, tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Prepare the event before recorded, stamp the time, locate the source IP and
+// sanitize the values controlled by the clients. The prepared event is kept as is
+// when prepared again. The command is decoded by Decode, which is much slower.
+func (e *Event) Prepare() {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	if e.Country == "" && e.ASN == 0 && geoip.Enabled() {
+		e.Locate(geoip.Lookup(e.SrcIP))
+	}
+
+	// the values controlled by the clients may be invalid or exceed the columns
+	e.Username = sanitize(e.Username, maxIndexed)
+	e.Session = sanitize(e.Session, maxIndexed)
+	e.Password = sanitize(e.Password, maxText)
+	e.Command = sanitize(e.Command, maxText)
+	e.Script = sanitize(e.Script, maxText)
+	e.Decoded = sanitize(e.Decoded, maxText)
+}
+
+// Decode the command of the event when not decoded yet, the decoded command is
+// sanitized as the command.
+func (e *Event) Decode() {
+	if e.Command == nil || e.Decoded != nil {
+		return
+	}
+
+	decoded, _ := decoder.Decode(*e.Command)
+	e.Decoded = sanitize(&decoded, maxText)
+}
+
+func (e *Event) insert(ctx context.Context, executor database.Executor) error {
+	e.Prepare()
+	e.Decode()
+
+	var payload *string
+	if len(e.Payload) > 0 {
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return err
+		}
+
+		text := string(data)
+		payload = &text
+	}
+
+	stmt := `
+		INSERT INTO event (
+			created_at, type, sensor, session, protocol, src_ip, src_port, dst_ip, dst_port,
+			country, city, asn, org,
+			username, password, command, script, decoded, payload
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	args := []any{
+		e.CreatedAt, e.Type, e.Sensor, e.Session, e.Protocol, e.SrcIP, nullInt(e.SrcPort), e.DstIP, nullInt(e.DstPort),
+		nullString(e.Country), nullString(e.City), nullInt(e.ASN), nullString(e.Org),
+		e.Username, e.Password, e.Command, e.Script, e.Decoded, payload,
+	}
+
+	// keep the ID of the inserted event, the PostgreSQL has no LastInsertId
+	switch executor.Dialect() {
+	case database.Postgres:
+		return executor.QueryRowContext(ctx, stmt+" RETURNING id", args...).Scan(&e.ID)
+	default:
+		result, err := executor.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		e.ID = int(id)
+		return nil
+	}
+}
+
+func EventFromRow(rows *sql.Rows) (*Event, error) {
+	var event Event
+	var sensor, protocol, srcIP, dstIP, country, city, org, payload *string
+	var srcPort, dstPort, asn *int
+
+	err := rows.Scan(
+		&event.ID, &event.CreatedAt, &event.Type, &sensor, &event.Session, &protocol,
+		&srcIP, &srcPort, &dstIP, &dstPort, &country, &city, &asn, &org,
+		&event.Username, &event.Password, &event.Command, &event.Script, &event.Decoded, &payload,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Sensor = deref(sensor)
+	event.Protocol = deref(protocol)
+	event.SrcIP = deref(srcIP)
+	event.DstIP = deref(dstIP)
+	event.Country = deref(country)
+	event.City = deref(city)
+	event.Org = deref(org)
+	if srcPort != nil {
+		event.SrcPort = *srcPort
+	}
+	if dstPort != nil {
+		event.DstPort = *dstPort
+	}
+	if asn != nil {
+		event.ASN = *asn
+	}
+
+	if payload != nil {
+		if err := json.Unmarshal([]byte(*payload), &event.Payload); err != nil {
+			log.Warn().Err(err).Int("id", event.ID).Msg("failed to parse the event payload")
+		}
+	}
+
+	if event.Command != nil {
+		command := strings.TrimSpace(*event.Command)
+		event.Command = &command
+	}
+
+	return &event, nil
+}
+
+// Set the location of the source IP.
+func (e *Event) Locate(location geoip.Location) {
+	e.Country = location.Country
+	e.City = location.City
+	e.ASN = int(location.ASN)
+	e.Org = location.Org
+}
+
+// Get the decoded command when it differs from the original one, or the empty string.
+func (e *Event) Deobfuscated() string {
+	if e.Command == nil || e.Decoded == nil || strings.TrimSpace(*e.Decoded) == strings.TrimSpace(*e.Command) {
+		return ""
+	}
+
+	return strings.TrimSpace(*e.Decoded)
+}
+
+// Decode the captured commands that have not been analyzed yet, like the events
+// stored before the decoder is introduced.
+func DecodeEvents(ctx context.Context) {
+	sess := database.Session()
+
+	rows, err := sess.QueryContext(ctx, `SELECT id, command FROM event WHERE command IS NOT NULL AND decoded IS NULL`)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the undecoded events")
+		return
+	}
+
+	decoded := map[int]string{}
+	for rows.Next() {
+		var id int
+		var command string
+
+		if err := rows.Scan(&id, &command); err != nil {
+			log.Warn().Err(err).Msg("failed to parse the undecoded event")
+			continue
+		}
+
+		decoded[id], _ = decoder.Decode(command)
+	}
+	rows.Close()
+
+	for id, command := range decoded {
+		if _, err := sess.ExecContext(ctx, `UPDATE event SET decoded = ? WHERE id = ?`, command, id); err != nil {
+			log.Warn().Err(err).Int("id", id).Msg("failed to update the decoded event")
+			return
+		}
+	}
+
+	log.Info().Int("count", len(decoded)).Msg("decode the captured commands")
+}
+
+// Enrich the events that have not been located yet by the GeoIP databases, like
+// the events stored before the databases are configured.
+func EnrichEvents(ctx context.Context) {
+	if !geoip.Enabled() {
+		return
+	}
+
+	sess := database.Session()
+
+	rows, err := sess.QueryContext(ctx, `SELECT DISTINCT src_ip FROM event WHERE src_ip IS NOT NULL AND country IS NULL AND asn IS NULL`)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the unlocated events")
+		return
+	}
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			log.Warn().Err(err).Msg("failed to parse the unlocated event")
+			continue
+		}
+
+		ips = append(ips, ip)
+	}
+	rows.Close()
+
+	count := 0
+	for _, ip := range ips {
+		location := geoip.Lookup(ip)
+		if location == (geoip.Location{}) {
+			continue
+		}
+
+		stmt := `UPDATE event SET country = ?, city = ?, asn = ?, org = ? WHERE src_ip = ? AND country IS NULL AND asn IS NULL`
+		args := []any{nullString(location.Country), nullString(location.City), nullInt(int(location.ASN)), nullString(location.Org), ip}
+		if _, err := sess.ExecContext(ctx, stmt, args...); err != nil {
+			log.Warn().Err(err).Str("ip", ip).Msg("failed to update the located events")
+			return
+		}
+		count++
+	}
+
+	log.Info().Int("count", count).Msg("enrich the events by the GeoIP")
+}
+
+// Iter the events from the database, from the latest to the oldest.
+func IterEvent(ctx context.Context) <-chan *Event {
+	ch := make(chan *Event, 1)
+
+	sess := database.Session()
+	base_id := math.MaxInt64
+	page_size := 10
+
+	go func() {
+		defer close(ch)
+
+		stmt := fmt.Sprintf(`
+			SELECT %s
+			FROM event
+			WHERE id < ?
+			ORDER BY id DESC
+			LIMIT ?
+		`, eventColumns)
+
+		for base_id > 0 {
+			rows, err := sess.QueryContext(ctx, stmt, base_id, page_size)
+			if err != nil {
+				log.Warn().Err(err).Msg("failed to query the events")
+				return
+			}
+
+			var events []*Event
+			for rows.Next() {
+				switch event, err := EventFromRow(rows); err {
+				case nil:
+					events = append(events, event)
+				default:
+					log.Warn().Err(err).Msg("failed to parse the event")
+					continue
+				}
+			}
+			rows.Close()
+
+			if len(events) == 0 {
+				return
+			}
+
+			for _, event := range events {
+				base_id = event.ID
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Get the daily events based on the passed-in field, at most limit events.
+func DailyEvents(ctx context.Context, field string, limit int) []*Event {
+	return RangeEvents(ctx, field, Yesterday(), limit)
+}
+
+// Get the oldest events in the range based on the passed-in field, at most limit
+// events.
+func RangeEvents(ctx context.Context, field string, r Range, limit int) []*Event {
+	sess := database.Session()
+
+	stmt := fmt.Sprintf(`
+		SELECT %[2]s
+		FROM event
+		WHERE
+			event.created_at >= ? AND event.created_at < ? AND event.%[1]v IS NOT NULL
+		ORDER BY id
+		LIMIT ?
+	`, field, eventColumns)
+
+	rows, err := sess.QueryContext(ctx, stmt, r.Since.UTC(), r.Until.UTC(), limit)
+	if err != nil {
+		log.Warn().Err(err).Str("field", field).Msg("failed to query the daily events")
+		return nil
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := EventFromRow(rows)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to parse the daily event")
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// Get the oldest events created before the time, at most size events.
+func ExpiredEvents(ctx context.Context, before time.Time, size int) ([]*Event, error) {
+	stmt := fmt.Sprintf(`
+		SELECT %s
+		FROM event
+		WHERE created_at < ?
+		ORDER BY id
+		LIMIT ?
+	`, eventColumns)
+
+	rows, err := database.Session().QueryContext(ctx, stmt, before, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := EventFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Delete the events created before the time and the ID is not greater than the
+// passed-in ID, return the number of the deleted events.
+func DeleteEvents(ctx context.Context, before time.Time, id int) (int64, error) {
+	result, err := database.Session().ExecContext(ctx, `DELETE FROM event WHERE created_at < ? AND id <= ?`, before, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// split the address into the IP and the port, the port is 0 when not present.
+func splitAddr(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+
+	number, _ := strconv.Atoi(port)
+	return host, number
+}
+
+// the unknown value, like the port 0, is stored as NULL.
+func nullInt(value int) *int {
+	if value <= 0 {
+		return nil
+	}
+
+	return &value
+}
+
+func nullString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+// truncate the string to at most the size in bytes, without breaking the UTF-8
+// character.
+// sanitize the value controlled by the clients, rejected by the Postgres and the
+// MySQL otherwise: the invalid UTF-8 is replaced, the NUL is stripped and the
+// value is truncated to at most the size of bytes on the rune boundary.
+func sanitize(value *string, size int) *string {
+	if value == nil {
+		return nil
+	}
+
+	text := strings.ReplaceAll(strings.ToValidUTF8(*value, string(utf8.RuneError)), "\x00", "")
+	if len(text) > size {
+		cut := 0
+		for index := range text {
+			if index > size {
+				break
+			}
+			cut = index
+		}
+
+		text = text[:cut]
+	}
+
+	return &text
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestInsertEvents(t *testing.T) {
+	reset(t)
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	session, username, password, command := "abcd1234", "root", "123456", "echo aGk= | base64 -d"
+
+	events := []*Event{
+		{CreatedAt: now, Type: EventConnect, Sensor: "s1", Session: &session, Protocol: "ssh", SrcIP: "192.0.2.1", SrcPort: 40000, DstIP: "198.51.100.1", DstPort: 22},
+		{CreatedAt: now.Add(time.Second), Type: EventAuthPassword, Sensor: "s1", Session: &session, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password, Payload: map[string]any{"success": true}},
+		{CreatedAt: now.Add(2 * time.Second), Type: EventCommand, Sensor: "s1", Session: &session, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &command},
+	}
+
+	if err := InsertEvents(ctx, events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	for index, event := range events {
+		if event.ID == 0 {
+			t.Errorf("expect the ID of the event #%d", index)
+		}
+	}
+
+	page, err := QueryEvents(ctx, EventFilter{Session: session})
+	if err != nil {
+		t.Fatalf("failed to query the events: %v", err)
+	}
+
+	if len(page.Events) != len(events) {
+		t.Fatalf("expect %d events, got %d", len(events), len(page.Events))
+	}
+
+	// from the latest to the oldest
+	got := page.Events[2]
+	switch {
+	case got.ID != events[0].ID || got.Type != EventConnect || !got.CreatedAt.Equal(now):
+		t.Errorf("unexpected event: %+v", got)
+	case got.SrcIP != "192.0.2.1" || got.SrcPort != 40000 || got.DstIP != "198.51.100.1" || got.DstPort != 22:
+		t.Errorf("unexpected envelope: %+v", got)
+	case got.Username != nil || got.Payload != nil:
+		t.Errorf("expect no username and payload: %+v", got)
+	}
+
+	if got := page.Events[1]; deref(got.Username) != username || deref(got.Password) != password || got.Payload["success"] != true {
+		t.Errorf("unexpected authentication: %+v", got)
+	}
+
+	if got := page.Events[0]; deref(got.Command) != command || deref(got.Decoded) == "" {
+		t.Errorf("expect the decoded command: %+v", got)
+	}
+}
+
+func TestInsertEventsTruncate(t *testing.T) {
+	reset(t)
+
+	// the multi-byte character across the limit is dropped as a whole
+	username := strings.Repeat("a", maxIndexed-1) + "日本"
+	password := strings.Repeat("p", maxText+1)
+
+	event := &Event{Type: EventAuthPassword, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password}
+	if err := InsertEvents(context.Background(), []*Event{event}); err != nil {
+		t.Fatalf("failed to insert the event: %v", err)
+	}
+
+	page, err := QueryEvents(context.Background(), EventFilter{})
+	if err != nil || len(page.Events) != 1 {
+		t.Fatalf("expect one event, got %v", err)
+	}
+
+	switch got := page.Events[0]; {
+	case deref(got.Username) != strings.Repeat("a", maxIndexed-1):
+		t.Errorf("unexpected username of %d bytes", len(deref(got.Username)))
+	case len(deref(got.Password)) != maxText:
+		t.Errorf("unexpected password of %d bytes", len(deref(got.Password)))
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		value  string
+		size   int
+		expect string
+	}{
+		{value: "root", size: 8, expect: "root"},
+		{value: "ro\x00ot", size: 8, expect: "root"},
+		{value: "\x00\x00", size: 8, expect: ""},
+		{value: "ro\xffot", size: 8, expect: "ro\uFFFDot"},
+		{value: "\xc3\x28", size: 8, expect: "\uFFFD("},
+		{value: "abcdef", size: 4, expect: "abcd"},
+		// the multi-byte character across the limit is dropped as a whole
+		{value: "ab日本", size: 4, expect: "ab"},
+		{value: "ab日本", size: 5, expect: "ab日"},
+		// the replacement of the invalid byte takes 3 bytes
+		{value: "ab\xff", size: 4, expect: "ab"},
+		{value: "ab\x00\x00\x00cd", size: 4, expect: "abcd"},
+	}
+
+	for _, c := range cases {
+		value := c.value
+		switch got := sanitize(&value, c.size); {
+		case got == nil || *got != c.expect:
+			t.Errorf("expect %q of %q, got %v", c.expect, c.value, got)
+		case len(*got) > c.size || !utf8.ValidString(*got):
+			t.Errorf("expect the valid UTF-8 of at most %d bytes, got %q", c.size, *got)
+		}
+	}
+
+	if sanitize(nil, 8) != nil {
+		t.Errorf("expect the nil kept")
+	}
+}
+
+func TestInsertEventsInvalidUTF8(t *testing.T) {
+	reset(t)
+
+	username, password, command := "ro\x00ot", "\xff\xfepass", "echo \x00\xc3\x28"
+	event := &Event{Type: EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Username: &username, Password: &password, Command: &command}
+	if err := InsertEvents(context.Background(), []*Event{event}); err != nil {
+		t.Fatalf("failed to insert the event: %v", err)
+	}
+
+	page, err := QueryEvents(context.Background(), EventFilter{})
+	if err != nil || len(page.Events) != 1 {
+		t.Fatalf("expect one event, got %v", err)
+	}
+
+	got := page.Events[0]
+	for name, value := range map[string]string{"username": deref(got.Username), "password": deref(got.Password), "command": deref(got.Command), "decoded": deref(got.Decoded)} {
+		if !utf8.ValidString(value) || strings.Contains(value, "\x00") {
+			t.Errorf("expect the valid UTF-8 %s without NUL, got %q", name, value)
+		}
+	}
+
+	if deref(got.Username) != "root" || deref(got.Command) != "echo \uFFFD(" {
+		t.Errorf("unexpected username %q and command %q", deref(got.Username), deref(got.Command))
+	}
+}
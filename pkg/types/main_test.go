@@ -0,0 +1,53 @@
+package types
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// run the tests against the in-memory SQLite3 migrated to the latest schema.
+func TestMain(m *testing.M) {
+	database.Init("sqlite3", ":memory:")
+	if err := migrateUp(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func migrateUp() error {
+	source, err := iofs.New(os.DirFS("../../assets/migrations"), "sqlite3")
+	if err != nil {
+		return err
+	}
+
+	driver, err := sqlite3.WithInstance(database.Session().DB(), &sqlite3.Config{})
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		return err
+	}
+
+	return m.Up()
+}
+
+// reset the tables before the test.
+func reset(t *testing.T) {
+	t.Helper()
+
+	for _, table := range []string{"event", "rollup"} {
+		if _, err := database.Session().ExecContext(context.Background(), "DELETE FROM "+table); err != nil {
+			t.Fatalf("failed to reset %s: %v", table, err)
+		}
+	}
+}
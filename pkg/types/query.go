@@ -0,0 +1,215 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// The maximum number of the scanned pages for the filter that cannot be done in
+// the SQL, like the CIDR of the client IP.
+const maxScanPages = 16
+
+// The filter of the events, the empty field matches all.
+type EventFilter struct {
+	Type     EventType
+	Service  string
+	Session  string
+	Username string
+	Password string
+	// The substring of the command, case-sensitive on all the databases.
+	Command string
+	// The client IP or the CIDR, like 192.0.2.1 or 192.0.2.0/24.
+	ClientIP string
+	// The time range of the events, [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// The events with the ID less than the cursor, 0 means from the latest.
+	Cursor int
+	Limit  int
+}
+
+// The page of the events, the next cursor is 0 when there are no more events.
+type EventPage struct {
+	Events     []*Event `json:"events"`
+	NextCursor int      `json:"next_cursor,omitempty"`
+}
+
+// Query the events matched the filter, from the latest to the oldest.
+func QueryEvents(ctx context.Context, filter EventFilter) (*EventPage, error) {
+	var network *net.IPNet
+	var conds []string
+	var args []any
+
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	if filter.Type != "" {
+		add("type = ?", filter.Type)
+	}
+	if filter.Service != "" {
+		add("protocol = ?", filter.Service)
+	}
+	if filter.Session != "" {
+		add("session = ?", filter.Session)
+	}
+	if filter.Username != "" {
+		add("username = ?", filter.Username)
+	}
+	if filter.Password != "" {
+		add("password = ?", filter.Password)
+	}
+	if filter.Command != "" {
+		add(containsColumn(database.Session().Dialect(), "command"), filter.Command)
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < ?", filter.Until.UTC())
+	}
+
+	switch {
+	case filter.ClientIP == "":
+	case strings.Contains(filter.ClientIP, "/"):
+		_, ipnet, err := net.ParseCIDR(filter.ClientIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", filter.ClientIP)
+		}
+
+		// the CIDR is matched after the query, the events are scanned page by page
+		network = ipnet
+	default:
+		add("src_ip = ?", filter.ClientIP)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	cursor := filter.Cursor
+	if cursor <= 0 {
+		cursor = math.MaxInt64
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT %s
+		FROM event
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT ?
+	`, eventColumns, strings.Join(append(conds, "id < ?"), " AND "))
+
+	page := &EventPage{Events: []*Event{}}
+	for scanned := 0; scanned < maxScanPages; scanned++ {
+		events, err := queryEvents(ctx, stmt, append(args, cursor, limit)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			cursor = event.ID
+			if network != nil && !network.Contains(net.ParseIP(event.SrcIP)) {
+				continue
+			}
+
+			page.Events = append(page.Events, event)
+			if len(page.Events) == limit {
+				break
+			}
+		}
+
+		switch {
+		case len(page.Events) == limit:
+			// the page may be filled by the last batch, and the rest of the
+			// batch is continued by the next page
+			page.NextCursor = page.Events[limit-1].ID
+			return page, nil
+		case len(events) < limit:
+			// no more events
+			return page, nil
+		}
+	}
+
+	// stop scanning and let the client continue from the last scanned event
+	page.NextCursor = cursor
+	return page, nil
+}
+
+// Check the event matches the filter, the same as QueryEvents does except the
+// cursor and the limit.
+func (f EventFilter) Match(e *Event) bool {
+	switch {
+	case f.Type != "" && e.Type != f.Type:
+		return false
+	case f.Service != "" && e.Protocol != f.Service:
+		return false
+	case f.Session != "" && deref(e.Session) != f.Session:
+		return false
+	case f.Username != "" && deref(e.Username) != f.Username:
+		return false
+	case f.Password != "" && deref(e.Password) != f.Password:
+		return false
+	case f.Command != "" && !strings.Contains(deref(e.Command), f.Command):
+		return false
+	case !f.Since.IsZero() && e.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.CreatedAt.Before(f.Until):
+		return false
+	}
+
+	switch {
+	case f.ClientIP == "":
+		return true
+	case strings.Contains(f.ClientIP, "/"):
+		_, network, err := net.ParseCIDR(f.ClientIP)
+		return err == nil && network.Contains(net.ParseIP(e.SrcIP))
+	default:
+		return e.SrcIP == f.ClientIP
+	}
+}
+
+// query the events by the statement.
+func queryEvents(ctx context.Context, stmt string, args ...any) ([]*Event, error) {
+	rows, err := database.Session().QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := EventFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// get the condition that the column contains the substring, case-sensitive as the
+// strings.Contains on all the dialects. The LIKE is not used since it ignores the
+// case of ASCII on the SQLite3 and follows the collation on the MySQL.
+func containsColumn(dialect database.Dialect, column string) string {
+	switch dialect {
+	case database.Postgres:
+		return fmt.Sprintf("strpos(%s, ?) > 0", column)
+	case database.MySQL:
+		// compared as the binary string to be case-sensitive
+		return fmt.Sprintf("LOCATE(CAST(? AS BINARY), %s) > 0", column)
+	default:
+		return fmt.Sprintf("instr(%s, ?) > 0", column)
+	}
+}
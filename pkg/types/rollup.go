@@ -0,0 +1,362 @@
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// The time format of the hour of the rollups, in UTC.
+const hourFormat = "2006-01-02T15"
+
+// The number of the events scanned at once when rebuilding the rollups.
+const rebuildPageSize = 1000
+
+// The fields of the events counted in the hourly rollups.
+var RollupFields = []string{
+	"src_ip", "src_port", "dst_ip", "dst_port", "country", "city", "asn",
+	"username", "password", "command", "decoded",
+}
+
+// The hourly rollup of the events, the number of the events per hour, service,
+// field and value. The rollups are kept forever, even the raw events are pruned.
+type Rollup struct {
+	Hour      string    `json:"hour"`
+	Service   string    `json:"service"`
+	Field     string    `json:"field"`
+	Value     string    `json:"value"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Get the values of the rollup fields in the event, the empty field is skipped.
+func (e *Event) RollupValues() map[string]string {
+	values := map[string]string{}
+
+	set := func(field, value string) {
+		if value != "" {
+			values[field] = value
+		}
+	}
+
+	set("src_ip", e.SrcIP)
+	set("dst_ip", e.DstIP)
+	set("country", e.Country)
+	set("city", e.City)
+	set("username", deref(e.Username))
+	set("password", deref(e.Password))
+	set("command", deref(e.Command))
+	set("decoded", deref(e.Decoded))
+
+	if e.SrcPort > 0 {
+		set("src_port", strconv.Itoa(e.SrcPort))
+	}
+	if e.DstPort > 0 {
+		set("dst_port", strconv.Itoa(e.DstPort))
+	}
+	if e.ASN > 0 {
+		set("asn", strings.TrimSpace(fmt.Sprintf("AS%d %s", e.ASN, e.Org)))
+	}
+
+	return values
+}
+
+// Aggregate the events into the rollups.
+func RollupEvents(events []*Event) []*Rollup {
+	var rollups []*Rollup
+	index := map[string]*Rollup{}
+
+	for _, event := range events {
+		hour := event.CreatedAt.UTC().Format(hourFormat)
+
+		for field, value := range event.RollupValues() {
+			key := strings.Join([]string{hour, event.Protocol, field, value}, "\x00")
+
+			rollup, ok := index[key]
+			if !ok {
+				rollup = &Rollup{
+					Hour:      hour,
+					Service:   event.Protocol,
+					Field:     field,
+					Value:     value,
+					FirstSeen: event.CreatedAt,
+					LastSeen:  event.CreatedAt,
+				}
+
+				index[key] = rollup
+				rollups = append(rollups, rollup)
+			}
+
+			rollup.Count++
+			if event.CreatedAt.Before(rollup.FirstSeen) {
+				rollup.FirstSeen = event.CreatedAt
+			}
+			if event.CreatedAt.After(rollup.LastSeen) {
+				rollup.LastSeen = event.CreatedAt
+			}
+		}
+	}
+
+	return rollups
+}
+
+// Merge the rollup into the database, the count is accumulated and the first
+// and last seen time are extended.
+func (r *Rollup) Merge(ctx context.Context, executor database.Executor) error {
+	var stmt string
+
+	switch executor.Dialect() {
+	case database.MySQL:
+		stmt = `
+			INSERT INTO rollup (hour, service, field, digest, value, count, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				count = count + VALUES(count),
+				first_seen = LEAST(first_seen, VALUES(first_seen)),
+				last_seen = GREATEST(last_seen, VALUES(last_seen))
+		`
+	default:
+		stmt = `
+			INSERT INTO rollup (hour, service, field, digest, value, count, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (hour, service, field, digest) DO UPDATE SET
+				count = rollup.count + excluded.count,
+				first_seen = CASE WHEN excluded.first_seen < rollup.first_seen THEN excluded.first_seen ELSE rollup.first_seen END,
+				last_seen = CASE WHEN excluded.last_seen > rollup.last_seen THEN excluded.last_seen ELSE rollup.last_seen END
+		`
+	}
+
+	digest := sha256.Sum256([]byte(r.Value))
+	args := []any{
+		r.Hour, r.Service, r.Field, hex.EncodeToString(digest[:]), r.Value, r.Count,
+		r.FirstSeen.UTC(), r.LastSeen.UTC(),
+	}
+
+	_, err := executor.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// Repair the rollups of the days that count less events than the raw events,
+// like the events stored before the rollups are introduced or the rollups lost
+// by the failure. The days that count more events are pruned and kept as is.
+// Return the repaired days.
+func RepairRollups(ctx context.Context, r Range) ([]string, error) {
+	events, err := countEventDays(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	rollups, err := countRollupDays(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, day := range sortedKeys(events) {
+		if rollups[day] >= events[day] {
+			continue
+		}
+
+		log.Info().Str("day", day).Int("events", events[day]).Int("rollups", rollups[day]).Msg("repair the incomplete rollups")
+		if err := rebuildDay(ctx, day); err != nil {
+			return days, err
+		}
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// Rebuild the rollups of the days in the range from the raw events, the days
+// without the raw events are kept as is. The raw events of the rebuilt days must
+// not be pruned, otherwise the pruned events are lost from the rollups. Return
+// the rebuilt days.
+func RebuildRollups(ctx context.Context, r Range) ([]string, error) {
+	events, err := countEventDays(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, day := range sortedKeys(events) {
+		if err := rebuildDay(ctx, day); err != nil {
+			return days, err
+		}
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// rebuild the rollups of the day in UTC from the raw events in a single
+// transaction.
+func rebuildDay(ctx context.Context, day string) error {
+	since, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return err
+	}
+	until := since.AddDate(0, 0, 1)
+
+	tx, err := database.Session().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt := `DELETE FROM rollup WHERE hour >= ? AND hour < ?`
+	if _, err := tx.ExecContext(ctx, stmt, since.Format(hourFormat), until.Format(hourFormat)); err != nil {
+		return err
+	}
+
+	stmt = fmt.Sprintf(`
+		SELECT %s
+		FROM event
+		WHERE created_at >= ? AND created_at < ? AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, eventColumns)
+
+	lastID := 0
+	for {
+		events, err := scanEvents(tx.QueryContext(ctx, stmt, since, until, lastID, rebuildPageSize))
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, rollup := range RollupEvents(events) {
+			if err := rollup.Merge(ctx, tx); err != nil {
+				return err
+			}
+		}
+
+		lastID = events[len(events)-1].ID
+	}
+
+	return tx.Commit()
+}
+
+// count the raw events with the source IP per day in UTC, the same as the
+// src_ip rollups count.
+func countEventDays(ctx context.Context, r Range) (map[string]int, error) {
+	store := database.Session()
+	epoch := epochColumn(store.Dialect())
+
+	conds, args := []string{"src_ip IS NOT NULL", "src_ip <> ''"}, []any{}
+	if !r.Since.IsZero() {
+		conds, args = append(conds, "created_at >= ?"), append(args, r.Since.UTC())
+	}
+	if !r.Until.IsZero() {
+		conds, args = append(conds, "created_at < ?"), append(args, r.Until.UTC())
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT %[1]s - %[1]s %% 86400 AS day, COUNT(*)
+		FROM event
+		WHERE %[2]s
+		GROUP BY day
+	`, epoch, strings.Join(conds, " AND "))
+
+	rows, err := store.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day int64
+		var count int
+
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+
+		counts[time.Unix(day, 0).UTC().Format(time.DateOnly)] += count
+	}
+
+	return counts, rows.Err()
+}
+
+// count the events in the src_ip rollups per day in UTC.
+func countRollupDays(ctx context.Context, r Range) (map[string]int, error) {
+	conds, args := []string{"field = 'src_ip'"}, []any{}
+	if !r.Since.IsZero() {
+		conds, args = append(conds, "hour >= ?"), append(args, r.Since.UTC().Format(hourFormat))
+	}
+	if !r.Until.IsZero() {
+		conds, args = append(conds, "hour < ?"), append(args, r.Until.UTC().Format(hourFormat))
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT SUBSTR(hour, 1, 10) AS day, SUM(count)
+		FROM rollup
+		WHERE %s
+		GROUP BY SUBSTR(hour, 1, 10)
+	`, strings.Join(conds, " AND "))
+
+	rows, err := database.Session().QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day string
+		var count int
+
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+
+		counts[day] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// scan the events of the query.
+func scanEvents(rows *sql.Rows, err error) ([]*Event, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := EventFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func sortedKeys(values map[string]int) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,146 @@
+package types
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+func TestRangeHours(t *testing.T) {
+	taipei := time.FixedZone("UTC+8", 8*3600)
+	kolkata := time.FixedZone("UTC+5:30", 5*3600+1800)
+	at := func(hour, minute int, loc *time.Location) time.Time {
+		return time.Date(2024, 1, 2, hour, minute, 0, 0, loc)
+	}
+
+	cases := []struct {
+		name  string
+		r     Range
+		since time.Time
+		until time.Time
+	}{
+		{name: "utc", r: Range{Since: at(0, 0, time.UTC), Until: at(12, 0, time.UTC)}, since: at(0, 0, time.UTC), until: at(12, 0, time.UTC)},
+		{name: "hourly offset", r: Range{Since: at(0, 0, taipei), Until: at(12, 0, taipei)}, since: at(0, 0, taipei), until: at(12, 0, taipei)},
+		{name: "half-hour offset", r: Range{Since: at(0, 0, kolkata), Until: at(12, 0, kolkata)}, since: at(0, 0, kolkata).Add(-30 * time.Minute), until: at(12, 0, kolkata).Add(30 * time.Minute)},
+		{name: "minutes", r: Range{Since: at(1, 15, time.UTC), Until: at(2, 45, time.UTC)}, since: at(1, 0, time.UTC), until: at(3, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hours := c.r.Hours()
+			if !hours.Since.Equal(c.since) || !hours.Until.Equal(c.until) {
+				t.Errorf("expect [%v, %v), got [%v, %v)", c.since, c.until, hours.Since, hours.Until)
+			}
+		})
+	}
+}
+
+func TestPopularEvents(t *testing.T) {
+	reset(t)
+
+	ctx := context.Background()
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	username := "root"
+
+	var events []*Event
+	for index, ip := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2", "192.0.2.1"} {
+		events = append(events, &Event{
+			CreatedAt: base.Add(time.Duration(index) * 90 * time.Minute),
+			Type:      EventAuthPassword,
+			Protocol:  "ssh",
+			SrcIP:     ip,
+			Username:  &username,
+		})
+	}
+
+	if err := InsertEvents(ctx, events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	// the raw events are pruned, and the rollups are kept
+	if _, err := database.Session().ExecContext(ctx, "DELETE FROM event"); err != nil {
+		t.Fatalf("failed to prune the events: %v", err)
+	}
+
+	kolkata := time.FixedZone("UTC+5:30", 5*3600+1800)
+	cases := []struct {
+		name    string
+		r       Range
+		reports []Report
+	}{
+		{name: "day", r: Range{Since: base, Until: base.AddDate(0, 0, 1)}, reports: []Report{{Value: "192.0.2.1", Count: 3}, {Value: "192.0.2.2", Count: 1}}},
+		{name: "hours", r: Range{Since: base, Until: base.Add(2 * time.Hour)}, reports: []Report{{Value: "192.0.2.1", Count: 2}}},
+		{name: "widened", r: Range{Since: base.Add(30 * time.Minute), Until: base.Add(3*time.Hour + time.Minute)}, reports: []Report{{Value: "192.0.2.1", Count: 2}, {Value: "192.0.2.2", Count: 1}}},
+		{name: "time zone", r: Range{Since: time.Date(2024, 1, 2, 5, 30, 0, 0, kolkata), Until: time.Date(2024, 1, 3, 5, 30, 0, 0, kolkata)}, reports: []Report{{Value: "192.0.2.1", Count: 3}, {Value: "192.0.2.2", Count: 1}}},
+		{name: "empty", r: Range{Since: base.AddDate(0, 0, 1), Until: base.AddDate(0, 0, 2)}, reports: nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var reports []Report
+			for _, report := range PopularEvents(ctx, "src_ip", c.r, 10) {
+				reports = append(reports, *report)
+			}
+
+			if !reflect.DeepEqual(reports, c.reports) {
+				t.Errorf("expect %+v, got %+v", c.reports, reports)
+			}
+		})
+	}
+}
+
+func TestRepairRollups(t *testing.T) {
+	reset(t)
+
+	ctx := context.Background()
+	day1 := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	events := []*Event{
+		{CreatedAt: day1, Type: EventConnect, Protocol: "ssh", SrcIP: "192.0.2.1"},
+		{CreatedAt: day1.Add(time.Hour), Type: EventConnect, Protocol: "ssh", SrcIP: "192.0.2.2"},
+		{CreatedAt: day2, Type: EventConnect, Protocol: "ssh", SrcIP: "192.0.2.3"},
+	}
+	if err := InsertEvents(ctx, events); err != nil {
+		t.Fatalf("failed to insert the events: %v", err)
+	}
+
+	if days, err := RepairRollups(ctx, Range{}); err != nil || len(days) != 0 {
+		t.Fatalf("expect nothing to repair, got %v: %v", days, err)
+	}
+
+	// lose the rollups of the first day partially
+	stmt := "DELETE FROM rollup WHERE hour = ?"
+	if _, err := database.Session().ExecContext(ctx, stmt, day1.Format(hourFormat)); err != nil {
+		t.Fatalf("failed to delete the rollups: %v", err)
+	}
+
+	days, err := RepairRollups(ctx, Range{})
+	if err != nil {
+		t.Fatalf("failed to repair the rollups: %v", err)
+	}
+	if !reflect.DeepEqual(days, []string{"2024-01-02"}) {
+		t.Errorf("expect the first day repaired, got %v", days)
+	}
+
+	r := Range{Since: day1.Truncate(24 * time.Hour), Until: day2.Add(time.Hour)}
+	if reports := PopularEvents(ctx, "src_ip", r, 10); len(reports) != 3 {
+		t.Errorf("expect 3 source IPs after the repair, got %d", len(reports))
+	}
+
+	// rebuilding twice never doubles the counts
+	for range 2 {
+		if days, err := RebuildRollups(ctx, Range{Since: day2}); err != nil || !reflect.DeepEqual(days, []string{"2024-01-03"}) {
+			t.Fatalf("expect the second day rebuilt, got %v: %v", days, err)
+		}
+	}
+
+	for _, report := range PopularEvents(ctx, "src_ip", r, 10) {
+		if report.Count != 1 {
+			t.Errorf("expect the count 1 of %s, got %d", report.Value, report.Count)
+		}
+	}
+}
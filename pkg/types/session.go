@@ -0,0 +1,95 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// The summary of the session, aggregated from the events of the session.
+type Session struct {
+	ID        string    `json:"id"`
+	Service   string    `json:"service"`
+	SrcIP     string    `json:"src_ip"`
+	Country   string    `json:"country"`
+	City      string    `json:"city"`
+	ASN       int       `json:"asn"`
+	Org       string    `json:"org"`
+	Username  string    `json:"username"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Events    int       `json:"events"`
+	Commands  int       `json:"commands"`
+}
+
+// Get the duration between the first and the last event of the session.
+func (s *Session) Duration() time.Duration {
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// Get the sessions started in the range, from the oldest to the latest.
+func RangeSessions(ctx context.Context, r Range) []*Session {
+	stmt := `
+		SELECT
+			session,
+			MAX(protocol),
+			MAX(src_ip),
+			MAX(country),
+			MAX(city),
+			MAX(asn),
+			MAX(org),
+			MAX(username),
+			MIN(created_at) AS started_at,
+			MAX(created_at),
+			COUNT(*),
+			SUM(CASE WHEN type = 'command' THEN 1 ELSE 0 END)
+		FROM event
+		WHERE
+			session IS NOT NULL AND created_at >= ? AND created_at < ?
+		GROUP BY session
+		ORDER BY started_at
+	`
+
+	rows, err := database.Session().QueryContext(ctx, stmt, r.Since.UTC(), r.Until.UTC())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the sessions")
+		return nil
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		var service, srcIP, country, city, org, username *string
+		var asn *int
+		var startedAt, endedAt database.Timestamp
+
+		err := rows.Scan(
+			&session.ID, &service, &srcIP, &country, &city, &asn, &org, &username,
+			&startedAt, &endedAt, &session.Events, &session.Commands,
+		)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to parse the session")
+			continue
+		}
+
+		session.Service = deref(service)
+		session.SrcIP = deref(srcIP)
+		session.Country = deref(country)
+		session.City = deref(city)
+		session.Org = deref(org)
+		session.Username = deref(username)
+		session.StartedAt = startedAt.Time
+		session.EndedAt = endedAt.Time
+		if asn != nil {
+			session.ASN = *asn
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	return sessions
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cmj0121/zoe/pkg/database"
+)
+
+// The number of the events in the bucket of the timeline.
+type TimelineBucket struct {
+	Time     time.Time `json:"time"`
+	Events   int       `json:"events"`
+	Connects int       `json:"connects"`
+	Auths    int       `json:"auths"`
+	Commands int       `json:"commands"`
+}
+
+// Get the timeline of the events in the range, bucketed by the interval in the
+// time zone of the range. The empty buckets are included, from the oldest to the
+// latest.
+func Timeline(ctx context.Context, r Range, interval time.Duration) ([]*TimelineBucket, error) {
+	step := int64(interval / time.Second)
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	store := database.Session()
+
+	// the seconds since the epoch, shifted by the offset of the time zone
+	_, offset := r.Since.Zone()
+	epoch := fmt.Sprintf("(%s + %d)", epochColumn(store.Dialect()), offset)
+
+	stmt := fmt.Sprintf(`
+		SELECT
+			%[1]s - %[1]s %% %[2]d AS bucket,
+			COUNT(*),
+			SUM(CASE WHEN type = 'connect' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN type LIKE 'auth.%%' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN type = 'command' THEN 1 ELSE 0 END)
+		FROM event
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY bucket
+	`, epoch, step)
+
+	rows, err := store.QueryContext(ctx, stmt, r.Since.UTC(), r.Until.UTC())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to query the timeline")
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := map[int64]*TimelineBucket{}
+	for rows.Next() {
+		var key int64
+		var bucket TimelineBucket
+
+		if err := rows.Scan(&key, &bucket.Events, &bucket.Connects, &bucket.Auths, &bucket.Commands); err != nil {
+			log.Warn().Err(err).Msg("failed to parse the timeline")
+			return nil, err
+		}
+
+		buckets[key] = &bucket
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// fill the empty buckets
+	var timeline []*TimelineBucket
+	loc := r.Since.Location()
+	first := r.Since.Unix() + int64(offset)
+	for key := first - first%step; key < r.Until.Unix()+int64(offset); key += step {
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &TimelineBucket{}
+		}
+
+		bucket.Time = time.Unix(key-int64(offset), 0).In(loc)
+		timeline = append(timeline, bucket)
+	}
+
+	return timeline, nil
+}
+
+// get the expression of the seconds since the epoch of the created_at column.
+func epochColumn(dialect database.Dialect) string {
+	switch dialect {
+	case database.Postgres:
+		return "CAST(EXTRACT(EPOCH FROM created_at) AS BIGINT)"
+	case database.MySQL:
+		return "TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', created_at)"
+	default:
+		return "CAST(strftime('%s', created_at) AS INTEGER)"
+	}
+}
@@ -2,18 +2,28 @@ package zoe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 
+	"github.com/cmj0121/zoe/pkg/alert"
+	"github.com/cmj0121/zoe/pkg/blocklist"
+	"github.com/cmj0121/zoe/pkg/geoip"
 	"github.com/cmj0121/zoe/pkg/honeypot"
 	"github.com/cmj0121/zoe/pkg/monitor"
+	"github.com/cmj0121/zoe/pkg/monitor/auth"
+	"github.com/cmj0121/zoe/pkg/pipeline"
+	"github.com/cmj0121/zoe/pkg/retention"
+	"github.com/cmj0121/zoe/pkg/syslog"
+	"github.com/cmj0121/zoe/pkg/types"
 )
 
 const (
@@ -35,11 +45,41 @@ type Zoe struct {
 	Quiet   bool `short:"q" xor:"quite,verbose" help:"Show no output"`
 
 	// The external configuration
-	Config   *string         `short:"c" help:"The external configuration file"`
-	Database *Database       `embed:"" help:"The database service"`
-	Server   *monitor.Server `embed:"" help:"The MongoDB service"`
+	Config    *string              `short:"c" help:"The external configuration file"`
+	Database  *Database            `embed:"" help:"The database service"`
+	Server    *monitor.Server      `embed:"" help:"The MongoDB service"`
+	Pipeline  *pipeline.Pipeline   `embed:"" help:"The buffered event pipeline"`
+	GeoIP     *geoip.GeoIP         `embed:"" prefix:"geoip-" help:"The offline GeoIP databases"`
+	Retention *retention.Retention `embed:"" prefix:"retention-" help:"The retention policy of the events"`
+	Blocklist *blocklist.Blocklist `embed:"" prefix:"blocklist-" help:"The exported blocklist of the source IPs"`
+	Alert     *alert.Alert         `embed:"" prefix:"alert-" help:"The alert rules and the webhooks"`
+	Syslog    *syslog.Syslog       `embed:"" prefix:"syslog-" help:"The syslog sink of the events"`
 
-	Service honeypot.Service `arg:"" help:"The honeypot service" default:"ssh"`
+	// The sub-commands, run the honeypot service by default.
+	Serve struct {
+		Service honeypot.Service `arg:"" help:"The honeypot service" default:"ssh"`
+	} `cmd:"" name:"run" default:"withargs" help:"Run the honeypot service"`
+	Prune struct{} `cmd:"" help:"Prune (and archive) the expired events by the retention policy"`
+	Token struct {
+		Name string    `arg:"" help:"The name of the API token, written in the audit log"`
+		Role auth.Role `enum:"public,analyst" default:"analyst" help:"The role of the API token, one of public and analyst"`
+	} `cmd:"" help:"Generate the API token of the monitor and the hash in the configuration"`
+	Export struct {
+		Blocklist ExportBlocklist `cmd:"" help:"Export the blocklist of the source IPs seen in the time window"`
+		STIX      ExportIntel     `cmd:"" name:"stix" help:"Export the observed indicators as the STIX 2.1 bundle"`
+		MISP      ExportIntel     `cmd:"" name:"misp" help:"Export the observed indicators as the MISP events"`
+	} `cmd:"" help:"Export the recorded events for the other tools"`
+	Rollup struct {
+		Rebuild struct {
+			Since time.Time `help:"The start of the rebuilt days, in RFC 3339, default is the first event"`
+			Until time.Time `help:"The end of the rebuilt days, in RFC 3339, default is now"`
+		} `cmd:"" help:"Rebuild the hourly rollups of the days from the raw events, the pruned days are kept"`
+	} `cmd:"" help:"Manage the hourly rollups of the events"`
+	AlertCmd struct {
+		Test struct {
+			Webhooks []string `arg:"" optional:"" help:"The names of the webhooks, all the webhooks when empty"`
+		} `cmd:"" help:"Send the test alert to the webhooks and report the result"`
+	} `cmd:"" name:"alert" help:"Manage the alert webhooks"`
 }
 
 func init() {
@@ -64,13 +104,32 @@ func (z *Zoe) ParseAndRun() error {
 		kong.Vars{"version": fmt.Sprintf("%s/%d.%d.%d", PROJ_NAME, MAJOR, MINOR, MICRO)},
 	}
 
-	kong.Parse(z, opts...)
-	return z.Run()
+	ctx := kong.Parse(z, opts...)
+	switch ctx.Command() {
+	case "prune":
+		return z.RunPrune()
+	case "rollup rebuild":
+		return z.RunRollupRebuild()
+	case "token <name>":
+		return z.RunToken()
+	case "alert test", "alert test <webhooks>":
+		return z.RunAlertTest()
+	case "export blocklist":
+		return z.RunExportBlocklist()
+	case "export stix":
+		return z.RunExportIntel(z.Export.STIX, exportSTIX)
+	case "export misp":
+		return z.RunExportIntel(z.Export.MISP, exportMISP)
+	default:
+		return z.Run()
+	}
 }
 
 // Run the Zoe instance with the known arguments.
 func (z *Zoe) Run() error {
-	z.prologue()
+	if err := z.prologue(); err != nil {
+		return err
+	}
 	defer z.epilogue()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -92,14 +151,136 @@ func (z *Zoe) Run() error {
 		}
 	}()
 
+	z.Pipeline.Init()
+	z.GeoIP.Init()
+	z.Blocklist.Init()
+	z.Alert.Init()
+	z.Syslog.Version = fmt.Sprintf("%d.%d.%d", MAJOR, MINOR, MICRO)
+	z.Syslog.Init()
+	types.DecodeEvents(ctx)
+	types.EnrichEvents(ctx)
+	if _, err := types.RepairRollups(ctx, types.Range{}); err != nil {
+		log.Warn().Err(err).Msg("failed to repair the rollups")
+	}
+
 	go z.Server.Run(ctx)
-	return z.Service.Run(ctx)
+	go z.Pipeline.Run(ctx)
+	go z.Retention.Run(ctx)
+	go z.Alert.Run(ctx)
+	go z.Syslog.Run(ctx)
+
+	err := z.Serve.Service.Run(ctx)
+	// flush the remaining events before exit
+	cancel()
+	z.Pipeline.Wait()
+	z.Syslog.Wait()
+	return err
+}
+
+// Prune the expired events once and exit.
+func (z *Zoe) RunPrune() error {
+	if err := z.prologue(); err != nil {
+		return err
+	}
+	defer z.epilogue()
+
+	count, err := z.Retention.Prune(context.Background())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to prune the expired events")
+		return err
+	}
+
+	fmt.Printf("pruned %d events\n", count)
+	return nil
+}
+
+// Rebuild the hourly rollups of the days in the range from the raw events once
+// and exit.
+func (z *Zoe) RunRollupRebuild() error {
+	if err := z.prologue(); err != nil {
+		return err
+	}
+	defer z.epilogue()
+
+	opts := z.Rollup.Rebuild
+	days, err := types.RebuildRollups(context.Background(), types.Range{Since: opts.Since, Until: opts.Until})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to rebuild the rollups")
+		return err
+	}
+
+	fmt.Printf("rebuilt %d days\n", len(days))
+	return nil
+}
+
+// Generate the API token, only the hash is stored in the configuration and the
+// token is shown once.
+func (z *Zoe) RunToken() error {
+	token, hash, err := auth.Generate()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate the API token")
+		return err
+	}
+
+	fmt.Printf("token: %s\n\n", token)
+	fmt.Println("server:")
+	fmt.Println("  tokens:")
+	fmt.Printf("    - name: %s\n", z.Token.Name)
+	fmt.Printf("      role: %s\n", z.Token.Role)
+	fmt.Printf("      hash: %s\n", hash)
+	return nil
 }
 
-func (z *Zoe) prologue() {
+// Send the test alert to the webhooks and report the result of each webhook.
+func (z *Zoe) RunAlertTest() error {
+	if err := z.prologue(); err != nil {
+		return err
+	}
+	defer z.epilogue()
+
+	z.Alert.Init()
+
+	webhooks := z.Alert.Webhooks
+	if names := z.AlertCmd.Test.Webhooks; len(names) > 0 {
+		webhooks = nil
+		for _, name := range names {
+			webhook := z.Alert.Webhook(name)
+			if webhook == nil {
+				err := fmt.Errorf("unknown webhook: %s", name)
+				log.Error().Err(err).Msg("failed to find the webhook")
+				return err
+			}
+
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	if len(webhooks) == 0 {
+		err := fmt.Errorf("no webhook configured")
+		log.Error().Err(err).Msg("failed to send the test alert")
+		return err
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		switch err := webhook.Send(context.Background(), alert.Sample()); err {
+		case nil:
+			fmt.Printf("%s: ok\n", webhook.Name)
+		default:
+			fmt.Printf("%s: %v\n", webhook.Name, err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Setup the logger, load the configuration and migrate the database, the command
+// never runs on the half-migrated schema.
+func (z *Zoe) prologue() error {
 	if z.Quiet {
 		zerolog.SetGlobalLevel(zerolog.Disabled)
-		return
+		return nil
 	}
 
 	switch z.Verbose {
@@ -118,7 +299,11 @@ func (z *Zoe) prologue() {
 	log.Info().Msg("finished the prologue ...")
 	z.loadConfig()
 	z.Database.Init()
-	z.Database.Migrate()
+	if err := z.Database.Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate the database: %w", err)
+	}
+
+	return nil
 }
 
 func (z *Zoe) epilogue() {
@@ -148,5 +333,5 @@ func (z *Zoe) loadConfig() {
 	}
 
 	// override the configuration by the external configuration
-	z.Service.Viper = v.Sub("service")
+	z.Serve.Service.Viper = v.Sub("service")
 }